@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/itsmylife44/terminus-pty/internal/pty"
+)
+
+// stringListFlag collects the values of a flag that may be repeated.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// parseSize parses a terminal size given as COLSxROWS, e.g. 200x50.
+func parseSize(s string) (pty.Size, error) {
+	c, r, ok := strings.Cut(s, "x")
+	if !ok {
+		return pty.Size{}, fmt.Errorf("invalid size %q, expected COLSxROWS", s)
+	}
+	cols, err := strconv.ParseUint(c, 10, 16)
+	if err != nil || cols == 0 {
+		return pty.Size{}, fmt.Errorf("invalid columns in size %q", s)
+	}
+	rows, err := strconv.ParseUint(r, 10, 16)
+	if err != nil || rows == 0 {
+		return pty.Size{}, fmt.Errorf("invalid rows in size %q", s)
+	}
+	return pty.Size{Cols: uint16(cols), Rows: uint16(rows)}, nil
+}
+
+// splitArgs parses the -args flag. Without quotes or backslashes the value
+// is split on commas, as it always was. Otherwise it is tokenized like a
+// shell command line: arguments are separated by whitespace, single quotes
+// preserve everything literally, and in double quotes or unquoted text a
+// backslash escapes the next character. No expansion is performed.
+func splitArgs(s string) ([]string, error) {
+	if !strings.ContainsAny(s, `'"\`) {
+		return strings.Split(s, ","), nil
+	}
+
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool // an argument has started, possibly as empty quotes
+		quote   rune // the open quote character, or 0
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			// In double quotes only a few characters can be escaped
+			if quote == '"' && !strings.ContainsRune("\"\\$`", r) {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("invalid args %q: trailing backslash", s)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("invalid args %q: unterminated %c quote", s, quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		// Without quotes or backslashes: the legacy comma split
+		{"-l", []string{"-l"}},
+		{"-l,-i", []string{"-l", "-i"}},
+		{"a b,c", []string{"a b", "c"}},
+
+		// Quoted arguments
+		{`-i -c 'print(1, 2)'`, []string{"-i", "-c", "print(1, 2)"}},
+		{`-c "echo hi"`, []string{"-c", "echo hi"}},
+		{`'' x`, []string{"", "x"}},
+		{`a'b'"c"`, []string{"abc"}},
+		{`'it'"'"'s'`, []string{"it's"}},
+
+		// Embedded and surrounding whitespace
+		{`  a   'b  c'  `, []string{"a", "b  c"}},
+		{"a\t'b\tc'\nd", []string{"a", "b\tc", "d"}},
+
+		// Escapes
+		{`a\ b c`, []string{"a b", "c"}},
+		{`\'x`, []string{"'x"}},
+		{`"a\"b"`, []string{`a"b`}},
+		{`"a\nb"`, []string{`a\nb`}},
+		{`"\\ \$ \x"`, []string{`\ $ \x`}},
+		{`'a\b'`, []string{`a\b`}},
+		{`\,`, []string{","}},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.in)
+		if err != nil {
+			t.Errorf("splitArgs(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitArgsErrors(t *testing.T) {
+	for _, in := range []string{`a\`, `'abc`, `"abc`, `"a'`} {
+		if got, err := splitArgs(in); err == nil {
+			t.Errorf("splitArgs(%q) = %q, want error", in, got)
+		}
+	}
+}
@@ -4,15 +4,24 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/itsmylife44/terminus-pty/internal/auth"
+	"github.com/itsmylife44/terminus-pty/internal/pty"
 	"github.com/itsmylife44/terminus-pty/internal/session"
 	"github.com/itsmylife44/terminus-pty/internal/tmux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // generateClientID creates a random 16-character hex string for client identification.
@@ -28,76 +37,437 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin:     func(r *http.Request) bool { return true },
 }
 
+// Options configures optional handler behavior.
+type Options struct {
+	TicketTTL   time.Duration // Lifetime of one-time connect tickets (default 30s)
+	StrictJSON  bool          // Reject request bodies containing unknown fields
+	ConnectHook ConnectHook   // Per-session authorization before a WebSocket upgrade (nil = allow all)
+	MetricsAuth bool          // Require authentication for /metrics (default: exempt)
+	Build       BuildInfo     // Reported by /health
+
+	// DefaultSessionID is a well-known session ID that is created with the
+	// server defaults on first connect (empty = disabled)
+	DefaultSessionID string
+}
+
+// RoleViewer is a ConnectDecision role that makes the connection read-only.
+const RoleViewer = "viewer"
+
+// ConnectDecision is the outcome of a ConnectHook.
+type ConnectDecision struct {
+	Allow bool
+	Role  string // Optional role for the connection, e.g. RoleViewer
+}
+
+// ConnectHook decides whether a request may attach to a session. It runs
+// after authentication and before the WebSocket upgrade, so embedders can
+// enforce per-session access rules.
+type ConnectHook func(r *http.Request, sess *session.Session) ConnectDecision
+
 type Handler struct {
-	pool *session.Pool
-	auth *auth.BasicAuth
+	pool        *session.Pool
+	auth        auth.Authenticator
+	tickets     *ticketStore
+	strictJSON  bool
+	connectHook ConnectHook
+	build       BuildInfo
+	startedAt   time.Time
+
+	defaultSessionID string
+	defaultMu        sync.Mutex // serializes auto-creation of the default session
 }
 
-func NewHandler(pool *session.Pool, authenticator *auth.BasicAuth) http.Handler {
+func NewHandler(pool *session.Pool, authenticator auth.Authenticator, opts Options) http.Handler {
+	if opts.TicketTTL <= 0 {
+		opts.TicketTTL = 30 * time.Second
+	}
+
 	h := &Handler{
-		pool: pool,
-		auth: authenticator,
+		pool:        pool,
+		auth:        authenticator,
+		tickets:     newTicketStore(opts.TicketTTL),
+		strictJSON:  opts.StrictJSON,
+		connectHook: opts.ConnectHook,
+		build:       opts.Build,
+		startedAt:   time.Now(),
+
+		defaultSessionID: opts.DefaultSessionID,
 	}
 
 	r := mux.NewRouter()
 
 	r.HandleFunc("/health", h.health).Methods("GET")
+	r.HandleFunc("/healthz", h.healthz).Methods("GET")
+	r.HandleFunc("/readyz", h.readyz).Methods("GET")
+	r.HandleFunc("/capabilities", h.capabilities).Methods("GET")
+	r.HandleFunc("/signals", h.listSignals).Methods("GET")
+	r.HandleFunc("/pty", h.listSessions).Methods("GET")
 	r.HandleFunc("/pty", h.createSession).Methods("POST")
+	r.HandleFunc("/pty/bulk-delete", h.bulkDeleteSessions).Methods("POST")
+	// Registered before /pty/{id}/... so "new" isn't taken as a session ID
+	r.HandleFunc("/pty/new/connect", h.createAndConnect).Methods("GET")
+	r.HandleFunc("/pty/tmux", h.listTmuxSessions).Methods("GET")
 	r.HandleFunc("/pty/{id}", h.getSession).Methods("GET")
 	r.HandleFunc("/pty/{id}", h.updateSession).Methods("PUT")
 	r.HandleFunc("/pty/{id}", h.deleteSession).Methods("DELETE")
-	r.HandleFunc("/pty/{id}/connect", h.connectSession).Methods("GET")
+	r.HandleFunc("/pty/{id}/connect", h.connectSession).Methods("GET").Name("connect")
+	r.HandleFunc("/pty/{id}/ticket", h.createTicket).Methods("POST")
 	r.HandleFunc("/pty/{id}/takeover", h.takeoverSession).Methods("POST")
+	r.HandleFunc("/pty/{id}/refresh", h.refreshSession).Methods("POST")
+	r.HandleFunc("/pty/{id}/signal", h.signalSession).Methods("POST")
+	r.HandleFunc("/pty/{id}/exec", h.execSession).Methods("POST")
+	r.HandleFunc("/pty/{id}/reattach", h.reattachSession).Methods("POST")
+	r.HandleFunc("/pty/{id}/metrics", h.getSessionMetrics).Methods("GET")
 	r.HandleFunc("/pty/{id}/scrollback", h.getScrollback).Methods("GET")
+	r.HandleFunc("/pty/{id}/buffer", h.getBuffer).Methods("GET")
+	r.HandleFunc("/pty/{id}/recording", h.getRecording).Methods("GET")
+	r.HandleFunc("/pty/{id}/options", h.getOptions).Methods("GET")
+	r.HandleFunc("/pty/{id}/options", h.setOptions).Methods("PUT")
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	if err := pool.RegisterMetrics(registry); err != nil {
+		slog.Error("Failed to register metrics", "error", err)
+	}
+	metrics := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	r.Handle("/metrics", metrics).Methods("GET")
 
 	if authenticator != nil {
-		return authenticator.Middleware(r)
+		protected := h.ticketOrAuth(r, authenticator.Middleware(r))
+		// Scrapers and probes usually can't do basic auth, so /metrics
+		// (unless MetricsAuth) and the probe endpoints stay open
+		return withRequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			path := req.URL.Path
+			if path == "/healthz" || path == "/readyz" || (path == "/metrics" && !opts.MetricsAuth) {
+				r.ServeHTTP(w, req)
+				return
+			}
+			protected.ServeHTTP(w, req)
+		}))
 	}
-	return r
+	return withRequestID(r)
 }
 
-func (h *Handler) health(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode(map[string]any{
-		"status":   "ok",
-		"sessions": h.pool.Count(),
+// ticketOrAuth lets a WebSocket connect through without credentials when it
+// presents a valid one-time ticket for that session; everything else goes
+// through the authenticated handler.
+func (h *Handler) ticketOrAuth(router *mux.Router, protected http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+			var match mux.RouteMatch
+			if router.Match(r, &match) && match.Route.GetName() == "connect" && h.tickets.Consume(ticket, match.Vars["id"]) {
+				router.ServeHTTP(w, r)
+				return
+			}
+		}
+		protected.ServeHTTP(w, r)
 	})
 }
 
+// decodeBody decodes a JSON request body into v, writing a 400 response and
+// returning false if it is invalid. In strict mode unknown fields are
+// rejected so client typos don't silently fall back to defaults.
+func (h *Handler) decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	return h.decodeJSON(w, r, v, false)
+}
+
+// decodeOptionalBody is decodeBody for requests whose body may be empty, in
+// which case v is left as is.
+func (h *Handler) decodeOptionalBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	return h.decodeJSON(w, r, v, true)
+}
+
+// decodeJSON implements decodeBody and decodeOptionalBody.
+func (h *Handler) decodeJSON(w http.ResponseWriter, r *http.Request, v any, optional bool) bool {
+	dec := json.NewDecoder(r.Body)
+	if h.strictJSON {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(v)
+	if err == nil || (optional && errors.Is(err, io.EOF)) {
+		return true
+	}
+	if field, ok := unknownField(err); ok && h.strictJSON {
+		http.Error(w, "Invalid request body: unknown field "+field, http.StatusBadRequest)
+		return false
+	}
+	http.Error(w, "Invalid request body", http.StatusBadRequest)
+	return false
+}
+
+// unknownField reports the field a decoder with DisallowUnknownFields
+// rejected. encoding/json has no error type for it, only the message.
+func unknownField(err error) (string, bool) {
+	return strings.CutPrefix(err.Error(), "json: unknown field ")
+}
+
+// spawnRetryAfter is the Retry-After, in seconds, sent when a spawn failed
+// because the host was temporarily out of resources.
+const spawnRetryAfter = "5"
+
+// retryLater responds 503 with a Retry-After, for spawn failures caused by
+// fd or process exhaustion rather than the request itself.
+func retryLater(w http.ResponseWriter, msg string) {
+	w.Header().Set("Retry-After", spawnRetryAfter)
+	http.Error(w, msg, http.StatusServiceUnavailable)
+}
+
+// sessionNotFound responds 404, or 410 if the session was removed because
+// its tmux session ended, so reconnecting clients know to stop retrying.
+func (h *Handler) sessionNotFound(w http.ResponseWriter, id string) {
+	if status, ok := h.pool.Exited(id); ok && status.TmuxGone {
+		http.Error(w, "tmux session terminated", http.StatusGone)
+		return
+	}
+	http.Error(w, "Session not found", http.StatusNotFound)
+}
+
+// CapabilitiesResponse is the response for GET /capabilities. It describes
+// which optional features are enabled so clients can adapt their UI.
+type CapabilitiesResponse struct {
+	Tmux         bool     `json:"tmux"`
+	Spool        bool     `json:"spool"`
+	BellEvents   bool     `json:"bellEvents"`
+	Redaction    bool     `json:"redaction"`
+	Recording    bool     `json:"recording"`
+	Compression  bool     `json:"compression"`
+	Auth         string   `json:"auth"`
+	Subprotocols []string `json:"subprotocols"`
+	TmuxOptions  []string `json:"tmuxOptions,omitempty"`
+}
+
+func (h *Handler) capabilities(w http.ResponseWriter, r *http.Request) {
+	cfg := h.pool.Config()
+
+	resp := CapabilitiesResponse{
+		Tmux:         cfg.TmuxEnabled,
+		Spool:        !cfg.TmuxEnabled,
+		BellEvents:   cfg.BellEvents,
+		Redaction:    len(cfg.RedactPatterns) > 0,
+		Recording:    cfg.RecordDir != "" || cfg.RecordStore != nil,
+		Auth:         "none",
+		Subprotocols: []string{},
+	}
+	if h.auth != nil {
+		resp.Auth = h.auth.Scheme()
+	}
+	if cfg.TmuxEnabled {
+		resp.TmuxOptions = tmux.AllowedOptions()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// listSignals returns the signal names the server accepts, with their numbers.
+func (h *Handler) listSignals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session.Signals())
+}
+
 type CreateRequest struct {
 	Cols    uint16   `json:"cols"`
 	Rows    uint16   `json:"rows"`
 	Command string   `json:"command,omitempty"`
 	Args    []string `json:"args,omitempty"`
 	Workdir string   `json:"workdir,omitempty"`
+	Spool   bool     `json:"spool,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+	Name    string   `json:"name,omitempty"` // Human-friendly label, need not be unique
+
+	Env  map[string]string `json:"env,omitempty"`  // Extra environment variables for the command
+	Vars map[string]string `json:"vars,omitempty"` // Substituted into the profile's args, as allowed by its vars
+
+	InitCommands []string `json:"initCommands,omitempty"` // Typed into the session once it starts
+
+	FallbackCommand string `json:"fallbackCommand,omitempty"`
+
+	RestartPolicy  session.RestartPolicy `json:"restartPolicy,omitempty"`
+	MaxOutputBytes int64                 `json:"maxOutputBytes,omitempty"`
+	OutputCharset  string                `json:"outputCharset,omitempty"`
+
+	// Terminal attributes set after spawn, for automation that doesn't want
+	// to send stty commands. Direct sessions only.
+	Echo *bool `json:"echo,omitempty"`
+	Raw  bool  `json:"raw,omitempty"`
+
+	BracketedPaste bool `json:"bracketedPaste,omitempty"` // Wrap paste control messages in bracketed-paste sequences
+
+	TmuxHistoryLimit int   `json:"tmuxHistoryLimit,omitempty"`
+	TmuxStatus       *bool `json:"tmuxStatus,omitempty"`
 }
 
 type CreateResponse struct {
-	ID string `json:"id"`
+	ID      string `json:"id"`
+	Command string `json:"command"`
+	Cols    uint16 `json:"cols"` // size in effect, after defaults and the minimum size
+	Rows    uint16 `json:"rows"`
 }
 
 func (h *Handler) createSession(w http.ResponseWriter, r *http.Request) {
 	var req CreateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !h.decodeBody(w, r, &req) {
 		return
 	}
 
-	if req.Cols == 0 {
-		req.Cols = 80
+	if req.TmuxHistoryLimit < 0 {
+		http.Error(w, "tmuxHistoryLimit must not be negative", http.StatusBadRequest)
+		return
 	}
-	if req.Rows == 0 {
-		req.Rows = 24
+	if req.MaxOutputBytes < 0 {
+		http.Error(w, "maxOutputBytes must not be negative", http.StatusBadRequest)
+		return
 	}
+	if req.OutputCharset != "" {
+		if _, err := session.LookupCharset(req.OutputCharset); err != nil {
+			http.Error(w, "Invalid outputCharset: "+req.OutputCharset, http.StatusBadRequest)
+			return
+		}
+	}
+	switch req.RestartPolicy {
+	case "", session.RestartNever, session.RestartOnFailure:
+	default:
+		http.Error(w, "restartPolicy must be never or on-failure", http.StatusBadRequest)
+		return
+	}
+	if err := session.ValidateEnv(req.Env); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, err := session.SanitizeName(req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.pool.Create(session.CreateOptions{
+		Name:    name,
+		Cols:    req.Cols,
+		Rows:    req.Rows,
+		Command: req.Command,
+		Args:    req.Args,
+		Workdir: req.Workdir,
+		Spool:   req.Spool,
+		Profile: req.Profile,
+		Env:     req.Env,
+		Vars:    req.Vars,
 
-	sess, err := h.pool.Create(req.Cols, req.Rows, req.Command, req.Args, req.Workdir)
+		FallbackCommand: req.FallbackCommand,
+		InitCommands:    req.InitCommands,
+		RestartPolicy:   req.RestartPolicy,
+		MaxOutputBytes:  req.MaxOutputBytes,
+		OutputCharset:   req.OutputCharset,
+		LineMode:        pty.LineMode{Echo: req.Echo, Raw: req.Raw},
+		BracketedPaste:  req.BracketedPaste,
+
+		TmuxHistoryLimit: req.TmuxHistoryLimit,
+		TmuxStatus:       req.TmuxStatus,
+	})
 	if err != nil {
-		slog.Error("Failed to create session", "error", err)
-		http.Error(w, "Failed to create session: "+err.Error(), http.StatusInternalServerError)
+		writeCreateError(w, r, err)
 		return
 	}
 
+	requestLogger(r).Info("Session created by request", "id", sess.ID, "remote", r.RemoteAddr)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(CreateResponse{ID: sess.ID})
+	json.NewEncoder(w).Encode(CreateResponse{ID: sess.ID, Command: sess.Command, Cols: sess.Cols, Rows: sess.Rows})
+}
+
+// writeCreateError answers a request whose session could not be created,
+// with a status telling the client whether the request or the server is at
+// fault.
+func writeCreateError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, session.ErrUnknownProfile) || errors.Is(err, session.ErrArgsLimit) ||
+		errors.Is(err, session.ErrInvalidWorkdir) || errors.Is(err, session.ErrLineModeTmux) ||
+		errors.Is(err, pty.ErrLineModeUnsupported) || errors.Is(err, session.ErrInvalidVars) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, session.ErrCommandNotAllowed) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, session.ErrResourcesExhausted) || errors.Is(err, session.ErrDraining) {
+		retryLater(w, "Failed to create session: "+err.Error())
+		return
+	}
+	if errors.Is(err, session.ErrTooManySessions) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	requestLogger(r).Error("Failed to create session", "error", err)
+	http.Error(w, "Failed to create session: "+err.Error(), http.StatusInternalServerError)
+}
+
+// SessionSummary describes one session in the GET /pty response.
+type SessionSummary struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name,omitempty"`
+	Cols         uint16    `json:"cols"`
+	Rows         uint16    `json:"rows"`
+	Occupied     bool      `json:"occupied"`
+	ClientCount  int       `json:"clientCount"` // Including observers
+	Observers    int       `json:"observers"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Tmux         bool      `json:"tmux"`
+	Disconnected bool      `json:"disconnected"`        // Every client left; expires after the session timeout
+	Recovered    bool      `json:"recovered,omitempty"` // Adopted from tmux after a server restart
+}
+
+// listSessions returns all open sessions, oldest first. The occupied, tmux
+// and disconnected parameters each keep only the sessions whose field of
+// the same name has the given value.
+// GET /pty?occupied=true&tmux=true&disconnected=true
+func (h *Handler) listSessions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var filters []func(SessionSummary) bool
+	for _, f := range []struct {
+		name  string
+		field func(SessionSummary) bool
+	}{
+		{"occupied", func(s SessionSummary) bool { return s.Occupied }},
+		{"tmux", func(s SessionSummary) bool { return s.Tmux }},
+		{"disconnected", func(s SessionSummary) bool { return s.Disconnected }},
+	} {
+		v := q.Get(f.name)
+		if v == "" {
+			continue
+		}
+		want, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid "+f.name+" value", http.StatusBadRequest)
+			return
+		}
+		filters = append(filters, func(s SessionSummary) bool { return f.field(s) == want })
+	}
+
+	sessions := h.pool.List()
+	summaries := make([]SessionSummary, 0, len(sessions))
+	for _, sess := range sessions {
+		summary := SessionSummary{
+			ID:           sess.ID,
+			Name:         sess.Name(),
+			Cols:         sess.Cols,
+			Rows:         sess.Rows,
+			Occupied:     sess.IsOccupied(),
+			ClientCount:  sess.ClientCount(),
+			Observers:    sess.ObserverCount(),
+			CreatedAt:    sess.CreatedAt,
+			Tmux:         sess.TmuxSessionName != "",
+			Disconnected: sess.Disconnected(),
+			Recovered:    sess.Recovered(),
+		}
+		keep := true
+		for _, filter := range filters {
+			keep = keep && filter(summary)
+		}
+		if keep {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
 }
 
 type UpdateRequest struct {
@@ -105,6 +475,8 @@ type UpdateRequest struct {
 		Cols uint16 `json:"cols"`
 		Rows uint16 `json:"rows"`
 	} `json:"size,omitempty"`
+	Debug *bool   `json:"debug,omitempty"` // Toggle verbose I/O logging for this session
+	Name  *string `json:"name,omitempty"`  // Rename the session; "" removes the name
 }
 
 func (h *Handler) updateSession(w http.ResponseWriter, r *http.Request) {
@@ -117,42 +489,162 @@ func (h *Handler) updateSession(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req UpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !h.decodeBody(w, r, &req) {
 		return
 	}
+	var name string
+	if req.Name != nil {
+		var err error
+		if name, err = session.SanitizeName(*req.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	if req.Size != nil {
 		if err := sess.Resize(req.Size.Cols, req.Size.Rows); err != nil {
-			slog.Error("Failed to resize", "id", id, "error", err)
+			if errors.Is(err, session.ErrSessionClosed) {
+				http.Error(w, "Session closed", http.StatusGone)
+				return
+			}
+			requestLogger(r).Error("Failed to resize", "id", id, "error", err)
 			http.Error(w, "Failed to resize", http.StatusInternalServerError)
 			return
 		}
 	}
+	if req.Debug != nil {
+		sess.SetDebug(*req.Debug)
+	}
+	if req.Name != nil {
+		sess.SetName(name)
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// deleteSession closes a session. The optional keepTmux query parameter
+// overrides the server default for whether its tmux session is killed.
+// DELETE /pty/{id}?keepTmux=true|false
 func (h *Handler) deleteSession(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	h.pool.Remove(id)
+
+	if v := r.URL.Query().Get("keepTmux"); v != "" {
+		keepTmux, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid keepTmux value", http.StatusBadRequest)
+			return
+		}
+		h.pool.RemoveWithTmux(id, !keepTmux)
+		requestLogger(r).Info("Session deleted", "id", id, "keep_tmux", keepTmux)
+	} else {
+		h.pool.Remove(id)
+		requestLogger(r).Info("Session deleted", "id", id)
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// BulkDeleteRequest is the request body for POST /pty/bulk-delete
+type BulkDeleteRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// BulkDeleteResult reports the outcome of deleting a single session.
+type BulkDeleteResult struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkDeleteResponse is the response for POST /pty/bulk-delete
+type BulkDeleteResponse struct {
+	Results []BulkDeleteResult `json:"results"`
+}
+
+func (h *Handler) bulkDeleteSessions(w http.ResponseWriter, r *http.Request) {
+	var req BulkDeleteRequest
+	if !h.decodeBody(w, r, &req) {
+		return
+	}
+
+	results := make([]BulkDeleteResult, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		result := BulkDeleteResult{ID: id, Deleted: h.pool.Remove(id)}
+		if !result.Deleted {
+			result.Error = "Session not found"
+		}
+		results = append(results, result)
+	}
+
+	requestLogger(r).Info("Bulk delete", "requested", len(req.IDs))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BulkDeleteResponse{Results: results})
+}
+
 // SessionInfoResponse is the response for GET /pty/{id}
 type SessionInfoResponse struct {
 	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	State      string `json:"state"` // SessionStateRunning, SessionStateExited or SessionStateTmuxGone
 	Occupied   bool   `json:"occupied"`
 	ClientInfo string `json:"clientInfo,omitempty"`
-	Cols       uint16 `json:"cols"`
-	Rows       uint16 `json:"rows"`
+	Cols       uint16 `json:"cols,omitempty"`
+	Rows       uint16 `json:"rows,omitempty"`
+
+	// TmuxSessionName lets clients target the session with their own tmux
+	// client; empty for direct sessions.
+	TmuxSessionName   string `json:"tmuxSessionName,omitempty"`
+	Debug             bool   `json:"debug,omitempty"`
+	Recording         string `json:"recording,omitempty"`         // Cast file path with -record-dir
+	RecordingBytes    int64  `json:"recordingBytes,omitempty"`    // Size of the recording, over all segments
+	RecordingSegments int    `json:"recordingSegments,omitempty"` // Cast files, more than one once rotated
+
+	LastInputAt  time.Time `json:"lastInputAt,omitzero"`
+	LastOutputAt time.Time `json:"lastOutputAt,omitzero"`
+
+	// Set once the command has exited by itself
+	ExitCode   *int       `json:"exitCode,omitempty"`
+	ExitSignal string     `json:"exitSignal,omitempty"`
+	ExitedAt   *time.Time `json:"exitedAt,omitempty"`
+	OutputTail string     `json:"outputTail,omitempty"`
 }
 
+// Session states reported by GET /pty/{id}
+const (
+	SessionStateRunning  = "running"
+	SessionStateExited   = "exited"
+	SessionStateTmuxGone = "tmux-gone" // the tmux session ended, e.g. killed outside the server
+)
+
 func (h *Handler) getSession(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
 	sess, ok := h.pool.Get(id)
 	if !ok {
+		if status, exited := h.pool.Exited(id); exited && status.TmuxGone {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SessionInfoResponse{
+				ID:                id,
+				State:             SessionStateTmuxGone,
+				ExitedAt:          &status.ExitedAt,
+				Recording:         status.Recording,
+				RecordingSegments: len(status.RecordingSegments),
+			})
+			return
+		} else if exited {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SessionInfoResponse{
+				ID:                id,
+				State:             SessionStateExited,
+				ExitCode:          &status.Code,
+				ExitSignal:        status.Signal,
+				ExitedAt:          &status.ExitedAt,
+				OutputTail:        string(status.Output),
+				Recording:         status.Recording,
+				RecordingSegments: len(status.RecordingSegments),
+			})
+			return
+		}
 		http.Error(w, "Session not found", http.StatusNotFound)
 		return
 	}
@@ -160,16 +652,65 @@ func (h *Handler) getSession(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(SessionInfoResponse{
 		ID:         sess.ID,
+		Name:       sess.Name(),
+		State:      SessionStateRunning,
 		Occupied:   sess.IsOccupied(),
 		ClientInfo: sess.ConnectedClientID(),
 		Cols:       sess.Cols,
 		Rows:       sess.Rows,
+
+		TmuxSessionName:   sess.TmuxSessionName,
+		Debug:             sess.Debug(),
+		Recording:         sess.RecordingPath(),
+		RecordingBytes:    sess.RecordingSize(),
+		RecordingSegments: len(sess.RecordingSegments()),
+
+		LastInputAt:  sess.LastInputAt(),
+		LastOutputAt: sess.LastOutputAt(),
+	})
+}
+
+// SessionMetricsResponse is the response for GET /pty/{id}/metrics
+type SessionMetricsResponse struct {
+	ID             string    `json:"id"`
+	BytesIn        int64     `json:"bytesIn"`
+	BytesOut       int64     `json:"bytesOut"`
+	UptimeSeconds  float64   `json:"uptimeSeconds"`
+	ResizeCount    int64     `json:"resizeCount"`
+	ReattachCount  int64     `json:"reattachCount"`
+	PeakClients    int64     `json:"peakClients"`
+	WriteFailures  int64     `json:"writeFailures"`
+	LastActivityAt time.Time `json:"lastActivityAt"`
+}
+
+func (h *Handler) getSessionMetrics(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	sess, ok := h.pool.Get(id)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	m := sess.Metrics()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionMetricsResponse{
+		ID:             sess.ID,
+		BytesIn:        m.BytesIn,
+		BytesOut:       m.BytesOut,
+		UptimeSeconds:  m.Uptime.Seconds(),
+		ResizeCount:    m.ResizeCount,
+		ReattachCount:  m.ReattachCount,
+		PeakClients:    m.PeakClients,
+		WriteFailures:  m.WriteFailures,
+		LastActivityAt: m.LastActivityAt,
 	})
 }
 
 // TakeoverRequest is the request body for POST /pty/{id}/takeover
 type TakeoverRequest struct {
-	ClientID string `json:"clientId,omitempty"`
+	ClientID      string `json:"clientId,omitempty"`
+	DropObservers bool   `json:"dropObservers,omitempty"` // Also disconnect read-only observers
 }
 
 // TakeoverResponse is the response for POST /pty/{id}/takeover
@@ -177,6 +718,7 @@ type TakeoverResponse struct {
 	Success           bool   `json:"success"`
 	DisconnectedCount int    `json:"disconnectedCount"`
 	NewClientID       string `json:"newClientId"`
+	ReplayBytes       int64  `json:"replayBytes"` // Output history the new client is sent on connect
 }
 
 func (h *Handler) takeoverSession(w http.ResponseWriter, r *http.Request) {
@@ -188,10 +730,10 @@ func (h *Handler) takeoverSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// An empty body takes over with a generated client ID
 	var req TakeoverRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		// Allow empty body - will auto-generate client ID
-		req = TakeoverRequest{}
+	if !h.decodeOptionalBody(w, r, &req) {
+		return
 	}
 
 	// Generate client ID if not provided
@@ -200,51 +742,277 @@ func (h *Handler) takeoverSession(w http.ResponseWriter, r *http.Request) {
 		newClientID = generateClientID()
 	}
 
-	// Disconnect all current clients with takeover close code
-	disconnected := sess.DisconnectAllClients(session.CloseCode4001, "session taken over")
+	// Disconnect all current clients with takeover close code and reserve
+	// the session for the new client
+	disconnected := sess.Takeover(newClientID, session.CloseCode4001, "session taken over", req.DropObservers)
 
-	slog.Info("Session takeover", "id", id, "disconnected", disconnected, "newClientId", newClientID)
+	requestLogger(r).Info("Session takeover", "id", id, "disconnected", disconnected, "newClientId", newClientID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(TakeoverResponse{
 		Success:           true,
 		DisconnectedCount: disconnected,
 		NewClientID:       newClientID,
+		ReplayBytes:       sess.ReplayBytes(),
+	})
+}
+
+// TicketResponse is the response for POST /pty/{id}/ticket
+type TicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// createTicket issues a single-use ticket for /pty/{id}/connect?ticket=...
+func (h *Handler) createTicket(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if _, ok := h.pool.Get(id); !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	ticket, expiresAt := h.tickets.Issue(id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TicketResponse{
+		Ticket:    ticket,
+		ExpiresAt: expiresAt,
 	})
 }
 
 func (h *Handler) connectSession(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
+	log := requestLogger(r)
+	if h.pool.Draining() {
+		// New clients would only hold up the drain
+		retryLater(w, "Server is shutting down")
+		return
+	}
 
 	sess, ok := h.pool.Get(id)
+	if !ok && id != "" && id == h.defaultSessionID {
+		var err error
+		if sess, err = h.defaultSession(); err != nil {
+			writeCreateError(w, r, err)
+			return
+		}
+		ok = true
+	}
 	if !ok {
-		http.Error(w, "Session not found", http.StatusNotFound)
+		h.sessionNotFound(w, id)
+		return
+	}
+
+	// Use the client ID from a takeover if given, otherwise generate one
+	clientID := r.URL.Query().Get("clientId")
+	if clientID == "" {
+		clientID = generateClientID()
+	}
+
+	readOnly := false
+	q := r.URL.Query()
+	// readonly is accepted as an alias of readOnly
+	for _, name := range []string{"readOnly", "readonly"} {
+		if v := q.Get(name); v != "" {
+			var err error
+			if readOnly, err = strconv.ParseBool(v); err != nil {
+				http.Error(w, "Invalid "+name+" value", http.StatusBadRequest)
+				return
+			}
+			break
+		}
+	}
+
+	decision := h.authorizeConnect(r, sess)
+	if !decision.Allow {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if decision.Role == RoleViewer {
+		readOnly = true
+	}
+
+	// Observers can watch a session that a takeover reserved for a writer
+	if !readOnly && !sess.CanJoin(clientID) {
+		http.Error(w, "Session reserved by takeover", http.StatusConflict)
+		return
+	}
+	// Checked again atomically by AddClient; this answers before the upgrade
+	if !readOnly && h.pool.Config().SingleWriter && sess.IsOccupied() {
+		http.Error(w, "Session already has a writer; take it over with POST /pty/"+id+"/takeover or connect with readOnly=true", http.StatusConflict)
 		return
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if err := h.pool.AttachRecovered(sess); err != nil {
+		log.Error("Failed to attach recovered session", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, upgradeHeader(r))
 	if err != nil {
-		slog.Error("WebSocket upgrade failed", "error", err)
+		log.Error("WebSocket upgrade failed", "id", id, "error", err)
+		return
+	}
+
+	if readOnly {
+		sess.AddObserver(conn, clientID)
+	} else if err := sess.AddClient(conn, clientID); err != nil {
+		// Lost a race with a takeover or another writer since the checks above
+		code, reason := session.CloseCode4001, "session reserved by takeover"
+		if errors.Is(err, session.ErrSessionOccupied) {
+			code, reason = session.CloseCode4009, "session occupied"
+		}
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason),
+			time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+	log.Info("Client connected", "id", id, "remote", r.RemoteAddr, "clientId", clientID, "read_only", readOnly, "role", decision.Role)
+	serveClient(sess, conn, r, clientID, readOnly)
+}
+
+// defaultSession returns the well-known default session, creating it with
+// the server defaults if it doesn't exist. A tmux session left by a previous
+// server process is adopted instead, and attached by the connect.
+func (h *Handler) defaultSession() (*session.Session, error) {
+	h.defaultMu.Lock()
+	defer h.defaultMu.Unlock()
+
+	if sess, ok := h.pool.Get(h.defaultSessionID); ok {
+		return sess, nil
+	}
+	if h.pool.Config().TmuxEnabled && tmux.SessionExists(h.defaultSessionID) {
+		return h.pool.Adopt(h.defaultSessionID)
+	}
+	sess, err := h.pool.Create(session.CreateOptions{ID: h.defaultSessionID})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Created default session on connect", "id", sess.ID)
+	return sess, nil
+}
+
+// createAndConnect creates a session from query parameters and upgrades the
+// same request to a WebSocket, saving a round-trip. The first message is a
+// {"type":"session","id":...} control frame carrying the new session ID.
+// GET /pty/new/connect?cols=..&rows=..&command=..&args=..&workdir=..&profile=..
+func (h *Handler) createAndConnect(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	log := requestLogger(r)
+
+	name, err := session.SanitizeName(q.Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := session.CreateOptions{
+		Name:    name,
+		Command: q.Get("command"),
+		Args:    q["args"],
+		Workdir: q.Get("workdir"),
+		Profile: q.Get("profile"),
+	}
+	for _, dim := range []struct {
+		name string
+		dst  *uint16
+	}{
+		{"cols", &opts.Cols},
+		{"rows", &opts.Rows},
+	} {
+		v := q.Get(dim.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || n == 0 {
+			http.Error(w, "Invalid "+dim.name+" value", http.StatusBadRequest)
+			return
+		}
+		*dim.dst = uint16(n)
+	}
+
+	sess, err := h.pool.Create(opts)
+	if err != nil {
+		writeCreateError(w, r, err)
+		return
+	}
+
+	decision := h.authorizeConnect(r, sess)
+	if !decision.Allow {
+		h.pool.Remove(sess.ID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, upgradeHeader(r))
+	if err != nil {
+		log.Error("WebSocket upgrade failed", "id", sess.ID, "error", err)
+		h.pool.Remove(sess.ID)
+		return
+	}
+
+	// Sent before the client joins the broadcast, so it is always first
+	payload, _ := json.Marshal(session.ControlMessage{Type: session.ControlTypeSession, ID: sess.ID, Cols: sess.Cols, Rows: sess.Rows})
+	conn.SetWriteDeadline(time.Now().Add(sess.WriteTimeout()))
+	if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+		conn.Close()
+		h.pool.Remove(sess.ID)
 		return
 	}
 
-	// Generate a unique client ID for this connection
 	clientID := generateClientID()
+	readOnly := decision.Role == RoleViewer
+	if readOnly {
+		sess.AddObserver(conn, clientID)
+	} else if err := sess.AddClient(conn, clientID); err != nil {
+		log.Error("Failed to attach client to new session", "id", sess.ID, "error", err)
+		conn.Close()
+		h.pool.Remove(sess.ID)
+		return
+	}
+	log.Info("Client connected", "id", sess.ID, "remote", r.RemoteAddr, "clientId", clientID, "read_only", readOnly, "role", decision.Role)
+	serveClient(sess, conn, r, clientID, readOnly)
+}
 
-	slog.Info("Client connected", "id", id, "remote", r.RemoteAddr, "clientId", clientID)
-	sess.AddClient(conn, clientID)
+// authorizeConnect runs the connect hook, allowing everything if none is set.
+func (h *Handler) authorizeConnect(r *http.Request, sess *session.Session) ConnectDecision {
+	if h.connectHook == nil {
+		return ConnectDecision{Allow: true}
+	}
+	decision := h.connectHook(r, sess)
+	if !decision.Allow {
+		requestLogger(r).Warn("Connect denied by hook", "id", sess.ID, "remote", r.RemoteAddr)
+	}
+	return decision
+}
 
+// serveClient pumps input from a connected client into the session until the
+// connection or the session closes. Input from read-only clients is dropped.
+func serveClient(sess *session.Session, conn *websocket.Conn, r *http.Request, clientID string, readOnly bool) {
+	id := sess.ID
 	defer func() {
 		sess.RemoveClient(conn)
 		conn.Close()
-		slog.Info("Client disconnected", "id", id, "remote", r.RemoteAddr, "clientId", clientID)
+		requestLogger(r).Info("Client disconnected", "id", id, "remote", r.RemoteAddr, "clientId", clientID)
 	}()
 
 	for {
-		_, data, err := conn.ReadMessage()
+		messageType, data, err := conn.ReadMessage()
 		if err != nil {
 			return
 		}
+		if readOnly {
+			continue
+		}
+		if msg, ok := session.ParseClientControl(messageType, data); ok {
+			if err := handleClientControl(sess, conn, clientID, msg); errors.Is(err, session.ErrSessionClosed) {
+				return
+			}
+			continue
+		}
 		// Update activity on write
 		sess.UpdateActivity()
 		if err := sess.Write(data); err != nil {
@@ -253,6 +1021,294 @@ func (h *Handler) connectSession(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleClientControl applies a control message sent by the client with
+// clientID on conn. Unknown and malformed messages are ignored.
+func handleClientControl(sess *session.Session, conn *websocket.Conn, clientID string, msg session.ControlMessage) error {
+	switch msg.Type {
+	case session.ControlTypeResize:
+		if msg.Cols == 0 || msg.Rows == 0 {
+			return nil
+		}
+		if err := sess.Resize(msg.Cols, msg.Rows); err != nil {
+			if !errors.Is(err, session.ErrSessionClosed) {
+				slog.Error("Failed to resize", "id", sess.ID, "error", err)
+			}
+			return err
+		}
+	case session.ControlTypeEOF:
+		sess.UpdateActivity()
+		if err := sess.SendEOF(); err != nil {
+			if !errors.Is(err, session.ErrSessionClosed) {
+				slog.Error("Failed to send EOF", "id", sess.ID, "error", err)
+			}
+			return err
+		}
+	case session.ControlTypePaste:
+		if msg.Data == "" {
+			return nil
+		}
+		sess.UpdateActivity()
+		if err := sess.Paste(msg.Data); err != nil {
+			if !errors.Is(err, session.ErrSessionClosed) {
+				slog.Error("Failed to paste", "id", sess.ID, "error", err)
+			}
+			return err
+		}
+	case session.ControlTypeInput:
+		if msg.Seq == 0 {
+			return nil
+		}
+		sess.UpdateActivity()
+		if err := sess.WriteSequenced(conn, clientID, msg.Seq, []byte(msg.Data)); err != nil {
+			if !errors.Is(err, session.ErrSessionClosed) {
+				slog.Error("Failed to write input", "id", sess.ID, "error", err)
+			}
+			return err
+		}
+	default:
+		slog.Debug("Ignoring unknown control message", "id", sess.ID, "type", msg.Type)
+	}
+	return nil
+}
+
+// SignalRequest is the request body for POST /pty/{id}/signal
+type SignalRequest struct {
+	Signal string `json:"signal"`
+}
+
+// signalSession delivers a signal to a session's command, e.g. to stop a
+// hung foreground job that ignores Ctrl-C.
+// POST /pty/{id}/signal
+func (h *Handler) signalSession(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	sess, ok := h.pool.Get(id)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	var req SignalRequest
+	if !h.decodeBody(w, r, &req) {
+		return
+	}
+
+	if err := sess.Signal(req.Signal); err != nil {
+		switch {
+		case errors.Is(err, session.ErrUnknownSignal):
+			http.Error(w, "Unknown signal: "+req.Signal, http.StatusBadRequest)
+		case errors.Is(err, session.ErrSessionClosed):
+			http.Error(w, "Session not found", http.StatusNotFound)
+		default:
+			requestLogger(r).Error("Failed to signal session", "id", id, "signal", req.Signal, "error", err)
+			http.Error(w, "Failed to send signal", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	requestLogger(r).Info("Signal sent", "id", id, "signal", req.Signal)
+	w.WriteHeader(http.StatusOK)
+}
+
+// ExecRequest is the request body for POST /pty/{id}/exec
+type ExecRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Workdir string   `json:"workdir,omitempty"` // Defaults to the current command's workdir
+
+	Env map[string]string `json:"env,omitempty"` // Merged over the current command's environment
+}
+
+// execSession replaces a session's command with another in the same
+// terminal, e.g. to open a file in an editor without a new session.
+// POST /pty/{id}/exec
+func (h *Handler) execSession(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	sess, ok := h.pool.Get(id)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	var req ExecRequest
+	if !h.decodeBody(w, r, &req) {
+		return
+	}
+	if req.Command == "" {
+		http.Error(w, "command is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.pool.CheckCommand(req.Command); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := h.pool.ValidateArgs(req.Args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := session.ValidateEnv(req.Env); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	workdir, err := h.pool.ResolveWorkdir(req.Workdir)
+	if err != nil {
+		if errors.Is(err, session.ErrInvalidWorkdir) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requestLogger(r).Error("Failed to resolve workdir", "id", id, "workdir", req.Workdir, "error", err)
+		http.Error(w, "Failed to exec command: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = sess.Exec(session.ExecOptions{
+		Command: req.Command,
+		Args:    req.Args,
+		Workdir: workdir,
+		Env:     req.Env,
+	})
+	if err != nil {
+		if errors.Is(err, session.ErrSessionClosed) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, session.ErrResourcesExhausted) {
+			retryLater(w, "Failed to exec command: "+err.Error())
+			return
+		}
+		requestLogger(r).Error("Failed to exec command", "id", id, "command", req.Command, "error", err)
+		http.Error(w, "Failed to exec command: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// TmuxSessionSummary is an entry of the response for GET /pty/tmux
+type TmuxSessionSummary struct {
+	ID             string    `json:"id"`
+	Tracked        bool      `json:"tracked"`     // In the pool; untracked sessions are adopted on reattach
+	Attached       bool      `json:"attached"`    // The server holds a PTY on it, so reattach is unnecessary
+	TmuxClients    int       `json:"tmuxClients"` // tmux clients attached, including the server's own
+	LastActivityAt time.Time `json:"lastActivityAt"`
+}
+
+// listTmuxSessions lists the server's tmux sessions, including ones the pool
+// doesn't track, so a UI can offer detached terminals to resume.
+// GET /pty/tmux
+func (h *Handler) listTmuxSessions(w http.ResponseWriter, r *http.Request) {
+	summaries := []TmuxSessionSummary{}
+	if h.pool.Config().TmuxEnabled {
+		names, err := h.pool.TmuxSessions()
+		if err != nil {
+			requestLogger(r).Error("Failed to list tmux sessions", "error", err)
+			http.Error(w, "Failed to list tmux sessions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, name := range names {
+			summary := TmuxSessionSummary{ID: name, TmuxClients: tmux.GetSessionClientCount(name)}
+			if summary.TmuxClients < 0 {
+				continue // ended since it was listed
+			}
+			if sess, ok := h.pool.Get(name); ok {
+				summary.Tracked = true
+				summary.Attached = sess.Attached()
+			}
+			if activity, err := tmux.SessionActivity(name); err == nil {
+				summary.LastActivityAt = activity
+			}
+			summaries = append(summaries, summary)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+// ReattachRequest is the request body for POST /pty/{id}/reattach
+type ReattachRequest struct {
+	Cols uint16 `json:"cols,omitempty"` // Defaults to the session's last known size
+	Rows uint16 `json:"rows,omitempty"`
+}
+
+// reattachSession attaches the server to a tmux session it holds no PTY on,
+// adopting it into the pool first if it isn't tracked. Clients then connect
+// as usual.
+// POST /pty/{id}/reattach
+func (h *Handler) reattachSession(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req ReattachRequest
+	if !h.decodeBody(w, r, &req) {
+		return
+	}
+
+	sess, ok := h.pool.Get(id)
+	if !ok {
+		var err error
+		if sess, err = h.pool.Adopt(id); err != nil {
+			if errors.Is(err, session.ErrTmuxSessionGone) || errors.Is(err, session.ErrNotTmux) {
+				h.sessionNotFound(w, id)
+				return
+			}
+			requestLogger(r).Error("Failed to adopt tmux session", "id", id, "error", err)
+			http.Error(w, "Failed to reattach: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.pool.Reattach(sess, req.Cols, req.Rows); err != nil {
+		switch {
+		case errors.Is(err, session.ErrAlreadyAttached):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, session.ErrTmuxSessionGone):
+			http.Error(w, err.Error(), http.StatusGone)
+		case errors.Is(err, session.ErrNotTmux):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, session.ErrSessionClosed):
+			http.Error(w, "Session not found", http.StatusNotFound)
+		default:
+			requestLogger(r).Error("Failed to reattach", "id", id, "error", err)
+			http.Error(w, "Failed to reattach: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CreateResponse{
+		ID:      sess.ID,
+		Command: sess.Command,
+		Cols:    sess.Cols,
+		Rows:    sess.Rows,
+	})
+}
+
+// refreshSession forces connected clients to repaint, e.g. after their
+// display got corrupted.
+// POST /pty/{id}/refresh
+func (h *Handler) refreshSession(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	sess, ok := h.pool.Get(id)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := sess.Refresh(); err != nil {
+		if errors.Is(err, session.ErrSessionClosed) {
+			http.Error(w, "Session closed", http.StatusGone)
+			return
+		}
+		requestLogger(r).Error("Failed to refresh", "id", id, "error", err)
+		http.Error(w, "Failed to refresh: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 // getScrollback returns the scrollback buffer of a tmux session.
 // GET /pty/{id}/scrollback?lines=1000
 func (h *Handler) getScrollback(w http.ResponseWriter, r *http.Request) {
@@ -280,12 +1336,173 @@ func (h *Handler) getScrollback(w http.ResponseWriter, r *http.Request) {
 
 	output, err := tmux.CapturePane(sess.TmuxSessionName, lines)
 	if err != nil {
-		slog.Error("Failed to capture scrollback", "id", id, "error", err)
+		requestLogger(r).Error("Failed to capture scrollback", "id", id, "error", err)
 		http.Error(w, "Failed to capture scrollback: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Return plain text with ANSI codes preserved
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Write([]byte(output))
+	w.Write(sess.Redact([]byte(output)))
+}
+
+// getRecording downloads a session's recording as an asciinema v2 cast,
+// joining the segments of a rotated recording into one, or only the
+// segment numbered from 0 with segment=N. Recordings of sessions whose
+// exit status is still kept can be downloaded too.
+// GET /pty/{id}/recording?segment=N
+func (h *Handler) getRecording(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var segments []string
+	if sess, ok := h.pool.Get(id); ok {
+		segments = sess.RecordingSegments()
+	} else if status, exited := h.pool.Exited(id); exited {
+		segments = status.RecordingSegments
+	} else {
+		h.sessionNotFound(w, id)
+		return
+	}
+	if len(segments) == 0 {
+		http.Error(w, session.ErrNoRecording.Error(), http.StatusNotFound)
+		return
+	}
+
+	if v := r.URL.Query().Get("segment"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid segment value", http.StatusBadRequest)
+			return
+		}
+		if n >= len(segments) {
+			http.Error(w, "Recording has "+strconv.Itoa(len(segments))+" segments", http.StatusNotFound)
+			return
+		}
+		segments = segments[n : n+1]
+	}
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	var err error
+	if len(segments) == 1 {
+		// A single segment, or the only one, is served as stored
+		err = h.pool.CopyRecordingSegment(w, segments[0])
+	} else {
+		err = h.pool.CopyRecording(w, segments)
+	}
+	if err != nil {
+		requestLogger(r).Error("Failed to copy recording", "id", id, "error", err)
+	}
+}
+
+// getBuffer returns the current screen contents as text with escape
+// sequences, or without them with plain=true, e.g. for previews rendered
+// without opening a WebSocket.
+// GET /pty/{id}/buffer?plain=true
+func (h *Handler) getBuffer(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	plain := false
+	if v := r.URL.Query().Get("plain"); v != "" {
+		var err error
+		if plain, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid plain value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sess, ok := h.pool.Get(id)
+	if !ok {
+		h.sessionNotFound(w, id)
+		return
+	}
+
+	screen, err := sess.Screen()
+	if err != nil {
+		if errors.Is(err, session.ErrNoHistory) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		requestLogger(r).Error("Failed to read screen", "id", id, "error", err)
+		http.Error(w, "Failed to read screen: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if plain {
+		screen = stripEscapes(screen)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(screen)
+}
+
+// getOptions returns the whitelisted tmux options of a tmux session.
+// GET /pty/{id}/options
+func (h *Handler) getOptions(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	sess, ok := h.pool.Get(id)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if sess.TmuxSessionName == "" {
+		http.Error(w, "Session is not a tmux session", http.StatusBadRequest)
+		return
+	}
+
+	options := make(map[string]string)
+	for _, name := range tmux.AllowedOptions() {
+		value, err := tmux.ShowOption(sess.TmuxSessionName, name)
+		if err != nil {
+			requestLogger(r).Error("Failed to read tmux option", "id", id, "option", name, "error", err)
+			http.Error(w, "Failed to read tmux options: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		options[name] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+// setOptions sets whitelisted tmux options on a tmux session. The body maps
+// option names to values, e.g. {"mouse":"on","history-limit":"50000"}.
+// PUT /pty/{id}/options
+func (h *Handler) setOptions(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	sess, ok := h.pool.Get(id)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if sess.TmuxSessionName == "" {
+		http.Error(w, "Session is not a tmux session", http.StatusBadRequest)
+		return
+	}
+
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate everything up front so a bad entry doesn't leave a partial update
+	for name, value := range req {
+		if err := tmux.ValidateOption(name, value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	for name, value := range req {
+		if err := tmux.SetOption(sess.TmuxSessionName, name, value); err != nil {
+			requestLogger(r).Error("Failed to set tmux option", "id", id, "option", name, "error", err)
+			http.Error(w, "Failed to set tmux option: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,981 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/itsmylife44/terminus-pty/internal/auth"
+	"github.com/itsmylife44/terminus-pty/internal/session"
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
+)
+
+// testServer serves a handler over a pool of sh sessions without auth.
+func testServer(t *testing.T, config session.PoolConfig) (*httptest.Server, *session.Pool) {
+	t.Helper()
+	return testServerOptions(t, config, Options{})
+}
+
+// testServerOptions is testServer with handler options.
+func testServerOptions(t *testing.T, config session.PoolConfig, opts Options) (*httptest.Server, *session.Pool) {
+	t.Helper()
+	if config.DefaultCommand == "" {
+		config.DefaultCommand = "/bin/sh"
+	}
+	if config.SessionTimeout == 0 {
+		config.SessionTimeout = time.Minute
+	}
+	pool := session.NewPool(config)
+	srv := httptest.NewServer(NewHandler(pool, nil, opts))
+	t.Cleanup(func() {
+		srv.Close()
+		pool.CloseAll()
+	})
+	return srv, pool
+}
+
+// privateTmux skips the test without tmux, and otherwise points tmux at a
+// private server, so the test leaves the user's alone.
+func privateTmux(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	// Inside tmux, $TMUX would name the server regardless of TMUX_TMPDIR
+	t.Setenv("TMUX", "")
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	t.Cleanup(func() { exec.Command("tmux", "kill-server").Run() })
+}
+
+// dial opens a WebSocket to path on srv.
+func dial(t *testing.T, srv *httptest.Server, path string) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, nil)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial %s: %v (status %d)", path, err, status)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitFor polls cond until it holds or a few seconds passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListSessionsFilters(t *testing.T) {
+	config := session.PoolConfig{}
+	withTmux := false
+	if _, err := exec.LookPath("tmux"); err == nil {
+		// A private tmux server, so the test leaves the user's alone. Inside
+		// tmux, $TMUX would name the server regardless of TMUX_TMPDIR.
+		t.Setenv("TMUX", "")
+		t.Setenv("TMUX_TMPDIR", t.TempDir())
+		t.Cleanup(func() { exec.Command("tmux", "kill-server").Run() })
+		yes := true
+		config.Profiles = map[string]session.Profile{"tmux": {Tmux: &yes}}
+		withTmux = true
+	}
+	srv, pool := testServer(t, config)
+
+	create := func(opts session.CreateOptions) string {
+		t.Helper()
+		sess, err := pool.Create(opts)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		return sess.ID
+	}
+	// Never connected
+	idle := create(session.CreateOptions{})
+	// A client attached
+	occupied := create(session.CreateOptions{})
+	dial(t, srv, "/pty/"+occupied+"/connect")
+	// A client attached and left
+	left := create(session.CreateOptions{})
+	dial(t, srv, "/pty/"+left+"/connect").Close()
+	waitFor(t, "the client to leave", func() bool {
+		sess, _ := pool.Get(left)
+		return sess.Disconnected()
+	})
+	var inTmux string
+	if withTmux {
+		inTmux = create(session.CreateOptions{Profile: "tmux"})
+	}
+	waitFor(t, "the client to join", func() bool {
+		sess, _ := pool.Get(occupied)
+		return sess.IsOccupied()
+	})
+
+	all := []string{idle, occupied, left}
+	direct := []string{idle, occupied, left}
+	if withTmux {
+		all = append(all, inTmux)
+	}
+	tmuxOnly := []string{}
+	if withTmux {
+		tmuxOnly = []string{inTmux}
+	}
+	notDisconnected := []string{idle, occupied}
+	if withTmux {
+		notDisconnected = append(notDisconnected, inTmux)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", all},
+		{"?occupied=true", []string{occupied}},
+		{"?occupied=false", slices.DeleteFunc(slices.Clone(all), func(id string) bool { return id == occupied })},
+		{"?tmux=true", tmuxOnly},
+		{"?tmux=false", direct},
+		{"?disconnected=true", []string{left}},
+		{"?disconnected=false", notDisconnected},
+		{"?occupied=true&tmux=false", []string{occupied}},
+		{"?occupied=true&tmux=true", []string{}},
+		{"?occupied=true&disconnected=true", []string{}},
+		{"?occupied=false&disconnected=true", []string{left}},
+		{"?occupied=false&disconnected=false", slices.DeleteFunc(slices.Clone(notDisconnected), func(id string) bool { return id == occupied })},
+		{"?tmux=false&disconnected=true", []string{left}},
+		{"?tmux=true&disconnected=false", tmuxOnly},
+		{"?occupied=false&tmux=false&disconnected=false", []string{idle}},
+		{"?occupied=false&tmux=true&disconnected=false", tmuxOnly},
+		{"?occupied=true&tmux=true&disconnected=true", []string{}},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + "/pty" + tt.query)
+		if err != nil {
+			t.Fatalf("GET /pty%s: %v", tt.query, err)
+		}
+		var summaries []SessionSummary
+		err = json.NewDecoder(resp.Body).Decode(&summaries)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("GET /pty%s: decode: %v", tt.query, err)
+		}
+		got := []string{}
+		for _, s := range summaries {
+			got = append(got, s.ID)
+		}
+		slices.Sort(got)
+		want := slices.Sorted(slices.Values(tt.want))
+		if !slices.Equal(got, want) {
+			t.Errorf("GET /pty%s = %q, want %q", tt.query, got, want)
+		}
+	}
+}
+
+func TestListSessionsInvalidFilter(t *testing.T) {
+	srv, _ := testServer(t, session.PoolConfig{})
+	for _, query := range []string{"?occupied=maybe", "?tmux=2", "?disconnected=x"} {
+		resp, err := http.Get(srv.URL + "/pty" + query)
+		if err != nil {
+			t.Fatalf("GET /pty%s: %v", query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET /pty%s = %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestCreateAndConnect(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{})
+	conn := dial(t, srv, "/pty/new/connect?cols=100&rows=30&command=/bin/sh")
+
+	// The first frame names the session created for this connection
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	kind, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var msg session.ControlMessage
+	if kind != websocket.TextMessage || json.Unmarshal(data, &msg) != nil || msg.Type != session.ControlTypeSession {
+		t.Fatalf("first frame = %q, want a session message", data)
+	}
+	if msg.Cols != 100 || msg.Rows != 30 {
+		t.Errorf("session size = %dx%d, want 100x30", msg.Cols, msg.Rows)
+	}
+	sess, ok := pool.Get(msg.ID)
+	if !ok {
+		t.Fatalf("session %q not in the pool", msg.ID)
+	}
+	waitFor(t, "the client to join", sess.IsOccupied)
+
+	// The same connection streams the session
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("echo streamed-$((6*7))\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var out strings.Builder
+	for !strings.Contains(out.String(), "streamed-42") {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v (output so far %q)", err, out.String())
+		}
+		if kind == websocket.BinaryMessage {
+			out.Write(data)
+		}
+	}
+	if n := len(pool.List()); n != 1 {
+		t.Errorf("pool has %d sessions, want 1", n)
+	}
+}
+
+func TestCreateAndConnectViewer(t *testing.T) {
+	viewer := func(r *http.Request, sess *session.Session) ConnectDecision {
+		return ConnectDecision{Allow: true, Role: RoleViewer}
+	}
+	srv, pool := testServerOptions(t, session.PoolConfig{SingleWriter: true}, Options{ConnectHook: viewer})
+	conn := dial(t, srv, "/pty/new/connect")
+	sess, ok := pool.Get(readControl(t, conn, session.ControlTypeSession).ID)
+	if !ok {
+		t.Fatal("created session not in the pool")
+	}
+	waitFor(t, "the viewer to join", func() bool { return sess.ObserverCount() == 1 })
+	if sess.IsOccupied() {
+		t.Error("viewer joined as a writer")
+	}
+}
+
+func TestCreateAndConnectErrors(t *testing.T) {
+	srv, _ := testServerOptions(t, session.PoolConfig{AllowedCommands: []string{"/bin/sh"}}, Options{})
+	for path, want := range map[string]int{
+		"/pty/new/connect?profile=missing":       http.StatusBadRequest,
+		"/pty/new/connect?command=/bin/cat":      http.StatusForbidden,
+		"/pty/new/connect?workdir=/no/such/dir/": http.StatusBadRequest,
+	} {
+		_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, nil)
+		if err == nil {
+			t.Errorf("dial %s succeeded, want status %d", path, want)
+			continue
+		}
+		if resp == nil || resp.StatusCode != want {
+			t.Errorf("dial %s: %v, want status %d", path, err, want)
+		}
+	}
+}
+
+// readControl reads frames from conn until a control message of type typ,
+// skipping output and other control messages.
+func readControl(t *testing.T, conn *websocket.Conn, typ string) session.ControlMessage {
+	t.Helper()
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		var msg session.ControlMessage
+		if kind == websocket.TextMessage && json.Unmarshal(data, &msg) == nil && msg.Type == typ {
+			return msg
+		}
+	}
+}
+
+// sendControl sends msg to the server as a client control message.
+func sendControl(t *testing.T, conn *websocket.Conn, msg session.ControlMessage) {
+	t.Helper()
+	payload, _ := json.Marshal(msg)
+	if err := conn.WriteMessage(websocket.TextMessage, append([]byte{session.ControlPrefix}, payload...)); err != nil {
+		t.Fatalf("send %s: %v", msg.Type, err)
+	}
+}
+
+func TestSequencedInputAcrossReconnect(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{InputReplayWindow: time.Minute})
+	sess, err := pool.Create(session.CreateOptions{Command: "/bin/cat"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	input := func(seq uint64, data string) session.ControlMessage {
+		return session.ControlMessage{Type: session.ControlTypeInput, Seq: seq, Data: data}
+	}
+
+	conn := dial(t, srv, "/pty/"+sess.ID+"/connect")
+	ready := readControl(t, conn, session.ControlTypeReady)
+	if ready.ClientID == "" || ready.Seq != 0 {
+		t.Fatalf("first ready = %+v, want a client ID and no input yet", ready)
+	}
+	sendControl(t, conn, input(1, "one "))
+	sendControl(t, conn, input(2, "two "))
+	if ack := readControl(t, conn, session.ControlTypeInputAck); ack.Seq != 1 {
+		t.Fatalf("ack = %d, want 1", ack.Seq)
+	}
+	if ack := readControl(t, conn, session.ControlTypeInputAck); ack.Seq != 2 {
+		t.Fatalf("ack = %d, want 2", ack.Seq)
+	}
+	// Input 3 is sent as the connection drops; the client can't tell
+	// whether it arrived
+	sendControl(t, conn, input(3, "three "))
+	conn.Close()
+	waitFor(t, "the client to leave", sess.Disconnected)
+
+	// The reconnected client learns what was written, resends the rest and
+	// carries on
+	conn = dial(t, srv, "/pty/"+sess.ID+"/connect?clientId="+ready.ClientID)
+	resumed := readControl(t, conn, session.ControlTypeReady)
+	if resumed.ClientID != ready.ClientID {
+		t.Errorf("resumed client ID = %q, want %q", resumed.ClientID, ready.ClientID)
+	}
+	if resumed.Seq != 2 && resumed.Seq != 3 {
+		t.Fatalf("resumed ready seq = %d, want 2 or 3", resumed.Seq)
+	}
+	for seq := resumed.Seq + 1; seq <= 3; seq++ {
+		sendControl(t, conn, input(seq, "three "))
+	}
+	// A resend of acknowledged input isn't written again
+	sendControl(t, conn, input(2, "two "))
+	sendControl(t, conn, input(4, "four"))
+	for acked := uint64(0); acked < 4; {
+		ack := readControl(t, conn, session.ControlTypeInputAck)
+		if ack.Seq < 3 || ack.Seq < acked {
+			t.Fatalf("ack = %d after %d, want 3 or 4 in order", ack.Seq, acked)
+		}
+		acked = ack.Seq
+	}
+	if got := sess.Metrics().BytesIn; got != int64(len("one two three four")) {
+		t.Errorf("wrote %d bytes of input, want each input once", got)
+	}
+
+	// A client ID the server doesn't know gets no sequence number
+	other := dial(t, srv, "/pty/"+sess.ID+"/connect?clientId=stranger")
+	if ready := readControl(t, other, session.ControlTypeReady); ready.Seq != 0 {
+		t.Errorf("unknown client's ready seq = %d, want 0", ready.Seq)
+	}
+}
+
+func TestSequencedInputForgottenAfterWindow(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{InputReplayWindow: 50 * time.Millisecond})
+	sess, err := pool.Create(session.CreateOptions{Command: "/bin/cat"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	conn := dial(t, srv, "/pty/"+sess.ID+"/connect?clientId=flaky")
+	readControl(t, conn, session.ControlTypeReady)
+	sendControl(t, conn, session.ControlMessage{Type: session.ControlTypeInput, Seq: 1, Data: "x"})
+	readControl(t, conn, session.ControlTypeInputAck)
+	conn.Close()
+	waitFor(t, "the client to leave", sess.Disconnected)
+	time.Sleep(100 * time.Millisecond)
+
+	conn = dial(t, srv, "/pty/"+sess.ID+"/connect?clientId=flaky")
+	if ready := readControl(t, conn, session.ControlTypeReady); ready.Seq != 0 {
+		t.Errorf("ready seq after the window = %d, want 0", ready.Seq)
+	}
+}
+
+func TestCreateRejectsInjectedVars(t *testing.T) {
+	host, _ := session.CompileVar("host", `[A-Za-z0-9.-]+`)
+	srv, pool := testServer(t, session.PoolConfig{Profiles: map[string]session.Profile{
+		"ping": {Command: "/bin/echo", Args: []string{"ping", "{host}"}, Vars: map[string]*regexp.Regexp{"host": host}},
+	}})
+
+	post := func(body string) *http.Response {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/pty", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST /pty: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := post(`{"profile": "ping", "vars": {"host": "example.com"}}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("valid vars: status %d, want 200", resp.StatusCode)
+	}
+	for _, body := range []string{
+		`{"profile": "ping", "vars": {"host": "example.com; cat /etc/passwd"}}`,
+		`{"profile": "ping", "vars": {"host": "-f"}}`,
+		`{"profile": "ping", "vars": {"host": "example.com", "cmd": "sh"}}`,
+		`{"profile": "ping"}`,
+	} {
+		if resp := post(body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST %s: status %d, want 400", body, resp.StatusCode)
+		}
+	}
+	if n := pool.Count(); n != 1 {
+		t.Errorf("pool has %d sessions, want only the valid one", n)
+	}
+}
+
+func TestCapabilitiesRecording(t *testing.T) {
+	for _, record := range []bool{false, true} {
+		config := session.PoolConfig{}
+		if record {
+			config.RecordDir = t.TempDir()
+		}
+		srv, _ := testServer(t, config)
+		resp, err := http.Get(srv.URL + "/capabilities")
+		if err != nil {
+			t.Fatalf("GET /capabilities: %v", err)
+		}
+		var caps CapabilitiesResponse
+		err = json.NewDecoder(resp.Body).Decode(&caps)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("decoding capabilities: %v", err)
+		}
+		if caps.Recording != record {
+			t.Errorf("recording = %v with RecordDir %q, want %v", caps.Recording, config.RecordDir, record)
+		}
+	}
+}
+
+func TestCapabilitiesReflectConfig(t *testing.T) {
+	get := func(handler http.Handler) CapabilitiesResponse {
+		t.Helper()
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+		req, _ := http.NewRequest("GET", srv.URL+"/capabilities", nil)
+		req.SetBasicAuth("admin", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /capabilities: %v", err)
+		}
+		defer resp.Body.Close()
+		var caps CapabilitiesResponse
+		if err := json.NewDecoder(resp.Body).Decode(&caps); err != nil {
+			t.Fatalf("decoding capabilities (status %d): %v", resp.StatusCode, err)
+		}
+		return caps
+	}
+
+	plain := session.NewPool(session.PoolConfig{})
+	t.Cleanup(plain.CloseAll)
+	caps := get(NewHandler(plain, nil, Options{}))
+	if caps.Tmux || !caps.Spool || caps.BellEvents || caps.Redaction || caps.Recording || caps.Auth != "none" || caps.TmuxOptions != nil {
+		t.Errorf("defaults: %+v", caps)
+	}
+
+	full := session.NewPool(session.PoolConfig{
+		TmuxEnabled:    true,
+		BellEvents:     true,
+		RedactPatterns: []*regexp.Regexp{regexp.MustCompile(`secret`)},
+		RecordDir:      t.TempDir(),
+	})
+	t.Cleanup(full.CloseAll)
+	caps = get(NewHandler(full, auth.NewBasicAuth("admin", "secret"), Options{}))
+	if !caps.Tmux || caps.Spool || !caps.BellEvents || !caps.Redaction || !caps.Recording || caps.Auth != "basic" {
+		t.Errorf("everything enabled: %+v", caps)
+	}
+	if !slices.Equal(caps.TmuxOptions, tmux.AllowedOptions()) {
+		t.Errorf("tmux options = %q, want %q", caps.TmuxOptions, tmux.AllowedOptions())
+	}
+}
+
+func TestStrictJSONRejectsUnknownFields(t *testing.T) {
+	srv, pool := testServerOptions(t, session.PoolConfig{}, Options{StrictJSON: true})
+	sess, err := pool.Create(session.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	post := func(path, body string) *http.Response {
+		t.Helper()
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	takeover := "/pty/" + sess.ID + "/takeover"
+	for _, tc := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/pty", `{"cols": 80, "colums": 100}`, http.StatusBadRequest},
+		{takeover, `{"client": "typo"}`, http.StatusBadRequest},
+		{takeover, `{"clientId": `, http.StatusBadRequest},
+		{takeover, ``, http.StatusOK},
+		{takeover, `{"clientId": "next"}`, http.StatusOK},
+	} {
+		if resp := post(tc.path, tc.body); resp.StatusCode != tc.want {
+			t.Errorf("POST %s %q: status %d, want %d", tc.path, tc.body, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestBulkDeleteReport(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{})
+	var ids []string
+	for i := 0; i < 2; i++ {
+		sess, err := pool.Create(session.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids = append(ids, sess.ID)
+	}
+	body, _ := json.Marshal(BulkDeleteRequest{IDs: []string{ids[0], "pty_missing", ids[1]}})
+	resp, err := http.Post(srv.URL+"/pty/bulk-delete", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("POST /pty/bulk-delete: %v", err)
+	}
+	defer resp.Body.Close()
+	var report BulkDeleteResponse
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("decoding report: %v", err)
+	}
+
+	want := []BulkDeleteResult{
+		{ID: ids[0], Deleted: true},
+		{ID: "pty_missing", Error: "Session not found"},
+		{ID: ids[1], Deleted: true},
+	}
+	if !slices.Equal(report.Results, want) {
+		t.Errorf("results = %+v, want %+v", report.Results, want)
+	}
+	if n := pool.Count(); n != 0 {
+		t.Errorf("pool has %d sessions after deleting all, want 0", n)
+	}
+}
+
+func TestConnectHookDeniesOneSession(t *testing.T) {
+	var denied string
+	hook := func(r *http.Request, sess *session.Session) ConnectDecision {
+		return ConnectDecision{Allow: sess.ID != denied}
+	}
+	srv, pool := testServerOptions(t, session.PoolConfig{}, Options{ConnectHook: hook})
+	secret, err := pool.Create(session.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	open, err := pool.Create(session.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	denied = secret.ID
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/pty/"+secret.ID+"/connect", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("connect to the denied session: %v, want status 403", err)
+	}
+	if secret.ClientCount() != 0 {
+		t.Error("denied client was attached")
+	}
+	dial(t, srv, "/pty/"+open.ID+"/connect")
+	waitFor(t, "the allowed client to join", open.IsOccupied)
+}
+
+func TestReadOnlyInputIgnored(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{})
+	sess, err := pool.Create(session.CreateOptions{Command: "/bin/cat"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	viewer := dial(t, srv, "/pty/"+sess.ID+"/connect?readOnly=true")
+	readControl(t, viewer, session.ControlTypeReady)
+	viewer.WriteMessage(websocket.TextMessage, []byte("from-viewer\n"))
+	sendControl(t, viewer, session.ControlMessage{Type: session.ControlTypeResize, Cols: 50, Rows: 10})
+
+	// Input from a writer after the viewer's is echoed; the viewer's never
+	// arrives
+	writer := dial(t, srv, "/pty/"+sess.ID+"/connect")
+	readControl(t, writer, session.ControlTypeReady)
+	writer.WriteMessage(websocket.TextMessage, []byte("from-writer\n"))
+	var out strings.Builder
+	for !strings.Contains(out.String(), "from-writer") {
+		writer.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, data, err := writer.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v (output so far %q)", err, out.String())
+		}
+		if kind == websocket.BinaryMessage {
+			out.Write(data)
+		}
+	}
+	if strings.Contains(out.String(), "from-viewer") {
+		t.Error("read-only client's input reached the session")
+	}
+	m := sess.Metrics()
+	if m.BytesIn != int64(len("from-writer\n")) {
+		t.Errorf("session got %d input bytes, want only the writer's", m.BytesIn)
+	}
+	if m.ResizeCount != 0 {
+		t.Error("read-only client resized the session")
+	}
+}
+
+func TestGetExitedSession(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{ScrollbackBytes: 4096, ExitedTTL: time.Minute})
+	sess, err := pool.Create(session.CreateOptions{Command: "/bin/sh", Args: []string{"-c", "echo finished; exit 3"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	waitFor(t, "the command to exit", sess.IsClosed)
+
+	resp, err := http.Get(srv.URL + "/pty/" + sess.ID)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	var info SessionInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("status %d: %v", resp.StatusCode, err)
+	}
+	if info.State != SessionStateExited || info.ExitCode == nil || *info.ExitCode != 3 {
+		t.Errorf("got state %q, exit code %v; want exited with 3", info.State, info.ExitCode)
+	}
+	if !strings.Contains(info.OutputTail, "finished") {
+		t.Errorf("output tail %q, want the final output", info.OutputTail)
+	}
+}
+
+func TestTmuxOptions(t *testing.T) {
+	privateTmux(t)
+	no := false
+	srv, pool := testServer(t, session.PoolConfig{
+		TmuxEnabled: true,
+		Profiles:    map[string]session.Profile{"direct": {Tmux: &no}},
+	})
+	sess, err := pool.Create(session.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	do := func(method, path, body string) (int, map[string]string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var options map[string]string
+		json.NewDecoder(resp.Body).Decode(&options)
+		return resp.StatusCode, options
+	}
+
+	path := "/pty/" + sess.ID + "/options"
+	if status, _ := do("PUT", path, `{"mouse":"on","history-limit":"5000"}`); status != http.StatusOK {
+		t.Fatalf("PUT options: status %d", status)
+	}
+	status, options := do("GET", path, "")
+	if status != http.StatusOK {
+		t.Fatalf("GET options: status %d", status)
+	}
+	if options["mouse"] != "on" || options["history-limit"] != "5000" || options["status"] == "" {
+		t.Errorf("options = %v, want the values set and status reported", options)
+	}
+
+	// A bad entry rejects the whole update
+	if status, _ := do("PUT", path, `{"mouse":"off","prefix":"C-a"}`); status != http.StatusBadRequest {
+		t.Errorf("PUT with prefix: status %d, want 400", status)
+	}
+	if status, _ := do("PUT", path, `{"mouse":"maybe"}`); status != http.StatusBadRequest {
+		t.Errorf("PUT with a bad value: status %d, want 400", status)
+	}
+	if _, options := do("GET", path, ""); options["mouse"] != "on" {
+		t.Errorf("mouse = %q after rejected updates, want on", options["mouse"])
+	}
+
+	direct, err := pool.Create(session.CreateOptions{Profile: "direct"})
+	if err != nil {
+		t.Fatalf("Create direct: %v", err)
+	}
+	if status, _ := do("GET", "/pty/"+direct.ID+"/options", ""); status != http.StatusBadRequest {
+		t.Errorf("GET options of a direct session: status %d, want 400", status)
+	}
+}
+
+func TestCreateReportsFallbackCommand(t *testing.T) {
+	srv, _ := testServer(t, session.PoolConfig{})
+	resp, err := http.Post(srv.URL+"/pty", "application/json", strings.NewReader(`{"command":"/no/such/shell","fallbackCommand":"/bin/sh"}`))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	var created CreateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("status %d: %v", resp.StatusCode, err)
+	}
+	if created.Command != "/bin/sh" {
+		t.Errorf("command = %q, want the fallback /bin/sh", created.Command)
+	}
+
+	resp, err = http.Post(srv.URL+"/pty", "application/json", strings.NewReader(`{"command":"/no/such/shell"}`))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Error("create without a fallback succeeded")
+	}
+}
+
+func TestGetSessionActivity(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{})
+	sess, err := pool.Create(session.CreateOptions{Command: "/bin/cat"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	get := func() SessionInfoResponse {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/pty/" + sess.ID)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		defer resp.Body.Close()
+		var info SessionInfoResponse
+		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+			t.Fatalf("status %d: %v", resp.StatusCode, err)
+		}
+		return info
+	}
+	before := get()
+
+	// The input is echoed back as output
+	start := time.Now()
+	if err := sess.Write([]byte("x\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	waitFor(t, "output", func() bool { return sess.LastOutputAt().After(start) })
+	info := get()
+	if !info.LastInputAt.After(before.LastInputAt) {
+		t.Errorf("lastInputAt %s, want it after the input", info.LastInputAt)
+	}
+	if !info.LastOutputAt.After(start) {
+		t.Errorf("lastOutputAt %s, want it after the input", info.LastOutputAt)
+	}
+}
+
+func TestListSignals(t *testing.T) {
+	srv, _ := testServer(t, session.PoolConfig{})
+	resp, err := http.Get(srv.URL + "/signals")
+	if err != nil {
+		t.Fatalf("GET /signals: %v", err)
+	}
+	defer resp.Body.Close()
+	var list []session.SignalInfo
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("status %d: %v", resp.StatusCode, err)
+	}
+	if !slices.Equal(list, session.Signals()) {
+		t.Errorf("GET /signals = %v, want %v", list, session.Signals())
+	}
+	if !slices.ContainsFunc(list, func(s session.SignalInfo) bool { return s.Name == "SIGINT" }) {
+		t.Errorf("SIGINT not listed in %v", list)
+	}
+}
+
+func TestSessionMetricsEndpoint(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{})
+	sess, err := pool.Create(session.CreateOptions{Command: "/bin/cat"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	conn := dial(t, srv, "/pty/"+sess.ID+"/connect")
+	readControl(t, conn, "ready")
+	get := func() SessionMetricsResponse {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/pty/" + sess.ID + "/metrics")
+		if err != nil {
+			t.Fatalf("GET metrics: %v", err)
+		}
+		defer resp.Body.Close()
+		var m SessionMetricsResponse
+		if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+			t.Fatalf("status %d: %v", resp.StatusCode, err)
+		}
+		return m
+	}
+	before := get()
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("hi\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	sendControl(t, conn, session.ControlMessage{Type: session.ControlTypeResize, Cols: 100, Rows: 30})
+	waitFor(t, "the input and resize", func() bool {
+		m := sess.Metrics()
+		return m.BytesIn == before.BytesIn+3 && m.ResizeCount == before.ResizeCount+1 && m.BytesOut >= before.BytesOut+8
+	})
+
+	m := get()
+	if m.ID != sess.ID || m.BytesIn != before.BytesIn+3 || m.BytesOut < before.BytesOut+8 || m.ResizeCount != before.ResizeCount+1 || m.PeakClients != 1 {
+		t.Errorf("metrics %+v after input and a resize, from %+v", m, before)
+	}
+	if m.UptimeSeconds <= before.UptimeSeconds {
+		t.Errorf("uptime %v, want it past %v", m.UptimeSeconds, before.UptimeSeconds)
+	}
+}
+
+func TestDeleteTmuxDefaults(t *testing.T) {
+	privateTmux(t)
+
+	for _, keeps := range []bool{false, true} {
+		srv, pool := testServer(t, session.PoolConfig{TmuxEnabled: true, DeleteKeepsTmux: keeps})
+		remove := func(query string) bool {
+			t.Helper()
+			sess, err := pool.Create(session.CreateOptions{})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			req, _ := http.NewRequest("DELETE", srv.URL+"/pty/"+sess.ID+query, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("DELETE: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("DELETE%s: status %d", query, resp.StatusCode)
+			}
+			if _, ok := pool.Get(sess.ID); ok {
+				t.Errorf("DELETE%s left the session in the pool", query)
+			}
+			kept := tmux.SessionExists(sess.TmuxSessionName)
+			tmux.KillSession(sess.TmuxSessionName)
+			return kept
+		}
+
+		if kept := remove(""); kept != keeps {
+			t.Errorf("DeleteKeepsTmux %v: tmux session kept = %v by default", keeps, kept)
+		}
+		// The request overrides the default either way
+		if kept := remove("?keepTmux=" + strconv.FormatBool(!keeps)); kept != !keeps {
+			t.Errorf("DeleteKeepsTmux %v: tmux session kept = %v with keepTmux=%v", keeps, kept, !keeps)
+		}
+	}
+}
+
+func TestGetSessionTmuxName(t *testing.T) {
+	privateTmux(t)
+	no := false
+	srv, pool := testServer(t, session.PoolConfig{
+		TmuxEnabled: true,
+		Profiles:    map[string]session.Profile{"direct": {Tmux: &no}},
+	})
+
+	get := func(id string) map[string]any {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/pty/" + id)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		defer resp.Body.Close()
+		var info map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+			t.Fatalf("status %d: %v", resp.StatusCode, err)
+		}
+		return info
+	}
+
+	sess, err := pool.Create(session.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if name := get(sess.ID)["tmuxSessionName"]; name == "" || name != sess.TmuxSessionName || !tmux.SessionExists(sess.TmuxSessionName) {
+		t.Errorf("tmuxSessionName = %v, want the live tmux session %q", name, sess.TmuxSessionName)
+	}
+
+	direct, err := pool.Create(session.CreateOptions{Profile: "direct"})
+	if err != nil {
+		t.Fatalf("Create direct: %v", err)
+	}
+	if name, ok := get(direct.ID)["tmuxSessionName"]; ok {
+		t.Errorf("direct session has tmuxSessionName %v", name)
+	}
+}
+
+func TestUpdateSessionDebug(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{})
+	sess, err := pool.Create(session.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for _, debug := range []bool{true, false} {
+		req, _ := http.NewRequest("PUT", srv.URL+"/pty/"+sess.ID, strings.NewReader(`{"debug":`+strconv.FormatBool(debug)+`}`))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PUT: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || sess.Debug() != debug {
+			t.Errorf("PUT debug %v: status %d, session debug %v", debug, resp.StatusCode, sess.Debug())
+		}
+	}
+}
+
+func TestConnectDefaultSession(t *testing.T) {
+	srv, pool := testServerOptions(t, session.PoolConfig{}, Options{DefaultSessionID: "default"})
+
+	// The first connect creates the session with the server defaults
+	conn := dial(t, srv, "/pty/default/connect")
+	if msg := readControl(t, conn, session.ControlTypeReady); msg.SessionID != "default" {
+		t.Errorf("ready for session %q, want default", msg.SessionID)
+	}
+	sess, ok := pool.Get("default")
+	if !ok {
+		t.Fatal("default session not created")
+	}
+	if sess.Command != "/bin/sh" {
+		t.Errorf("command %s, want the default", sess.Command)
+	}
+
+	// Later connects join it rather than creating another
+	conn.Close()
+	waitFor(t, "the client to leave", func() bool { return sess.ClientCount() == 0 })
+	readControl(t, dial(t, srv, "/pty/default/connect"), session.ControlTypeReady)
+	if got, _ := pool.Get("default"); got != sess || pool.Count() != 1 {
+		t.Errorf("reconnect gave a new session (%d in the pool)", pool.Count())
+	}
+
+	// Other unknown IDs aren't created
+	if _, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/pty/other/connect", nil); err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("connect to an unknown ID: %v, want status 404", err)
+	}
+}
+
+func TestConnectDefaultSessionDisabled(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{})
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/pty/default/connect", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("connect without DefaultSessionID: %v, want status 404", err)
+	}
+	if pool.Count() != 0 {
+		t.Errorf("%d sessions created", pool.Count())
+	}
+}
+
+func TestCreateOversizedArgs(t *testing.T) {
+	srv, pool := testServer(t, session.PoolConfig{MaxArgs: 100, MaxArgsBytes: 4096})
+	many, _ := json.Marshal(map[string]any{"command": "/bin/echo", "args": make([]string, 1000)})
+	long, _ := json.Marshal(map[string]any{"command": "/bin/echo", "args": []string{strings.Repeat("x", 10000)}})
+	for name, body := range map[string][]byte{"too many args": many, "too long an arg": long} {
+		resp, err := http.Post(srv.URL+"/pty", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST /pty: %v", err)
+		}
+		msg, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, resp.StatusCode)
+		}
+		if !strings.Contains(string(msg), "args exceed limit") {
+			t.Errorf("%s: body %q doesn't say why", name, msg)
+		}
+	}
+	if pool.Count() != 0 {
+		t.Errorf("%d sessions created", pool.Count())
+	}
+}
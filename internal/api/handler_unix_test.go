@@ -0,0 +1,47 @@
+//go:build !windows
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/session"
+)
+
+func TestCreateOutOfFileDescriptors(t *testing.T) {
+	pool := session.NewPool(session.PoolConfig{DefaultCommand: "/bin/cat", SessionTimeout: time.Minute})
+	t.Cleanup(pool.CloseAll)
+	h := NewHandler(pool, nil, Options{})
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		t.Fatalf("Getrlimit: %v", err)
+	}
+	// With no descriptors left, opening the PTY fails with EMFILE. The
+	// handler is called directly, as serving over HTTP needs descriptors too.
+	exhausted := limit
+	exhausted.Cur = 0
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &exhausted); err != nil {
+		t.Fatalf("Setrlimit: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/pty", strings.NewReader(`{}`)))
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		t.Fatalf("restoring the fd limit: %v", err)
+	}
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d (%s), want 503", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After")
+	}
+	if pool.Count() != 0 {
+		t.Errorf("%d sessions after a failed spawn", pool.Count())
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
+)
+
+// BuildInfo identifies the running build, as set by the linker.
+type BuildInfo struct {
+	Version string
+	Commit  string
+	Date    string
+}
+
+// HealthResponse is the response for GET /health.
+type HealthResponse struct {
+	Status        string  `json:"status"`
+	Sessions      int     `json:"sessions"`
+	TmuxSessions  int     `json:"tmuxSessions"`
+	TmuxAvailable bool    `json:"tmuxAvailable"`
+	Version       string  `json:"version"`
+	Commit        string  `json:"commit"`
+	Date          string  `json:"date"`
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+}
+
+func (h *Handler) health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HealthResponse{
+		Status:        "ok",
+		Sessions:      h.pool.Count(),
+		TmuxSessions:  h.pool.TmuxCount(),
+		TmuxAvailable: tmux.CheckInstalled() == nil,
+		Version:       h.build.Version,
+		Commit:        h.build.Commit,
+		Date:          h.build.Date,
+		UptimeSeconds: time.Since(h.startedAt).Seconds(),
+	})
+}
+
+// healthz is the liveness probe: the server is alive if it answers.
+// GET /healthz
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// readyz is the readiness probe: in tmux mode sessions can't be created
+// without the tmux binary, so the server reports 503 until it is found.
+// GET /readyz
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if h.pool.Config().TmuxEnabled {
+		if err := tmux.CheckInstalled(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "unavailable", "error": err.Error()})
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
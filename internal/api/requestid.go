@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// requestIDHeader carries the correlation ID of a request, in both
+// directions.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs, which end up in
+// every log line of the request.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// withRequestID tags every request with a correlation ID: the client's
+// X-Request-ID if it is usable, otherwise a generated one. The ID is echoed
+// in the response and logged by requestLogger.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = generateClientID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID reports whether a client-supplied ID is short and made of
+// printable ASCII without spaces, so it can't garble log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID returns the correlation ID of r, or "" outside withRequestID.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns a logger that adds r's correlation ID to each line.
+func requestLogger(r *http.Request) *slog.Logger {
+	if id := requestID(r); id != "" {
+		return slog.With("request_id", id)
+	}
+	return slog.Default()
+}
+
+// upgradeHeader returns the response headers for a WebSocket upgrade, which
+// doesn't send the headers already set on the ResponseWriter.
+func upgradeHeader(r *http.Request) http.Header {
+	if id := requestID(r); id != "" {
+		return http.Header{requestIDHeader: {id}}
+	}
+	return nil
+}
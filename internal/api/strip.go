@@ -0,0 +1,55 @@
+package api
+
+// stripEscapes removes terminal escape sequences and control characters from
+// terminal output, leaving plain text. Line feeds and tabs are kept; carriage
+// returns are dropped, so "\r\n" line endings become "\n".
+func stripEscapes(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == 0x1b:
+			i = skipEscape(data, i)
+		case c == '\n' || c == '\t':
+			out = append(out, c)
+		case c < 0x20 || c == 0x7f:
+			// Other C0 controls, e.g. the bell or backspace
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// skipEscape returns the index of the last byte of the escape sequence that
+// starts at data[i].
+func skipEscape(data []byte, i int) int {
+	if i+1 >= len(data) {
+		return i
+	}
+	switch data[i+1] {
+	case '[':
+		// CSI: parameter and intermediate bytes up to a final byte in @-~
+		for j := i + 2; j < len(data); j++ {
+			if data[j] >= 0x40 && data[j] <= 0x7e {
+				return j
+			}
+		}
+		return len(data) - 1
+	case ']', 'P', 'X', '^', '_':
+		// OSC, DCS, SOS, PM and APC run to BEL (OSC only) or ESC \
+		for j := i + 2; j < len(data); j++ {
+			if data[j] == 0x07 && data[i+1] == ']' {
+				return j
+			}
+			if data[j] == 0x1b && j+1 < len(data) && data[j+1] == '\\' {
+				return j + 1
+			}
+		}
+		return len(data) - 1
+	case '(', ')', '*', '+', '#', '%':
+		// Charset designation and the like take one more byte
+		return min(i+2, len(data)-1)
+	}
+	return i + 1
+}
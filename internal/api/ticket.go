@@ -0,0 +1,67 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ticketStore holds single-use connect tickets. A ticket lets a client open
+// the WebSocket for one session without sending credentials in the URL.
+type ticketStore struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	tickets map[string]pendingTicket
+}
+
+type pendingTicket struct {
+	sessionID string
+	expiresAt time.Time
+}
+
+func newTicketStore(ttl time.Duration) *ticketStore {
+	return &ticketStore{
+		ttl:     ttl,
+		tickets: make(map[string]pendingTicket),
+	}
+}
+
+// Issue creates a ticket for sessionID and returns it with its expiry.
+func (t *ticketStore) Issue(sessionID string) (string, time.Time) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	ticket := hex.EncodeToString(b)
+	expiresAt := time.Now().Add(t.ttl)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+	t.tickets[ticket] = pendingTicket{sessionID: sessionID, expiresAt: expiresAt}
+	return ticket, expiresAt
+}
+
+// Consume reports whether ticket is valid for sessionID. A ticket is removed
+// on first use, whether or not it matched.
+func (t *ticketStore) Consume(ticket, sessionID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+
+	pending, ok := t.tickets[ticket]
+	if !ok {
+		return false
+	}
+	delete(t.tickets, ticket)
+	return pending.sessionID == sessionID
+}
+
+// prune drops expired tickets. Must be called with t.mu held.
+func (t *ticketStore) prune() {
+	now := time.Now()
+	for ticket, pending := range t.tickets {
+		if now.After(pending.expiresAt) {
+			delete(t.tickets, ticket)
+		}
+	}
+}
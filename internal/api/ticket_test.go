@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/itsmylife44/terminus-pty/internal/auth"
+	"github.com/itsmylife44/terminus-pty/internal/session"
+)
+
+func TestTicketStore(t *testing.T) {
+	store := newTicketStore(time.Minute)
+
+	ticket, expiresAt := store.Issue("pty_a")
+	if until := time.Until(expiresAt); until <= 0 || until > time.Minute {
+		t.Errorf("ticket expires in %s, want within the TTL", until)
+	}
+	if !store.Consume(ticket, "pty_a") {
+		t.Fatal("valid ticket rejected")
+	}
+	if store.Consume(ticket, "pty_a") {
+		t.Error("ticket accepted a second time")
+	}
+
+	// A ticket presented for another session is used up all the same
+	ticket, _ = store.Issue("pty_a")
+	if store.Consume(ticket, "pty_b") {
+		t.Error("ticket accepted for another session")
+	}
+	if store.Consume(ticket, "pty_a") {
+		t.Error("ticket accepted after a mismatched use")
+	}
+
+	if store.Consume("not-a-ticket", "pty_a") {
+		t.Error("unknown ticket accepted")
+	}
+}
+
+func TestTicketStoreExpiry(t *testing.T) {
+	store := newTicketStore(10 * time.Millisecond)
+	ticket, _ := store.Issue("pty_a")
+	time.Sleep(20 * time.Millisecond)
+	if store.Consume(ticket, "pty_a") {
+		t.Error("expired ticket accepted")
+	}
+}
+
+func TestTicketConnectWithoutCredentials(t *testing.T) {
+	pool := session.NewPool(session.PoolConfig{DefaultCommand: "/bin/sh", SessionTimeout: time.Minute})
+	srv := httptest.NewServer(NewHandler(pool, auth.NewBasicAuth("admin", "secret"), Options{}))
+	t.Cleanup(func() {
+		srv.Close()
+		pool.CloseAll()
+	})
+	sess, err := pool.Create(session.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", srv.URL+"/pty/"+sess.ID+"/ticket", nil)
+	req.SetBasicAuth("admin", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST ticket: %v", err)
+	}
+	var issued TicketResponse
+	err = json.NewDecoder(resp.Body).Decode(&issued)
+	resp.Body.Close()
+	if err != nil || issued.Ticket == "" {
+		t.Fatalf("ticket response: %v (status %d)", err, resp.StatusCode)
+	}
+
+	connect := func(query string) int {
+		t.Helper()
+		conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/pty/"+sess.ID+"/connect"+query, nil)
+		if err != nil {
+			if resp == nil {
+				t.Fatalf("dial: %v", err)
+			}
+			return resp.StatusCode
+		}
+		conn.Close()
+		return resp.StatusCode
+	}
+	if status := connect(""); status != http.StatusUnauthorized {
+		t.Errorf("connect without credentials: status %d, want 401", status)
+	}
+	if status := connect("?ticket=" + issued.Ticket); status != http.StatusSwitchingProtocols {
+		t.Errorf("connect with the ticket: status %d, want 101", status)
+	}
+	if status := connect("?ticket=" + issued.Ticket); status != http.StatusUnauthorized {
+		t.Errorf("connect reusing the ticket: status %d, want 401", status)
+	}
+}
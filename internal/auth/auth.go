@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Authenticator checks the credentials on API requests.
+type Authenticator interface {
+	Authenticate(r *http.Request) bool
+	Middleware(next http.Handler) http.Handler
+	// Scheme names the authentication scheme, e.g. "basic", for reporting
+	// to clients.
+	Scheme() string
+}
+
+// realm is the realm sent in WWW-Authenticate challenges.
+const realm = "terminus-pty"
+
+// challenger is implemented by authenticators that send a WWW-Authenticate
+// challenge when they reject a request.
+type challenger interface {
+	challenge() string
+}
+
+// Any returns an Authenticator that accepts a request if any of the given
+// authenticators accepts it. It returns nil when given none and the
+// authenticator itself when given one.
+func Any(authenticators ...Authenticator) Authenticator {
+	switch len(authenticators) {
+	case 0:
+		return nil
+	case 1:
+		return authenticators[0]
+	}
+	return anyAuth(authenticators)
+}
+
+type anyAuth []Authenticator
+
+func (a anyAuth) Authenticate(r *http.Request) bool {
+	for _, auth := range a {
+		if auth.Authenticate(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a anyAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Authenticate(r) {
+			for _, auth := range a {
+				if c, ok := auth.(challenger); ok {
+					w.Header().Add("WWW-Authenticate", c.challenge())
+				}
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a anyAuth) Scheme() string {
+	schemes := make([]string, len(a))
+	for i, auth := range a {
+		schemes[i] = auth.Scheme()
+	}
+	return strings.Join(schemes, "+")
+}
@@ -1,13 +1,26 @@
 package auth
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/subtle"
+	"fmt"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type BasicAuth struct {
 	username string
 	password string
+
+	// Set when loaded from a credentials file; replaces username/password
+	path  string
+	mu    sync.RWMutex
+	users map[string][]byte // username to bcrypt hash
 }
 
 func NewBasicAuth(username, password string) *BasicAuth {
@@ -17,12 +30,94 @@ func NewBasicAuth(username, password string) *BasicAuth {
 	}
 }
 
+// NewBasicAuthFromFile loads accounts from an htpasswd-style file of
+// username:bcrypt-hash lines. Blank lines and lines starting with # are
+// ignored. Call Reload to pick up changes to the file.
+func NewBasicAuthFromFile(path string) (*BasicAuth, error) {
+	a := &BasicAuth{path: path}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload rereads the credentials file. On error the current accounts are
+// kept. It is a no-op for a BasicAuth without a file.
+func (a *BasicAuth) Reload() error {
+	if a.path == "" {
+		return nil
+	}
+	users, err := loadCredentials(a.path)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.users = users
+	a.mu.Unlock()
+	return nil
+}
+
+// Users returns the number of accounts, 1 for a single username/password.
+func (a *BasicAuth) Users() int {
+	if a.path == "" {
+		return 1
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.users)
+}
+
+func loadCredentials(path string) (map[string][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string][]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("%s:%d: expected username:bcrypt-hash", path, n)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid bcrypt hash for %q: %w", path, n, username, err)
+		}
+		users[username] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// dummyHash is compared against for unknown users, so a lookup miss takes
+// as long as a wrong password.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("terminus-pty"), bcrypt.DefaultCost)
+	return hash
+})
+
 func (a *BasicAuth) Authenticate(r *http.Request) bool {
 	username, password, ok := r.BasicAuth()
 	if !ok {
 		return false
 	}
 
+	if a.path != "" {
+		a.mu.RLock()
+		hash, known := a.users[username]
+		a.mu.RUnlock()
+		if !known {
+			hash = dummyHash()
+		}
+		return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil && known
+	}
+
 	usernameMatch := subtle.ConstantTimeCompare([]byte(username), []byte(a.username)) == 1
 	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(a.password)) == 1
 
@@ -32,10 +127,18 @@ func (a *BasicAuth) Authenticate(r *http.Request) bool {
 func (a *BasicAuth) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !a.Authenticate(r) {
-			w.Header().Set("WWW-Authenticate", `Basic realm="terminus-pty"`)
+			w.Header().Set("WWW-Authenticate", a.challenge())
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (a *BasicAuth) Scheme() string {
+	return "basic"
+}
+
+func (a *BasicAuth) challenge() string {
+	return `Basic realm="` + realm + `"`
+}
@@ -0,0 +1,24 @@
+package pty
+
+import "errors"
+
+// ErrLineModeUnsupported is returned by SetLineMode on platforms where the
+// terminal attributes can't be changed.
+var ErrLineModeUnsupported = errors.New("line mode options are not supported on this platform")
+
+// DefaultEOF is the end-of-file character, Ctrl-D, that terminals use unless
+// reconfigured.
+const DefaultEOF = 0x04
+
+// LineMode holds the terminal line discipline options a session can request
+// at creation. Only options that can't break the server's handling of the
+// PTY are offered.
+type LineMode struct {
+	Echo *bool // Echo input back (nil = leave as is)
+	Raw  bool  // No line editing, signal keys or output processing, like cfmakeraw
+}
+
+// IsZero reports whether m leaves the terminal attributes unchanged.
+func (m LineMode) IsZero() bool {
+	return m.Echo == nil && !m.Raw
+}
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package pty
+
+// SetLineMode applies m to the PTY's terminal attributes. It is unsupported
+// on this platform unless m is zero.
+func (p *PTY) SetLineMode(m LineMode) error {
+	if m.IsZero() {
+		return nil
+	}
+	return ErrLineModeUnsupported
+}
+
+// EOFChar returns DefaultEOF, since the terminal attributes can't be read on
+// this platform.
+func (p *PTY) EOFChar() byte {
+	return DefaultEOF
+}
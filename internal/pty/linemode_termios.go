@@ -0,0 +1,56 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package pty
+
+import "golang.org/x/sys/unix"
+
+// SetLineMode applies m to the PTY's terminal attributes. Attributes set on
+// the master side apply to the terminal the command reads from.
+func (p *PTY) SetLineMode(m LineMode) error {
+	if p == nil || p.File == nil {
+		return ErrPTYClosed
+	}
+	if m.IsZero() {
+		return nil
+	}
+
+	fd := int(p.File.Fd())
+	t, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return err
+	}
+	if m.Raw {
+		t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		t.Cflag &^= unix.CSIZE | unix.PARENB
+		t.Cflag |= unix.CS8
+		t.Cc[unix.VMIN] = 1
+		t.Cc[unix.VTIME] = 0
+	}
+	if m.Echo != nil {
+		if *m.Echo {
+			t.Lflag |= unix.ECHO
+		} else {
+			t.Lflag &^= unix.ECHO
+		}
+	}
+	return unix.IoctlSetTermios(fd, ioctlSetTermios, t)
+}
+
+// EOFChar returns the terminal's end-of-file character (VEOF), or DefaultEOF
+// if it can't be read or is disabled.
+func (p *PTY) EOFChar() byte {
+	if p == nil || p.File == nil {
+		return DefaultEOF
+	}
+	t, err := unix.IoctlGetTermios(int(p.File.Fd()), ioctlGetTermios)
+	if err != nil {
+		return DefaultEOF
+	}
+	// Disabled is 0 on Linux and 0xff (_POSIX_VDISABLE) on the BSDs
+	if c := t.Cc[unix.VEOF]; c != 0 && c != 0xff {
+		return c
+	}
+	return DefaultEOF
+}
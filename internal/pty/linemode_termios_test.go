@@ -0,0 +1,104 @@
+//go:build linux || darwin
+
+package pty
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// spawnCat starts cat in a PTY with the line mode m applied.
+func spawnCat(t *testing.T, m LineMode) *PTY {
+	t.Helper()
+	p, err := Spawn("/bin/cat", nil, 80, 24, "", nil)
+	if err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	if err := p.SetLineMode(m); err != nil {
+		t.Fatalf("SetLineMode: %v", err)
+	}
+	return p
+}
+
+func termios(t *testing.T, p *PTY) *unix.Termios {
+	t.Helper()
+	tio, err := unix.IoctlGetTermios(int(p.File.Fd()), ioctlGetTermios)
+	if err != nil {
+		t.Fatalf("IoctlGetTermios: %v", err)
+	}
+	return tio
+}
+
+func TestSetLineModeEchoOff(t *testing.T) {
+	off := false
+	p := spawnCat(t, LineMode{Echo: &off})
+	if termios(t, p).Lflag&unix.ECHO != 0 {
+		t.Fatal("ECHO still set")
+	}
+
+	// Only cat's copy of the line comes back, not the terminal's echo
+	if _, err := p.Write([]byte("quiet\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	// The PTY doesn't take read deadlines; the reader ends when it's closed
+	chunks := make(chan []byte, 16)
+	go func() {
+		for {
+			buf := make([]byte, 256)
+			n, err := p.Read(buf)
+			if err != nil {
+				close(chunks)
+				return
+			}
+			chunks <- buf[:n]
+		}
+	}()
+	var out strings.Builder
+	timeout := time.After(5 * time.Second)
+	for !strings.Contains(out.String(), "quiet") {
+		select {
+		case c := <-chunks:
+			out.Write(c)
+		case <-timeout:
+			t.Fatalf("timed out waiting for output, got %q", out.String())
+		}
+	}
+	// Anything else would have arrived with or soon after the first copy
+	settle := time.After(200 * time.Millisecond)
+	for done := false; !done; {
+		select {
+		case c, ok := <-chunks:
+			if !ok {
+				chunks = nil
+			}
+			out.Write(c)
+		case <-settle:
+			done = true
+		}
+	}
+	if c := strings.Count(out.String(), "quiet"); c != 1 {
+		t.Errorf("input came back %d times with echo off: %q", c, out.String())
+	}
+}
+
+func TestSetLineModeRaw(t *testing.T) {
+	p := spawnCat(t, LineMode{Raw: true})
+	tio := termios(t, p)
+	if tio.Lflag&(unix.ECHO|unix.ICANON|unix.ISIG) != 0 {
+		t.Errorf("raw mode left local flags %#x set", tio.Lflag&(unix.ECHO|unix.ICANON|unix.ISIG))
+	}
+	if tio.Oflag&unix.OPOST != 0 {
+		t.Error("raw mode left output processing on")
+	}
+}
+
+func TestSetLineModeZeroLeavesEcho(t *testing.T) {
+	p := spawnCat(t, LineMode{})
+	if termios(t, p).Lflag&unix.ECHO == 0 {
+		t.Error("ECHO cleared without a line mode")
+	}
+}
@@ -1,18 +1,26 @@
 package pty
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"syscall"
+	"time"
 
-	"github.com/creack/pty"
 	"github.com/itsmylife44/terminus-pty/internal/tmux"
 )
 
+// ErrPTYClosed is returned by operations on a PTY that has no open file,
+// e.g. one left behind by a failed spawn or reattach.
+var ErrPTYClosed = errors.New("pty is closed")
+
 type PTY struct {
 	File            *os.File
 	Cmd             *exec.Cmd
 	TmuxSessionName string // Non-empty when using tmux mode
+
+	console *console // Windows pseudo console; nil on other platforms
 }
 
 type Size struct {
@@ -20,46 +28,14 @@ type Size struct {
 	Rows uint16 `json:"rows"`
 }
 
-// Spawn creates a direct PTY without tmux.
-func Spawn(command string, args []string, cols, rows uint16, workdir string) (*PTY, error) {
-	// Validate command exists
+// SpawnWithTmux creates a PTY inside a tmux session for persistence.
+func SpawnWithTmux(sessionName, command string, args []string, cols, rows uint16, workdir string, opts tmux.SpawnOptions) (*PTY, error) {
+	// Validate command exists; tmux would otherwise create a session that dies immediately
 	if _, err := exec.LookPath(command); err != nil {
 		return nil, fmt.Errorf("command not found: %s", command)
 	}
 
-	cmd := exec.Command(command, args...)
-
-	if workdir != "" {
-		cmd.Dir = workdir
-	} else {
-		home, err := os.UserHomeDir()
-		if err == nil {
-			cmd.Dir = home
-		}
-	}
-
-	cmd.Env = append(os.Environ(),
-		"TERM=xterm-256color",
-		"COLORTERM=truecolor",
-	)
-
-	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{
-		Cols: cols,
-		Rows: rows,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return &PTY{
-		File: ptmx,
-		Cmd:  cmd,
-	}, nil
-}
-
-// SpawnWithTmux creates a PTY inside a tmux session for persistence.
-func SpawnWithTmux(sessionName, command string, args []string, cols, rows uint16, workdir string) (*PTY, error) {
-	file, cmd, err := tmux.SpawnSession(sessionName, command, args, cols, rows, workdir)
+	file, cmd, err := tmux.SpawnSession(sessionName, command, args, cols, rows, workdir, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -71,9 +47,10 @@ func SpawnWithTmux(sessionName, command string, args []string, cols, rows uint16
 	}, nil
 }
 
-// AttachTmux reattaches to an existing tmux session.
-func AttachTmux(sessionName string, cols, rows uint16) (*PTY, error) {
-	file, cmd, err := tmux.AttachSession(sessionName, cols, rows)
+// AttachTmux reattaches to an existing tmux session. env holds extra
+// KEY=value entries for the tmux client.
+func AttachTmux(sessionName string, cols, rows uint16, env []string) (*PTY, error) {
+	file, cmd, err := tmux.AttachSession(sessionName, cols, rows, env)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +63,9 @@ func AttachTmux(sessionName string, cols, rows uint16) (*PTY, error) {
 }
 
 func (p *PTY) Resize(cols, rows uint16) error {
+	if p == nil || p.File == nil {
+		return ErrPTYClosed
+	}
 	// If tmux mode, also resize the tmux session
 	if p.TmuxSessionName != "" {
 		if err := tmux.ResizeSession(p.TmuxSessionName, cols, rows); err != nil {
@@ -93,28 +73,39 @@ func (p *PTY) Resize(cols, rows uint16) error {
 			_ = err
 		}
 	}
-	return pty.Setsize(p.File, &pty.Winsize{
-		Cols: cols,
-		Rows: rows,
-	})
+	return p.setsize(cols, rows)
 }
 
-// Close closes the PTY connection but does NOT kill the tmux session.
-// To kill the tmux session, use CloseWithTmux.
-func (p *PTY) Close() error {
-	// Kill the attach process (tmux attach or shell)
-	if p.Cmd != nil && p.Cmd.Process != nil {
-		_ = p.Cmd.Process.Kill()
-		_, _ = p.Cmd.Process.Wait()
+// resizeRetryDelay is how long EnsureSize waits before retrying a resize
+// that didn't stick.
+const resizeRetryDelay = 10 * time.Millisecond
+
+// EnsureSize reads the window size back after a resize and, if it doesn't
+// match, waits briefly and applies it once more. Some platforms need a moment
+// before a new size takes effect. Returns an error if the size still doesn't
+// match.
+func (p *PTY) EnsureSize(cols, rows uint16) error {
+	if p == nil || p.File == nil {
+		return ErrPTYClosed
+	}
+	if p.sizeIs(cols, rows) {
+		return nil
+	}
+	time.Sleep(resizeRetryDelay)
+	if err := p.setsize(cols, rows); err != nil {
+		return err
 	}
-	if p.File != nil {
-		return p.File.Close()
+	if !p.sizeIs(cols, rows) {
+		return fmt.Errorf("size %dx%d was not applied", cols, rows)
 	}
 	return nil
 }
 
 // CloseWithTmux closes the PTY and kills the tmux session if present.
 func (p *PTY) CloseWithTmux() error {
+	if p == nil {
+		return nil
+	}
 	// First close the PTY
 	err := p.Close()
 
@@ -129,15 +120,20 @@ func (p *PTY) CloseWithTmux() error {
 	return err
 }
 
+// ExitStatus describes how the command behind a PTY exited.
+type ExitStatus struct {
+	Code   int            // -1 if killed by a signal or unknown
+	Signal syscall.Signal // signal that killed the command, 0 if none
+}
+
 // IsTmux returns true if this PTY is backed by a tmux session.
 func (p *PTY) IsTmux() bool {
 	return p.TmuxSessionName != ""
 }
 
 func (p *PTY) Read(buf []byte) (int, error) {
+	if p == nil || p.File == nil {
+		return 0, ErrPTYClosed
+	}
 	return p.File.Read(buf)
 }
-
-func (p *PTY) Write(data []byte) (int, error) {
-	return p.File.Write(data)
-}
@@ -0,0 +1,29 @@
+package pty
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClosedPTY(t *testing.T) {
+	for name, p := range map[string]*PTY{
+		"nil file": {},
+		"nil PTY":  nil,
+	} {
+		if _, err := p.Read(make([]byte, 16)); !errors.Is(err, ErrPTYClosed) {
+			t.Errorf("%s: Read: got %v, want ErrPTYClosed", name, err)
+		}
+		if _, err := p.Write([]byte("x")); !errors.Is(err, ErrPTYClosed) {
+			t.Errorf("%s: Write: got %v, want ErrPTYClosed", name, err)
+		}
+		if err := p.Resize(80, 24); !errors.Is(err, ErrPTYClosed) {
+			t.Errorf("%s: Resize: got %v, want ErrPTYClosed", name, err)
+		}
+		if err := p.EnsureSize(80, 24); !errors.Is(err, ErrPTYClosed) {
+			t.Errorf("%s: EnsureSize: got %v, want ErrPTYClosed", name, err)
+		}
+		if err := p.Close(); err != nil {
+			t.Errorf("%s: Close: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+//go:build !windows
+
+package pty
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+// console is only used on Windows.
+type console struct{}
+
+// Spawn creates a direct PTY without tmux. env holds extra KEY=value entries
+// added to the server's environment, including TERM.
+func Spawn(command string, args []string, cols, rows uint16, workdir string, env []string) (*PTY, error) {
+	// Validate command exists
+	if _, err := exec.LookPath(command); err != nil {
+		return nil, fmt.Errorf("command not found: %s", command)
+	}
+
+	cmd := exec.Command(command, args...)
+
+	if workdir != "" {
+		cmd.Dir = workdir
+	} else {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			cmd.Dir = home
+		}
+	}
+
+	cmd.Env = append(os.Environ(), env...)
+
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{
+		Cols: cols,
+		Rows: rows,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PTY{
+		File: ptmx,
+		Cmd:  cmd,
+	}, nil
+}
+
+func (p *PTY) setsize(cols, rows uint16) error {
+	return pty.Setsize(p.File, &pty.Winsize{
+		Cols: cols,
+		Rows: rows,
+	})
+}
+
+func (p *PTY) sizeIs(cols, rows uint16) bool {
+	size, err := pty.GetsizeFull(p.File)
+	return err == nil && size.Cols == cols && size.Rows == rows
+}
+
+// Close closes the PTY connection but does NOT kill the tmux session.
+// To kill the tmux session, use CloseWithTmux.
+func (p *PTY) Close() error {
+	if p == nil {
+		return nil
+	}
+	// Kill the attach process (tmux attach or shell)
+	if p.Cmd != nil && p.Cmd.Process != nil {
+		_ = p.Cmd.Process.Kill()
+		_, _ = p.Cmd.Process.Wait()
+	}
+	if p.File != nil {
+		return p.File.Close()
+	}
+	return nil
+}
+
+// Wait waits for the command behind the PTY to exit and returns how it
+// exited. For tmux PTYs this is the attach client, not the command in the
+// pane.
+func (p *PTY) Wait() ExitStatus {
+	if p.Cmd == nil {
+		return ExitStatus{Code: -1}
+	}
+	err := p.Cmd.Wait()
+	if err == nil {
+		return ExitStatus{}
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ExitStatus{Code: -1}
+	}
+	status := ExitStatus{Code: exitErr.ExitCode()}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		status.Signal = ws.Signal()
+	}
+	return status
+}
+
+// Signal sends sig to the command behind the PTY. Returns os.ErrProcessDone
+// if it already exited.
+func (p *PTY) Signal(sig syscall.Signal) error {
+	if p == nil || p.Cmd == nil || p.Cmd.Process == nil {
+		return ErrPTYClosed
+	}
+	return p.Cmd.Process.Signal(sig)
+}
+
+func (p *PTY) Write(data []byte) (int, error) {
+	if p == nil || p.File == nil {
+		return 0, ErrPTYClosed
+	}
+	return p.File.Write(data)
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package pty
+
+import "testing"
+
+func TestEnsureSizeRetries(t *testing.T) {
+	p, err := Spawn("/bin/cat", nil, 80, 24, "", nil)
+	if err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.Resize(100, 30); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	if err := p.EnsureSize(100, 30); err != nil {
+		t.Errorf("EnsureSize after a resize that stuck: %v", err)
+	}
+
+	// A resize that didn't stick is applied again
+	if err := p.setsize(90, 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.EnsureSize(120, 40); err != nil {
+		t.Fatalf("EnsureSize: %v", err)
+	}
+	if !p.sizeIs(120, 40) {
+		t.Error("size not applied by the retry")
+	}
+
+	// A retry that fails is reported
+	p.File.Close()
+	if err := p.EnsureSize(132, 43); err == nil {
+		t.Error("EnsureSize on a closed PTY succeeded")
+	}
+}
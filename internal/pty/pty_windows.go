@@ -0,0 +1,287 @@
+//go:build windows
+
+package pty
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// consoleCloseTimeout bounds how long Close waits for a killed command to
+// exit before closing its pseudo console anyway.
+const consoleCloseTimeout = 5 * time.Second
+
+// console is a Windows pseudo console (ConPTY) running a command. The PTY's
+// File is the console's output; input goes to a separate pipe.
+type console struct {
+	handle windows.Handle
+	in     *os.File
+	proc   *os.Process
+
+	mu         sync.Mutex
+	cols, rows uint16 // last size applied; ConPTY can't report its size
+
+	exited    chan struct{} // closed once the command exited
+	exit      ExitStatus
+	closeOnce sync.Once
+}
+
+// Spawn creates a direct PTY backed by a pseudo console. env holds extra
+// KEY=value entries added to the server's environment, including TERM.
+func Spawn(command string, args []string, cols, rows uint16, workdir string, env []string) (*PTY, error) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return nil, fmt.Errorf("command not found: %s", command)
+	}
+	if workdir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			workdir = home
+		}
+	}
+
+	inRead, inWrite, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outRead, outWrite, err := os.Pipe()
+	if err != nil {
+		inRead.Close()
+		inWrite.Close()
+		return nil, err
+	}
+	var handle windows.Handle
+	err = windows.CreatePseudoConsole(coord(cols, rows),
+		windows.Handle(inRead.Fd()), windows.Handle(outWrite.Fd()), 0, &handle)
+	// The pseudo console keeps its own copies of its ends of the pipes
+	inRead.Close()
+	outWrite.Close()
+	if err != nil {
+		inWrite.Close()
+		outRead.Close()
+		return nil, fmt.Errorf("create pseudo console: %w", err)
+	}
+
+	proc, err := startInConsole(handle, path, args, workdir, append(os.Environ(), env...))
+	if err != nil {
+		windows.ClosePseudoConsole(handle)
+		inWrite.Close()
+		outRead.Close()
+		return nil, err
+	}
+
+	c := &console{
+		handle: handle,
+		in:     inWrite,
+		proc:   proc,
+		cols:   cols,
+		rows:   rows,
+		exited: make(chan struct{}),
+	}
+	go c.wait()
+	return &PTY{File: outRead, console: c}, nil
+}
+
+// startInConsole starts path attached to the pseudo console. os/exec can't
+// do this: the console has to be passed in the process's attribute list.
+func startInConsole(console windows.Handle, path string, args []string, dir string, env []string) (*os.Process, error) {
+	attrs, err := windows.NewProcThreadAttributeList(1)
+	if err != nil {
+		return nil, err
+	}
+	defer attrs.Delete()
+	// The attribute's value is the console handle itself, not a pointer to it
+	if err := attrs.Update(windows.PROC_THREAD_ATTRIBUTE_PSEUDOCONSOLE,
+		*(*unsafe.Pointer)(unsafe.Pointer(&console)), unsafe.Sizeof(console)); err != nil {
+		return nil, err
+	}
+
+	si := &windows.StartupInfoEx{ProcThreadAttributeList: attrs.List()}
+	si.Cb = uint32(unsafe.Sizeof(*si))
+	// Without this the command would inherit the server's standard handles
+	// instead of using the console
+	si.Flags = windows.STARTF_USESTDHANDLES
+
+	cmdLine, err := windows.UTF16PtrFromString(windows.ComposeCommandLine(append([]string{path}, args...)))
+	if err != nil {
+		return nil, err
+	}
+	var dirPtr *uint16
+	if dir != "" {
+		if dirPtr, err = windows.UTF16PtrFromString(dir); err != nil {
+			return nil, err
+		}
+	}
+	block, err := envBlock(env)
+	if err != nil {
+		return nil, err
+	}
+
+	var pi windows.ProcessInformation
+	err = windows.CreateProcess(nil, cmdLine, nil, nil, false,
+		windows.EXTENDED_STARTUPINFO_PRESENT|windows.CREATE_UNICODE_ENVIRONMENT,
+		&block[0], dirPtr, &si.StartupInfo, &pi)
+	if err != nil {
+		return nil, fmt.Errorf("start %s: %w", path, err)
+	}
+	defer windows.CloseHandle(pi.Process)
+	windows.CloseHandle(pi.Thread)
+	// Our handle keeps the process ID from being reused until FindProcess
+	// has opened its own
+	return os.FindProcess(int(pi.ProcessId))
+}
+
+// envBlock encodes env as a Windows environment block: NUL-terminated
+// KEY=value strings followed by a final NUL. Like os/exec, later entries
+// override earlier ones with the same key, ignoring case.
+func envBlock(env []string) ([]uint16, error) {
+	last := make(map[string]int, len(env))
+	for i, kv := range env {
+		last[envKey(kv)] = i
+	}
+	var block []uint16
+	for i, kv := range env {
+		if kv == "" || last[envKey(kv)] != i {
+			continue
+		}
+		for _, r := range kv {
+			if r == 0 {
+				return nil, fmt.Errorf("environment variable contains NUL: %q", kv)
+			}
+		}
+		block = append(block, utf16.Encode([]rune(kv))...)
+		block = append(block, 0)
+	}
+	return append(block, 0), nil
+}
+
+// envKey returns the upper-cased key of a KEY=value entry. Per-drive
+// entries such as "=C:=C:\\" keep their leading '='.
+func envKey(kv string) string {
+	if kv == "" {
+		return ""
+	}
+	key, _, _ := strings.Cut(kv[1:], "=")
+	return strings.ToUpper(kv[:1] + key)
+}
+
+func coord(cols, rows uint16) windows.Coord {
+	return windows.Coord{X: int16(cols), Y: int16(rows)}
+}
+
+// wait records how the command exited and then closes the pseudo console.
+// The console holds its output pipe open until it is closed, so without
+// this the PTY's reader would never see the end of output.
+func (c *console) wait() {
+	state, err := c.proc.Wait()
+	if err != nil {
+		c.exit = ExitStatus{Code: -1}
+	} else {
+		c.exit = ExitStatus{Code: state.ExitCode()}
+	}
+	close(c.exited)
+	c.close()
+}
+
+// close closes the pseudo console once.
+func (c *console) close() {
+	c.closeOnce.Do(func() {
+		windows.ClosePseudoConsole(c.handle)
+	})
+}
+
+func (p *PTY) setsize(cols, rows uint16) error {
+	if p.console == nil {
+		return ErrPTYClosed
+	}
+	if err := windows.ResizePseudoConsole(p.console.handle, coord(cols, rows)); err != nil {
+		return err
+	}
+	p.console.mu.Lock()
+	p.console.cols, p.console.rows = cols, rows
+	p.console.mu.Unlock()
+	return nil
+}
+
+func (p *PTY) sizeIs(cols, rows uint16) bool {
+	if p.console == nil {
+		return false
+	}
+	p.console.mu.Lock()
+	defer p.console.mu.Unlock()
+	return p.console.cols == cols && p.console.rows == rows
+}
+
+// Close kills the command and closes its pseudo console.
+func (p *PTY) Close() error {
+	if p == nil {
+		return nil
+	}
+	if c := p.console; c != nil {
+		_ = c.proc.Kill()
+		select {
+		case <-c.exited:
+		case <-time.After(consoleCloseTimeout):
+		}
+		// Closing the output first keeps ClosePseudoConsole from blocking
+		// on output nobody reads
+		if p.File != nil {
+			p.File.Close()
+		}
+		c.close()
+		return c.in.Close()
+	}
+	if p.File != nil {
+		return p.File.Close()
+	}
+	return nil
+}
+
+// Wait waits for the command behind the PTY to exit and returns how it
+// exited. Windows has no signals, so Signal is always 0.
+func (p *PTY) Wait() ExitStatus {
+	if p.console == nil {
+		return ExitStatus{Code: -1}
+	}
+	<-p.console.exited
+	return p.console.exit
+}
+
+// Signal delivers sig to the command behind the PTY. Windows only supports
+// SIGINT, typed as Ctrl-C, which the console turns into a Ctrl-C event, and
+// SIGKILL, which terminates the command. Returns os.ErrProcessDone if it
+// already exited.
+func (p *PTY) Signal(sig syscall.Signal) error {
+	if p == nil || p.console == nil {
+		return ErrPTYClosed
+	}
+	select {
+	case <-p.console.exited:
+		return os.ErrProcessDone
+	default:
+	}
+	switch sig {
+	case syscall.SIGINT:
+		_, err := p.console.in.Write([]byte{0x03})
+		return err
+	case syscall.SIGKILL:
+		return p.console.proc.Kill()
+	}
+	return fmt.Errorf("%w: %s on Windows", errors.ErrUnsupported, sig)
+}
+
+func (p *PTY) Write(data []byte) (int, error) {
+	if p == nil || p.console == nil {
+		return 0, ErrPTYClosed
+	}
+	return p.console.in.Write(data)
+}
@@ -0,0 +1,45 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+)
+
+// ErrCommandNotAllowed is returned when PoolConfig.AllowedCommands is set and
+// doesn't include the requested command.
+var ErrCommandNotAllowed = errors.New("command not allowed")
+
+// CheckCommand checks cmd against PoolConfig.AllowedCommands. Both cmd and
+// the allowed entries are resolved to absolute paths, symlinks followed,
+// before comparing, so a symlink or a same-named binary elsewhere can't pass
+// for an allowed command. Entries without a slash are looked up in PATH.
+func (p *Pool) CheckCommand(cmd string) error {
+	if len(p.config.AllowedCommands) == 0 {
+		return nil
+	}
+	resolved, err := resolveCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCommandNotAllowed, cmd)
+	}
+	for _, allowed := range p.config.AllowedCommands {
+		if path, err := resolveCommand(allowed); err == nil && path == resolved {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrCommandNotAllowed, cmd)
+}
+
+// resolveCommand returns the absolute path of the executable cmd runs, with
+// symlinks resolved.
+func resolveCommand(cmd string) (string, error) {
+	path, err := exec.LookPath(cmd)
+	if err != nil {
+		return "", err
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
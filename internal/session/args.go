@@ -0,0 +1,29 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrArgsLimit is returned when a request's args exceed PoolConfig.MaxArgs or
+// PoolConfig.MaxArgsBytes.
+var ErrArgsLimit = errors.New("args exceed limit")
+
+// ValidateArgs checks requested command args against the configured count
+// and total length limits, so oversized requests fail clearly instead of
+// with a confusing spawn error.
+func (p *Pool) ValidateArgs(args []string) error {
+	if p.config.MaxArgs > 0 && len(args) > p.config.MaxArgs {
+		return fmt.Errorf("%w: %d args, at most %d allowed", ErrArgsLimit, len(args), p.config.MaxArgs)
+	}
+	if p.config.MaxArgsBytes > 0 {
+		total := 0
+		for _, arg := range args {
+			total += len(arg)
+		}
+		if total > p.config.MaxArgsBytes {
+			return fmt.Errorf("%w: %d bytes of args, at most %d allowed", ErrArgsLimit, total, p.config.MaxArgsBytes)
+		}
+	}
+	return nil
+}
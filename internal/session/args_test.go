@@ -0,0 +1,44 @@
+package session
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCreateArgsLimit(t *testing.T) {
+	p := testPool(t, PoolConfig{MaxArgs: 3, MaxArgsBytes: 16})
+	for _, tt := range []struct {
+		name string
+		args []string
+		ok   bool
+	}{
+		{"within both limits", []string{"-c", "exit 0"}, true},
+		{"at both limits", []string{"-c", "exit 0", strings.Repeat("x", 8)}, true},
+		{"too many", []string{"-c", "true", "a", "b"}, false},
+		{"too long", []string{"-c", "echo " + strings.Repeat("x", 20)}, false},
+	} {
+		_, err := p.Create(CreateOptions{Command: "/bin/sh", Args: tt.args})
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrArgsLimit) {
+			t.Errorf("%s: %v, want ErrArgsLimit", tt.name, err)
+		}
+	}
+}
+
+func TestCreateArgsLimitAfterVars(t *testing.T) {
+	p := testPool(t, PoolConfig{
+		MaxArgsBytes: 16,
+		Profiles: map[string]Profile{
+			"echo": {Command: "/bin/echo", Args: []string{"{msg}"}, Vars: map[string]*regexp.Regexp{"msg": regexp.MustCompile(`^x+$`)}},
+		},
+	})
+	// The request itself is small; the expanded args are not
+	_, err := p.Create(CreateOptions{Profile: "echo", Vars: map[string]string{"msg": strings.Repeat("x", 20)}})
+	if !errors.Is(err, ErrArgsLimit) {
+		t.Errorf("got %v, want ErrArgsLimit", err)
+	}
+}
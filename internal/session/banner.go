@@ -0,0 +1,14 @@
+package session
+
+import "strings"
+
+// terminalText prepares plain text for display in a terminal: line endings
+// become CRLF, since the banner is sent as output and bypasses the PTY's
+// line discipline, and a trailing newline is added if missing.
+func terminalText(text string) []byte {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return []byte(strings.ReplaceAll(text, "\n", "\r\n"))
+}
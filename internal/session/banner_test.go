@@ -0,0 +1,59 @@
+package session
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTerminalText(t *testing.T) {
+	for in, want := range map[string]string{
+		"one line":           "one line\r\n",
+		"two\nlines\n":       "two\r\nlines\r\n",
+		"already\r\ncrlf":    "already\r\ncrlf\r\n",
+		"mixed\r\nand\nbare": "mixed\r\nand\r\nbare\r\n",
+	} {
+		if got := string(terminalText(in)); got != want {
+			t.Errorf("terminalText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBannerShownToFirstClient(t *testing.T) {
+	p := testPool(t, PoolConfig{
+		Banner:         "Usage is monitored.\nBe nice.",
+		CommandBanners: map[string]string{"cat": "cat banner"},
+	})
+	for _, tt := range []struct {
+		command string
+		banner  string
+	}{
+		{"/bin/sh", "Usage is monitored.\r\nBe nice.\r\n"},
+		{"/bin/cat", "cat banner\r\n"},
+	} {
+		sess, err := p.Create(CreateOptions{Command: tt.command})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		// Each client's output up to its echoed marker
+		join := func(marker string) string {
+			t.Helper()
+			server, conn := wsPair(t)
+			if err := sess.AddClient(server, marker); err != nil {
+				t.Fatalf("AddClient: %v", err)
+			}
+			if err := sess.Write([]byte("echo " + marker + "\n")); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			out, _ := readUntil(t, conn, func(out string, _ []ControlMessage) bool { return strings.Contains(out, marker) })
+			sess.RemoveClient(server)
+			return out
+		}
+		if out := join("first"); !strings.HasPrefix(out, tt.banner) {
+			t.Errorf("%s: first client's output %q, want it to start with the banner %q", tt.command, out, tt.banner)
+		}
+		if out := join("second"); strings.Contains(out, tt.banner) {
+			t.Errorf("%s: banner shown again to the second client: %q", tt.command, out)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package session
+
+// bellDetector finds BEL (0x07) characters in PTY output that actually ring
+// the bell. BEL is also used to terminate OSC sequences (e.g. window title
+// updates), so those are skipped. State is kept across calls because escape
+// sequences may be split between reads.
+type bellDetector struct {
+	state bellState
+}
+
+type bellState int
+
+const (
+	bellStateGround    bellState = iota
+	bellStateEscape              // saw ESC
+	bellStateOSC                 // inside ESC ] ... terminator
+	bellStateOSCEscape           // saw ESC inside OSC, expecting '\'
+)
+
+// Scan reports whether data contains at least one bell.
+func (d *bellDetector) Scan(data []byte) bool {
+	rang := false
+	for _, b := range data {
+		switch d.state {
+		case bellStateGround:
+			switch b {
+			case 0x07:
+				rang = true
+			case 0x1b:
+				d.state = bellStateEscape
+			}
+		case bellStateEscape:
+			switch b {
+			case ']':
+				d.state = bellStateOSC
+			case 0x1b:
+				// Stay in escape state
+			default:
+				if b == 0x07 {
+					rang = true
+				}
+				d.state = bellStateGround
+			}
+		case bellStateOSC:
+			switch b {
+			case 0x07:
+				d.state = bellStateGround
+			case 0x1b:
+				d.state = bellStateOSCEscape
+			}
+		case bellStateOSCEscape:
+			if b == '\\' {
+				d.state = bellStateGround
+			} else {
+				d.state = bellStateOSC
+			}
+		}
+	}
+	return rang
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBellDetector(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		chunks []string
+		want   bool
+	}{
+		{"plain output", []string{"hello\r\n"}, false},
+		{"bell", []string{"ding\a"}, true},
+		{"title ended by BEL", []string{"\x1b]0;title\a"}, false},
+		{"title ended by ST", []string{"\x1b]2;title\x1b\\after"}, false},
+		{"bell after a title", []string{"\x1b]0;title\aring\a"}, true},
+		{"title split across reads", []string{"\x1b]0;ti", "tle\a"}, false},
+		{"escape split before the title", []string{"\x1b", "]0;title\a"}, false},
+	} {
+		d := &bellDetector{}
+		rang := false
+		for _, c := range tt.chunks {
+			rang = d.Scan([]byte(c)) || rang
+		}
+		if rang != tt.want {
+			t.Errorf("%s: rang = %v, want %v", tt.name, rang, tt.want)
+		}
+	}
+}
+
+func TestBellEvent(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		p := testPool(t, PoolConfig{BellEvents: enabled})
+		sess, err := p.Create(CreateOptions{Command: "/bin/sh", Args: []string{"-c", `sleep 0.2; printf 'ring\007\n'; echo done; exec cat`}})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		server, conn := wsPair(t)
+		if err := sess.AddClient(server, "c"); err != nil {
+			t.Fatalf("AddClient: %v", err)
+		}
+		_, controls := readUntil(t, conn, func(out string, _ []ControlMessage) bool { return strings.Contains(out, "done") })
+		// The event follows the output that rang; echoed input comes after both
+		if err := sess.Write([]byte("after\n")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		_, more := readUntil(t, conn, func(out string, _ []ControlMessage) bool { return strings.Contains(out, "after") })
+		controls = append(controls, more...)
+		if got := hasControl(controls, ControlTypeBell); got != enabled {
+			t.Errorf("BellEvents %v: bell event sent = %v", enabled, got)
+		}
+	}
+}
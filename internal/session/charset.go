@@ -0,0 +1,59 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// ErrUnknownCharset is returned for output charsets that aren't recognized.
+var ErrUnknownCharset = errors.New("unknown charset")
+
+// LookupCharset resolves a charset name such as "latin1" or "windows-1252"
+// using the WHATWG encoding labels.
+func LookupCharset(name string) (encoding.Encoding, error) {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCharset, name)
+	}
+	return enc, nil
+}
+
+// transcoder converts PTY output from a legacy charset to UTF-8. Multi-byte
+// sequences split across reads are held back until the rest arrives.
+type transcoder struct {
+	decoder *encoding.Decoder
+	pending []byte
+}
+
+func newTranscoder(enc encoding.Encoding) *transcoder {
+	return &transcoder{decoder: enc.NewDecoder()}
+}
+
+// Process transcodes a chunk of output to UTF-8.
+func (t *transcoder) Process(data []byte) []byte {
+	src := append(t.pending, data...)
+	t.pending = nil
+
+	out := make([]byte, 0, len(src)*2)
+	buf := make([]byte, 4096)
+	for len(src) > 0 {
+		nDst, nSrc, err := t.decoder.Transform(buf, src, false)
+		out = append(out, buf[:nDst]...)
+		src = src[nSrc:]
+		if errors.Is(err, transform.ErrShortSrc) {
+			// Incomplete sequence at the end; wait for the next read
+			t.pending = append([]byte(nil), src...)
+			break
+		}
+		if err != nil && !errors.Is(err, transform.ErrShortDst) {
+			// Undecodable input: pass it through rather than stall the stream
+			out = append(out, src...)
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// transcodeAll feeds chunks through a fresh transcoder for charset,
+// returning everything it emitted.
+func transcodeAll(t *testing.T, charset string, chunks ...string) string {
+	t.Helper()
+	enc, err := LookupCharset(charset)
+	if err != nil {
+		t.Fatalf("LookupCharset(%q): %v", charset, err)
+	}
+	tc := newTranscoder(enc)
+	var out strings.Builder
+	for _, c := range chunks {
+		out.Write(tc.Process([]byte(c)))
+	}
+	return out.String()
+}
+
+func TestTranscodeLatin1(t *testing.T) {
+	in := "caf\xe9 \xfcber \xdf \xa9 ascii"
+	want := "café über ß © ascii"
+	for _, name := range []string{"latin1", "iso-8859-1"} {
+		if got := transcodeAll(t, name, in); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestTranscodeSplitSequence(t *testing.T) {
+	// "日本" in Shift_JIS, split inside the first character
+	if got, want := transcodeAll(t, "shift_jis", "a\x93", "\xfa\x96{b"), "a日本b"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLookupCharsetUnknown(t *testing.T) {
+	if _, err := LookupCharset("no-such-charset"); !errors.Is(err, ErrUnknownCharset) {
+		t.Errorf("got %v, want ErrUnknownCharset", err)
+	}
+}
+
+func TestSessionOutputCharset(t *testing.T) {
+	p := testPool(t, PoolConfig{OutputCharset: "latin1"})
+	sess, err := p.Create(CreateOptions{Command: "/bin/sh", Args: []string{"-c", `sleep 0.2; printf 'caf\351\n'; exec cat`}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	server, client := wsPair(t)
+	if err := sess.AddClient(server, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+	var out strings.Builder
+	for !strings.Contains(out.String(), "\n") {
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v (output so far %q)", err, out.String())
+		}
+		if kind == websocket.BinaryMessage {
+			out.Write(data)
+		}
+	}
+	if !strings.Contains(out.String(), "café") {
+		t.Errorf("output %q, want café in UTF-8", out.String())
+	}
+}
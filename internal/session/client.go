@@ -0,0 +1,122 @@
+package session
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// clientQueueSize is how many frames a client may fall behind the broadcast
+// before it is disconnected with CloseCode4005. An output frame is one PTY
+// read of up to PoolConfig.ReadBufferSize, or with PoolConfig.OutputBatchBytes
+// set, one batch of up to that much plus a read, so the backlog this allows in
+// bytes grows with both: 4 MiB at the 4 KiB default read size, enough to ride
+// out bursts like cat on a large file.
+const clientQueueSize = 1024
+
+// DefaultWriteTimeout bounds a single write to a client when
+// PoolConfig.WriteTimeout is unset, so a connection that stopped reading
+// without closing, e.g. a half-open TCP connection, doesn't pin its writer
+// forever.
+const DefaultWriteTimeout = 10 * time.Second
+
+// client is a connected WebSocket with its own output queue. A writer
+// goroutine drains the queue, so a slow connection only delays itself
+// instead of every client of the session.
+type client struct {
+	conn *websocket.Conn
+	id   string
+	send chan outFrame // closed when the client is removed from the session
+
+	// Close frame the writer sends once the queue is drained, if closeCode
+	// is non-zero. Set before send is closed.
+	closeCode    int
+	closeMessage string
+}
+
+// newClient starts the writer for conn. The session must hold clientsMu
+// until the client is in its maps, and closes send only while removing it
+// from them, so a broadcast never queues to a closed channel.
+func (s *Session) newClient(conn *websocket.Conn, clientID string) *client {
+	c := &client{conn: conn, id: clientID, send: make(chan outFrame, clientQueueSize)}
+	go s.writeClient(c)
+	return c
+}
+
+// queue adds a frame to the client's queue without blocking. Reports false
+// if the queue is full.
+func (c *client) queue(frame outFrame) bool {
+	frame.chunk.retain()
+	select {
+	case c.send <- frame:
+		return true
+	default:
+		frame.chunk.release()
+		return false
+	}
+}
+
+// finish stops the client once the frames already queued are written, then
+// sends a close frame with closeCode. Must be called with the session's
+// clientsMu held, after removing the client from its maps.
+func (c *client) finish(closeCode int, closeMessage string) {
+	c.closeCode = closeCode
+	c.closeMessage = closeMessage
+	close(c.send)
+}
+
+// drop stops the client right away, discarding anything still queued. Must
+// be called with the session's clientsMu held, after removing the client from
+// its maps; the connection is then closed with closeConn once clientsMu is
+// released, since sending the close frame may block.
+func (c *client) drop() {
+	close(c.send)
+}
+
+// closeConn sends a close frame with closeCode, if non-zero, and closes the
+// connection. It may block for up to closeFrameTimeout.
+func (c *client) closeConn(closeCode int, closeMessage string) {
+	if closeCode != 0 {
+		// WriteControl is safe to call concurrently with the writer
+		c.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(closeCode, closeMessage),
+			time.Now().Add(closeFrameTimeout))
+	}
+	c.conn.Close()
+}
+
+// WriteTimeout returns how long a single write to a client may take before
+// the client is disconnected.
+func (s *Session) WriteTimeout() time.Duration {
+	return s.writeTimeout
+}
+
+// writeClient writes the client's queued frames until the queue is closed.
+// A failed write, including one that hit the write timeout, closes the
+// connection, which ends the client's read loop and so removes it from the
+// session.
+func (s *Session) writeClient(c *client) {
+	defer c.conn.Close()
+	for frame := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+		err := c.conn.WriteMessage(frame.messageType, frame.data)
+		frame.chunk.release()
+		if err != nil {
+			s.metrics.writeFailures.Add(1)
+			s.prom.writeFailures.Inc()
+			slog.Debug("WebSocket write failed", "id", s.ID, "clientId", c.id, "error", err)
+			c.conn.Close()
+			// Discard the rest until the session removes the client
+			for frame := range c.send {
+				frame.chunk.release()
+			}
+			return
+		}
+	}
+	if c.closeCode != 0 {
+		c.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(c.closeCode, c.closeMessage),
+			time.Now().Add(closeFrameTimeout))
+	}
+}
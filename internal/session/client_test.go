@@ -0,0 +1,70 @@
+package session
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWriteTimeoutDropsStalledClient(t *testing.T) {
+	p := testPool(t, PoolConfig{WriteTimeout: 200 * time.Millisecond})
+	sess, err := p.Create(CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if got := sess.WriteTimeout(); got != 200*time.Millisecond {
+		t.Fatalf("WriteTimeout() = %s, want the pool's 200ms", got)
+	}
+	// The far end of this connection never reads
+	stalled, _ := wsPair(t)
+	if err := sess.AddClient(stalled, "stalled"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+
+	// Far more than the socket buffers hold, in few enough frames to stay
+	// inside the client's queue, so the write blocks rather than the queue
+	// overflowing
+	big := bytes.Repeat([]byte("x"), 1<<20)
+	for i := 0; i < 64; i++ {
+		sess.sendFrame(websocket.BinaryMessage, big)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for sess.Metrics().WriteFailures == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the stalled client's writer never timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := sess.Metrics().WriteFailures; n != 1 {
+		t.Errorf("WriteFailures = %d, want 1", n)
+	}
+	// The writer closed the connection, which ends the client's read loop
+	// and so removes it; stand in for that loop here
+	stalled.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := stalled.ReadMessage(); err == nil {
+		t.Error("stalled client's connection still open")
+	}
+	sess.RemoveClient(stalled)
+
+	// The session survives and serves the next client
+	if sess.IsClosed() {
+		t.Fatal("session closed along with the stalled client")
+	}
+	server, conn := wsPair(t)
+	if err := sess.AddClient(server, "next"); err != nil {
+		t.Fatalf("AddClient after the timeout: %v", err)
+	}
+	sess.sendFrame(websocket.BinaryMessage, []byte("still here"))
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if kind == websocket.BinaryMessage && bytes.Contains(data, []byte("still here")) {
+			break
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package session
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ControlMessage is a JSON control frame sent to clients as a WebSocket text
+// message. Raw PTY output is always sent as binary messages, so clients can
+// tell the two apart by frame type.
+type ControlMessage struct {
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"`        // session: ID of the session created for this connection
+	SessionID string `json:"sessionId,omitempty"` // ready: ID of the session the client joined
+	Attempt   int    `json:"attempt,omitempty"`   // restart: restart number, starting at 1
+	ExitCode  int    `json:"exitCode,omitempty"`  // restart: exit code of the failed command
+	Cols      uint16 `json:"cols,omitempty"`      // session, ready, size-clamped: terminal size in effect
+	Rows      uint16 `json:"rows,omitempty"`
+	Code      *int   `json:"code,omitempty"`     // exit: exit code, unless unknown or killed by a signal
+	Signal    string `json:"signal,omitempty"`   // exit: signal that killed the command
+	Grace     int    `json:"grace,omitempty"`    // shutdown: seconds until sessions are closed
+	Data      string `json:"data,omitempty"`     // paste, input: text to write
+	ClientID  string `json:"clientId,omitempty"` // ready: ID to reconnect with to resume sequenced input
+	Seq       uint64 `json:"seq,omitempty"`      // input, input-ack: input number; ready: last input written for the client ID
+}
+
+// ControlPrefix starts a client text frame that carries a control message
+// instead of input: the byte is followed by the JSON message. A lone NUL, as
+// typed with Ctrl-Space, is still input.
+const ControlPrefix = 0x00
+
+// ControlTypeResize is sent by clients to resize the terminal, with Cols and
+// Rows.
+const ControlTypeResize = "resize"
+
+// ParseClientControl returns the control message carried by a client frame,
+// or false if the frame is input.
+func ParseClientControl(messageType int, data []byte) (ControlMessage, bool) {
+	var msg ControlMessage
+	if messageType != websocket.TextMessage || len(data) < 2 || data[0] != ControlPrefix || data[1] != '{' {
+		return msg, false
+	}
+	if err := json.Unmarshal(data[1:], &msg); err != nil {
+		return msg, false
+	}
+	return msg, true
+}
+
+// ControlTypeBell signals that the PTY rang the terminal bell.
+const ControlTypeBell = "bell"
+
+// ControlTypeSession announces the session ID on a create-and-connect
+// WebSocket. It is always the first message.
+const ControlTypeSession = "session"
+
+// ControlTypeReady tells a client it joined the session and input is
+// accepted, with the terminal size in effect, which may differ from the size
+// the client asked for. It is the first message the session sends a client,
+// following the session message on a create-and-connect WebSocket.
+const ControlTypeReady = "ready"
+
+// readyFrame returns the ready control message for a client joining with
+// clientID. It reads the size under ptyMu, so it must be called without
+// clientsMu held.
+func (s *Session) readyFrame(clientID string) outFrame {
+	s.ptyMu.Lock()
+	msg := ControlMessage{Type: ControlTypeReady, SessionID: s.ID, Cols: s.Cols, Rows: s.Rows}
+	s.ptyMu.Unlock()
+	msg.ClientID = clientID
+	msg.Seq = s.inputSeq(clientID)
+	payload, _ := json.Marshal(msg)
+	return outFrame{messageType: websocket.TextMessage, data: payload}
+}
+
+// broadcastControl sends a control message to all connected clients. It
+// must run on the broadcast goroutine; use sendControl from anywhere else.
+func (s *Session) broadcastControl(msg ControlMessage) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.broadcastFrame(outFrame{messageType: websocket.TextMessage, data: payload})
+}
+
+// sendControlWait queues a control message like sendControl and waits up to
+// timeout for it to reach every client's queue, e.g. before the clients are
+// disconnected.
+func (s *Session) sendControlWait(msg ControlMessage, timeout time.Duration) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	sent := make(chan struct{})
+	expired := time.After(timeout)
+	select {
+	case s.outbox <- outFrame{messageType: websocket.TextMessage, data: payload, sent: sent}:
+	case <-s.done:
+		return
+	case <-expired:
+		return
+	}
+	select {
+	case <-sent:
+	case <-s.done:
+	case <-expired:
+	}
+}
+
+// sendControl queues a control message for all clients from outside the
+// broadcast goroutine.
+func (s *Session) sendControl(msg ControlMessage) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.sendFrame(websocket.TextMessage, payload)
+}
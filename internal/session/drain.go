@@ -0,0 +1,68 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// ErrDraining is returned by Create once Drain has started.
+var ErrDraining = errors.New("server is shutting down")
+
+// ControlTypeShutdown warns clients that the server is shutting down, with
+// Grace seconds until their sessions are closed.
+const ControlTypeShutdown = "shutdown"
+
+// drainPollInterval is how often Drain checks whether clients have left.
+const drainPollInterval = 250 * time.Millisecond
+
+// Drain prepares the pool for shutdown: it stops creating sessions, warns
+// connected clients with a shutdown control message, and waits until every
+// client has disconnected or ctx is done. Sessions are left open; the caller
+// closes or detaches them afterwards.
+func (p *Pool) Drain(ctx context.Context) {
+	p.mu.Lock()
+	p.draining = true
+	sessions := make([]*Session, 0, len(p.sessions))
+	for _, s := range p.sessions {
+		sessions = append(sessions, s)
+	}
+	p.mu.Unlock()
+
+	msg := ControlMessage{Type: ControlTypeShutdown}
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Grace = int(time.Until(deadline).Round(time.Second) / time.Second)
+	}
+	for _, s := range sessions {
+		s.sendControl(msg)
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		clients := 0
+		for _, s := range sessions {
+			if !s.IsClosed() {
+				clients += s.ClientCount()
+			}
+		}
+		if clients == 0 {
+			slog.Info("All clients disconnected")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("Shutdown grace period expired", "clients", clients)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Draining reports whether Drain has started.
+func (p *Pool) Draining() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.draining
+}
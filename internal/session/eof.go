@@ -0,0 +1,26 @@
+package session
+
+import "github.com/itsmylife44/terminus-pty/internal/pty"
+
+// ControlTypeEOF is sent by clients to signal end of input to the command.
+const ControlTypeEOF = "eof"
+
+// SendEOF signals end of input to the command by typing the terminal's EOF
+// character. A PTY has no half-close, so this is what Ctrl-D does: in
+// canonical mode a read at the start of a line returns 0 bytes, which
+// programs take as end of input, and the terminal stays usable for whatever
+// reads next. After a partial line, the first EOF only submits that line.
+// Raw-mode programs receive the character as input. tmux sessions always
+// type Ctrl-D, since the PTY's settings are those of the tmux client, not of
+// the pane.
+func (s *Session) SendEOF() error {
+	p := s.currentPTY()
+	if p == nil {
+		return ErrSessionClosed
+	}
+	eof := byte(pty.DefaultEOF)
+	if !p.IsTmux() {
+		eof = p.EOFChar()
+	}
+	return s.Write([]byte{eof})
+}
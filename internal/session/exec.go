@@ -0,0 +1,87 @@
+package session
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+
+	"github.com/itsmylife44/terminus-pty/internal/pty"
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
+)
+
+// ControlTypeExec signals that the session's command was replaced by Exec.
+// Clients may want to reset their terminal state.
+const ControlTypeExec = "exec"
+
+// ExecOptions describes the command Exec starts in place of the current one.
+type ExecOptions struct {
+	Command string
+	Args    []string
+	Workdir string            // defaults to the current command's workdir
+	Env     map[string]string // merged over the current command's environment
+}
+
+// Exec terminates the session's command and starts another in the same
+// terminal, keeping the session ID, size and connected clients. For tmux
+// sessions the pane is respawned; for direct sessions a new PTY is swapped
+// in. A restart policy applies to the new command from then on, with its
+// retries counted afresh.
+func (s *Session) Exec(opts ExecOptions) error {
+	if _, err := exec.LookPath(opts.Command); err != nil {
+		return fmt.Errorf("command not found: %s", opts.Command)
+	}
+	args := ShellDefaultArgs(opts.Command, opts.Args)
+
+	s.ptyMu.Lock()
+	if s.IsClosed() {
+		s.ptyMu.Unlock()
+		return ErrSessionClosed
+	}
+	wd := opts.Workdir
+	if wd == "" {
+		wd = s.workdir
+	}
+	env := mergeEnv(s.env, opts.Env)
+
+	var old *pty.PTY
+	if s.TmuxSessionName != "" {
+		if err := tmux.RespawnPane(s.TmuxSessionName, opts.Command, args, wd, envList(env), s.tmuxTerm); err != nil {
+			s.ptyMu.Unlock()
+			return err
+		}
+	} else {
+		next, err := spawnDirect(opts.Command, args, s.Cols, s.Rows, wd, envList(env), s.lineMode)
+		if err != nil {
+			s.ptyMu.Unlock()
+			return classifySpawnError(s.ID, err)
+		}
+		var prevDone chan struct{}
+		old, prevDone = s.PTY, s.readerDone
+		done := make(chan struct{})
+		s.PTY, s.readerDone = next, done
+		go func() {
+			<-prevDone
+			s.readPTY(next, done)
+		}()
+
+		if s.restarter != nil {
+			s.restarter.spawn = func(cols, rows uint16) (*pty.PTY, error) {
+				return spawnDirect(opts.Command, args, cols, rows, wd, envList(env), s.lineMode)
+			}
+			// The new command gets its own retries
+			s.restarter.attempts = 0
+		}
+	}
+	s.Command, s.Args = opts.Command, args
+	s.workdir, s.env = wd, env
+	s.ptyMu.Unlock()
+
+	// Closing the old PTY kills its command; its reader sees the swap and exits
+	if old != nil {
+		old.Close()
+	}
+
+	slog.Info("Session command replaced", "id", s.ID, "command", opts.Command, "args", args, "workdir", wd)
+	s.sendControl(ControlMessage{Type: ControlTypeExec})
+	return nil
+}
@@ -0,0 +1,126 @@
+package session
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readUntil reads frames from conn until done reports true for the output
+// and control messages seen so far.
+func readUntil(t *testing.T, conn *websocket.Conn, done func(out string, controls []ControlMessage) bool) (string, []ControlMessage) {
+	t.Helper()
+	var out strings.Builder
+	var controls []ControlMessage
+	for !done(out.String(), controls) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v (output %q, controls %+v)", err, out.String(), controls)
+		}
+		if kind == websocket.BinaryMessage {
+			out.Write(data)
+			continue
+		}
+		var msg ControlMessage
+		if err := json.Unmarshal(data, &msg); err == nil {
+			controls = append(controls, msg)
+		}
+	}
+	return out.String(), controls
+}
+
+// hasControl reports whether controls include one of type typ.
+func hasControl(controls []ControlMessage, typ string) bool {
+	for _, msg := range controls {
+		if msg.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func TestExecSwapsCommand(t *testing.T) {
+	p := testPool(t, PoolConfig{})
+	sess, err := p.Create(CreateOptions{Command: "/bin/sh", Args: []string{"-c", "sleep 0.2; echo first-command; exec cat"}, Cols: 100, Rows: 30})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	server, conn := wsPair(t)
+	if err := sess.AddClient(server, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+	readUntil(t, conn, func(out string, _ []ControlMessage) bool { return strings.Contains(out, "first-command") })
+	old := sess.currentPTY()
+
+	err = sess.Exec(ExecOptions{Command: "/bin/sh", Args: []string{"-c", "echo second-command $(stty size); exec cat"}})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	// Same session, same client and terminal size, new command
+	out, _ := readUntil(t, conn, func(out string, controls []ControlMessage) bool {
+		return hasControl(controls, ControlTypeExec) && strings.Contains(out, "second-command 30 100")
+	})
+	if strings.Contains(out, "first-command") {
+		t.Errorf("old command's output after the swap: %q", out)
+	}
+	if got, ok := p.Get(sess.ID); !ok || got != sess {
+		t.Error("session not in the pool under its ID after Exec")
+	}
+	if sess.Command != "/bin/sh" || !strings.Contains(strings.Join(sess.Args, " "), "second-command") {
+		t.Errorf("command = %s %q, want the new one", sess.Command, sess.Args)
+	}
+	if old.Cmd.Process.Signal(syscall.Signal(0)) == nil {
+		t.Error("old command still running")
+	}
+	if sess.IsClosed() {
+		t.Fatal("session closed by the swap")
+	}
+
+	// Input goes to the new command
+	if err := sess.Write([]byte("still-here\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	readUntil(t, conn, func(out string, _ []ControlMessage) bool { return strings.Count(out, "still-here") == 2 })
+}
+
+func TestExecResetsRestartAttempts(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	p := testPool(t, PoolConfig{RestartMaxRetries: 1, RestartBackoff: 10 * time.Millisecond})
+	// Fails once, then runs fine after the restart
+	sess, err := p.Create(CreateOptions{
+		Command:       "/bin/sh",
+		Args:          []string{"-c", "if [ -e " + marker + " ]; then exec cat; fi; touch " + marker + "; exit 1"},
+		RestartPolicy: RestartOnFailure,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	server, conn := wsPair(t)
+	if err := sess.AddClient(server, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+	readUntil(t, conn, func(_ string, controls []ControlMessage) bool { return hasControl(controls, ControlTypeRestart) })
+
+	// The only retry is used up, but the new command gets its own
+	if err := sess.Exec(ExecOptions{Command: "/bin/sh", Args: []string{"-c", "sleep 0.2; exit 1"}}); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	_, controls := readUntil(t, conn, func(_ string, controls []ControlMessage) bool {
+		return hasControl(controls, ControlTypeRestart) || hasControl(controls, ControlTypeExit)
+	})
+	for _, msg := range controls {
+		if msg.Type == ControlTypeExit {
+			t.Fatal("new command was not restarted after Exec")
+		}
+		if msg.Type == ControlTypeRestart && msg.Attempt != 1 {
+			t.Errorf("restart attempt %d after Exec, want 1", msg.Attempt)
+		}
+	}
+}
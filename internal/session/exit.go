@@ -0,0 +1,155 @@
+package session
+
+import (
+	"log/slog"
+	"syscall"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/pty"
+)
+
+// exitTailBytes is how much of the final output an ExitStatus keeps.
+const exitTailBytes = 4096
+
+// drainTimeout bounds how long a session whose command exited waits for its
+// remaining output to be broadcast before closing.
+const drainTimeout = time.Second
+
+// ControlTypeExit is sent to clients when the session's command exits on its
+// own, just before they are disconnected with CloseCode4003.
+const ControlTypeExit = "exit"
+
+// ExitStatus records how a direct session's command ended on its own. The
+// pool keeps it for PoolConfig.ExitedTTL after the session closes, so
+// clients can poll for the result of a one-shot command.
+type ExitStatus struct {
+	Code              int    // -1 if it could not be determined or a signal killed the command
+	Signal            string // signal that killed the command, e.g. "SIGKILL"
+	ExitedAt          time.Time
+	Output            []byte   // tail of the final output, if the session kept history
+	Recording         string   // cast file path, if the session was recorded
+	RecordingSegments []string // cast files of a rotated recording, in order
+	TmuxGone          bool     // a tmux session whose tmux session ended; Code is -1
+}
+
+// exitWaitTimeout bounds how long readPTY waits for the command to exit
+// once the PTY has closed, in case it detached from the terminal and kept
+// running. Closing the session kills it.
+const exitWaitTimeout = 5 * time.Second
+
+// commandExit waits for a direct session's command to exit and returns how
+// it exited, with code -1 if it doesn't exit within exitWaitTimeout. tmux
+// sessions return -1: the process behind the PTY is the tmux client, whose
+// exit status says nothing about the command.
+func commandExit(p *pty.PTY) pty.ExitStatus {
+	if p.IsTmux() {
+		return pty.ExitStatus{Code: -1}
+	}
+	exits := make(chan pty.ExitStatus, 1)
+	go func() { exits <- p.Wait() }()
+	select {
+	case exit := <-exits:
+		return exit
+	case <-time.After(exitWaitTimeout):
+		return pty.ExitStatus{Code: -1}
+	}
+}
+
+// signalName returns the API name of sig, e.g. "SIGKILL", falling back to
+// its description for signals the API doesn't accept.
+func signalName(sig syscall.Signal) string {
+	for name, s := range signals {
+		if s == sig {
+			return name
+		}
+	}
+	return sig.String()
+}
+
+// finishExit handles a command that exited by itself: it waits for output
+// already read from the PTY to be broadcast, records the exit status, tells
+// clients how the command exited and disconnects them with CloseCode4003.
+// tmux sessions whose tmux session ended are handled by finishTmuxGone
+// instead. The caller closes the session.
+func (s *Session) finishExit(exit pty.ExitStatus) {
+	s.drainOutput()
+	if s.tmuxGone() {
+		s.finishTmuxGone()
+		return
+	}
+	s.recordExit(exit)
+
+	msg := ControlMessage{Type: ControlTypeExit}
+	// The tmux client's exit status says nothing about the command
+	if s.TmuxSessionName == "" {
+		if exit.Code >= 0 {
+			msg.Code = &exit.Code
+		}
+		if exit.Signal != 0 {
+			msg.Signal = signalName(exit.Signal)
+		}
+	}
+	s.sendControlWait(msg, drainTimeout)
+	s.DisconnectAllClients(CloseCode4003, "command exited")
+}
+
+// recordExit stores the exit status of a direct session whose command exited
+// by itself. Output must have been drained first, so the recorded tail is
+// complete.
+func (s *Session) recordExit(exit pty.ExitStatus) {
+	if s.TmuxSessionName != "" || s.IsClosed() {
+		return
+	}
+
+	status := &ExitStatus{Code: exit.Code, ExitedAt: time.Now(), Recording: s.RecordingPath(), RecordingSegments: s.RecordingSegments()}
+	if exit.Signal != 0 {
+		status.Signal = signalName(exit.Signal)
+	}
+	if s.spool != nil {
+		tail, err := s.spool.ReadTail(exitTailBytes)
+		if err != nil {
+			slog.Warn("Failed to read spool", "id", s.ID, "error", err)
+		}
+		status.Output = tail
+	} else if s.scrollback != nil {
+		tail := s.scrollback.Bytes()
+		if len(tail) > exitTailBytes {
+			tail = tail[len(tail)-exitTailBytes:]
+		}
+		status.Output = tail
+	}
+
+	s.clientsMu.Lock()
+	s.exitStatus = status
+	s.clientsMu.Unlock()
+	slog.Info("Command exited", "id", s.ID, "command", s.Command, "exit_code", exit.Code, "signal", status.Signal)
+}
+
+// drainOutput queues an end-of-output marker behind the pending output and
+// waits for the broadcast goroutine to reach it.
+func (s *Session) drainOutput() {
+	timeout := time.After(drainTimeout)
+	select {
+	case s.broadcast <- nil:
+	case <-s.done:
+		return
+	case <-timeout:
+		return
+	}
+	select {
+	case <-s.drained:
+	case <-s.done:
+	case <-timeout:
+	}
+}
+
+// ExitStatus returns how the session's command exited, if it exited on its
+// own or its tmux session ended.
+func (s *Session) ExitStatus() (ExitStatus, bool) {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	if s.exitStatus == nil {
+		return ExitStatus{}, false
+	}
+	return *s.exitStatus, true
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package session
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+// cpuTime returns the CPU time used by the test process so far.
+func cpuTime(t *testing.T) time.Duration {
+	t.Helper()
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		t.Fatalf("Getrusage: %v", err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+func TestIdleSessionsUseNoCPU(t *testing.T) {
+	if testing.Short() {
+		t.Skip("measures CPU over a second")
+	}
+	p := testPool(t, PoolConfig{})
+	for range 20 {
+		sess, err := p.Create(CreateOptions{Command: "/bin/cat"})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		server, _ := wsPair(t)
+		if err := sess.AddClient(server, "c"); err != nil {
+			t.Fatalf("AddClient: %v", err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The readers sleep in the read syscall; a spinning one alone would
+	// burn the whole second
+	const window = time.Second
+	before := cpuTime(t)
+	time.Sleep(window)
+	if used := cpuTime(t) - before; used > window/10 {
+		t.Errorf("20 idle sessions used %s of CPU in %s", used, window)
+	}
+}
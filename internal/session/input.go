@@ -0,0 +1,113 @@
+package session
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ControlTypeInput is sent by clients to write Data as input numbered Seq,
+// see WriteSequenced.
+const ControlTypeInput = "input"
+
+// ControlTypeInputAck is sent to a client once its sequenced input up to Seq
+// was written to the PTY.
+const ControlTypeInputAck = "input-ack"
+
+// inputState is the last sequenced input written for a client ID.
+type inputState struct {
+	seq  uint64
+	left time.Time // when the client disconnected, zero while connected
+}
+
+// WriteSequenced writes input numbered seq from the client with clientID on
+// conn, and acknowledges it to that client. Sequence numbers increase per
+// client ID; input numbered at or below the last one written is a resend of
+// input that already arrived, so it is acknowledged again but not written.
+// A client that reconnects with the same client ID within
+// PoolConfig.InputReplayWindow learns the last number written from its ready
+// message, so it can resend what was lost without typing anything twice.
+func (s *Session) WriteSequenced(conn *websocket.Conn, clientID string, seq uint64, data []byte) error {
+	s.inputMu.Lock()
+	st := s.inputStateLocked(clientID)
+	if st != nil && seq <= st.seq {
+		acked := st.seq
+		s.inputMu.Unlock()
+		if s.debug.Load() {
+			s.debugLog("Dropped resent input", "clientId", clientID, "seq", seq)
+		}
+		s.ackInput(conn, acked)
+		return nil
+	}
+	// Held while writing, so a reconnected client's resend can't overtake
+	// the same input still being written for its old connection
+	err := s.Write(data)
+	if err == nil && st != nil {
+		st.seq = seq
+		st.left = time.Time{}
+	}
+	s.inputMu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.ackInput(conn, seq)
+	return nil
+}
+
+// inputStateLocked returns the input state of clientID, creating it if
+// needed, after forgetting clients that left more than inputReplayWindow
+// ago. Returns nil if input isn't remembered across connections. Must be
+// called with inputMu held.
+func (s *Session) inputStateLocked(clientID string) *inputState {
+	if s.inputReplayWindow <= 0 || clientID == "" {
+		return nil
+	}
+	now := time.Now()
+	for id, st := range s.inputSeqs {
+		if !st.left.IsZero() && now.Sub(st.left) > s.inputReplayWindow {
+			delete(s.inputSeqs, id)
+		}
+	}
+	st, ok := s.inputSeqs[clientID]
+	if !ok {
+		if s.inputSeqs == nil {
+			s.inputSeqs = make(map[string]*inputState)
+		}
+		st = &inputState{}
+		s.inputSeqs[clientID] = st
+	}
+	return st
+}
+
+// inputSeq returns the last sequenced input written for clientID, or 0 if
+// there is none or it has been forgotten.
+func (s *Session) inputSeq(clientID string) uint64 {
+	s.inputMu.Lock()
+	defer s.inputMu.Unlock()
+	if st := s.inputStateLocked(clientID); st != nil {
+		return st.seq
+	}
+	return 0
+}
+
+// inputLeft starts the replay window of clientID's input state once its
+// client disconnected.
+func (s *Session) inputLeft(clientID string) {
+	s.inputMu.Lock()
+	defer s.inputMu.Unlock()
+	if st, ok := s.inputSeqs[clientID]; ok {
+		st.left = time.Now()
+	}
+}
+
+// ackInput queues an input-ack for seq to the client on conn, if it is still
+// attached.
+func (s *Session) ackInput(conn *websocket.Conn, seq uint64) {
+	payload, _ := json.Marshal(ControlMessage{Type: ControlTypeInputAck, Seq: seq})
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	if c, ok := s.clients[conn]; ok {
+		c.queue(outFrame{messageType: websocket.TextMessage, data: payload})
+	}
+}
@@ -0,0 +1,54 @@
+package session
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// metrics holds per-session counters. All fields are updated atomically so
+// the hot I/O paths never take a lock to record them.
+type metrics struct {
+	bytesIn     atomic.Int64 // client input written to the PTY
+	bytesOut    atomic.Int64 // output read from the PTY
+	resizes     atomic.Int64
+	reattaches  atomic.Int64
+	peakClients atomic.Int64
+
+	writeFailures atomic.Int64 // WebSocket writes that failed and dropped the client
+}
+
+// observeClients raises the peak client count to n if it is higher.
+func (m *metrics) observeClients(n int) {
+	for {
+		peak := m.peakClients.Load()
+		if int64(n) <= peak || m.peakClients.CompareAndSwap(peak, int64(n)) {
+			return
+		}
+	}
+}
+
+// Metrics is a point-in-time snapshot of a session's counters.
+type Metrics struct {
+	BytesIn        int64
+	BytesOut       int64
+	Uptime         time.Duration
+	ResizeCount    int64
+	ReattachCount  int64
+	PeakClients    int64
+	WriteFailures  int64
+	LastActivityAt time.Time
+}
+
+// Metrics returns a snapshot of the session's counters.
+func (s *Session) Metrics() Metrics {
+	return Metrics{
+		BytesIn:        s.metrics.bytesIn.Load(),
+		BytesOut:       s.metrics.bytesOut.Load(),
+		Uptime:         time.Since(s.CreatedAt),
+		ResizeCount:    s.metrics.resizes.Load(),
+		ReattachCount:  s.metrics.reattaches.Load(),
+		PeakClients:    s.metrics.peakClients.Load(),
+		WriteFailures:  s.metrics.writeFailures.Load(),
+		LastActivityAt: s.GetLastActivity(),
+	}
+}
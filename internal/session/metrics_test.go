@@ -0,0 +1,91 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionMetrics(t *testing.T) {
+	p := testPool(t, PoolConfig{})
+	sess, err := p.Create(CreateOptions{Command: "/bin/cat"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		server, _ := wsPair(t)
+		if err := sess.AddClient(server, id); err != nil {
+			t.Fatalf("AddClient: %v", err)
+		}
+	}
+
+	if err := sess.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	// The terminal's echo and cat's copy, each "hello\r\n"
+	deadline := time.Now().Add(5 * time.Second)
+	for sess.Metrics().BytesOut < 14 {
+		if time.Now().After(deadline) {
+			t.Fatalf("bytes out = %d, want 14", sess.Metrics().BytesOut)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, size := range [][2]uint16{{100, 30}, {120, 40}} {
+		if err := sess.Resize(size[0], size[1]); err != nil {
+			t.Fatalf("Resize: %v", err)
+		}
+	}
+
+	m := sess.Metrics()
+	if m.BytesIn != 6 {
+		t.Errorf("bytes in = %d, want 6", m.BytesIn)
+	}
+	if m.BytesOut != 14 {
+		t.Errorf("bytes out = %d, want 14", m.BytesOut)
+	}
+	if m.ResizeCount != 2 {
+		t.Errorf("resizes = %d, want 2", m.ResizeCount)
+	}
+	if m.PeakClients != 2 {
+		t.Errorf("peak clients = %d, want 2", m.PeakClients)
+	}
+	if m.ReattachCount != 0 || m.WriteFailures != 0 {
+		t.Errorf("reattaches = %d, write failures = %d, want none", m.ReattachCount, m.WriteFailures)
+	}
+	if m.Uptime <= 0 || m.LastActivityAt.IsZero() {
+		t.Errorf("uptime %s, last activity %s", m.Uptime, m.LastActivityAt)
+	}
+
+	// The peak stays when clients leave
+	sess.DisconnectAllClients(CloseCode4007, "test")
+	if m := sess.Metrics(); m.PeakClients != 2 {
+		t.Errorf("peak clients after disconnecting = %d, want 2", m.PeakClients)
+	}
+}
+
+func TestWriteFailureCounted(t *testing.T) {
+	p := testPool(t, PoolConfig{})
+	sess, err := p.Create(CreateOptions{Command: "/bin/cat"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	server, _ := wsPair(t)
+	if err := sess.AddClient(server, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+
+	// The next frame to this client fails to write
+	server.UnderlyingConn().Close()
+	if err := sess.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for sess.Metrics().WriteFailures == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("write failure not counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := sess.Metrics().WriteFailures; got != 1 {
+		t.Errorf("write failures = %d, want 1", got)
+	}
+}
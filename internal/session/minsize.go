@@ -0,0 +1,20 @@
+package session
+
+import "github.com/itsmylife44/terminus-pty/internal/pty"
+
+// ControlTypeSizeClamped tells clients that a requested size was below the
+// session's minimum and the minimum was applied instead.
+const ControlTypeSizeClamped = "size-clamped"
+
+// clampSize raises cols and rows to at least min. It reports whether either
+// was raised.
+func clampSize(cols, rows uint16, min pty.Size) (uint16, uint16, bool) {
+	clamped := false
+	if cols < min.Cols {
+		cols, clamped = min.Cols, true
+	}
+	if rows < min.Rows {
+		rows, clamped = min.Rows, true
+	}
+	return cols, rows, clamped
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/itsmylife44/terminus-pty/internal/pty"
+)
+
+func TestClampSize(t *testing.T) {
+	minSize := pty.Size{Cols: 10, Rows: 2}
+	for _, tt := range []struct {
+		cols, rows         uint16
+		wantCols, wantRows uint16
+		clamped            bool
+	}{
+		{1, 1, 10, 2, true},
+		{5, 40, 10, 40, true},
+		{80, 1, 80, 2, true},
+		{10, 2, 10, 2, false},
+		{80, 24, 80, 24, false},
+	} {
+		cols, rows, clamped := clampSize(tt.cols, tt.rows, minSize)
+		if cols != tt.wantCols || rows != tt.wantRows || clamped != tt.clamped {
+			t.Errorf("clampSize(%d, %d) = %d, %d, %v; want %d, %d, %v",
+				tt.cols, tt.rows, cols, rows, clamped, tt.wantCols, tt.wantRows, tt.clamped)
+		}
+	}
+	if cols, rows, clamped := clampSize(1, 1, pty.Size{}); cols != 1 || rows != 1 || clamped {
+		t.Errorf("without a minimum: %d, %d, %v", cols, rows, clamped)
+	}
+}
+
+func TestSizeClamped(t *testing.T) {
+	p := testPool(t, PoolConfig{MinSize: pty.Size{Cols: 10, Rows: 2}})
+	sess, err := p.Create(CreateOptions{Command: "/bin/cat", Cols: 1, Rows: 1})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if sess.Cols != 10 || sess.Rows != 2 {
+		t.Errorf("created at %dx%d, want 10x2", sess.Cols, sess.Rows)
+	}
+
+	server, conn := wsPair(t)
+	if err := sess.AddClient(server, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+	if err := sess.Resize(3, 1); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	_, controls := readUntil(t, conn, func(_ string, controls []ControlMessage) bool {
+		return hasControl(controls, ControlTypeSizeClamped)
+	})
+	for _, msg := range controls {
+		if msg.Type == ControlTypeSizeClamped && (msg.Cols != 10 || msg.Rows != 2) {
+			t.Errorf("clamp notice for %dx%d, want 10x2", msg.Cols, msg.Rows)
+		}
+	}
+	if sess.Cols != 10 || sess.Rows != 2 {
+		t.Errorf("resized to %dx%d, want 10x2", sess.Cols, sess.Rows)
+	}
+}
@@ -0,0 +1,48 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxNameLength is the longest session name accepted, in characters.
+const MaxNameLength = 100
+
+// ErrNameTooLong is returned by SanitizeName for names over MaxNameLength.
+var ErrNameTooLong = errors.New("session name too long")
+
+// SanitizeName prepares a human-friendly session name for storage: control
+// characters, which could mess up a terminal or log that shows the name, are
+// removed and surrounding whitespace is trimmed. Names need not be unique.
+func SanitizeName(name string) (string, error) {
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	if n := utf8.RuneCountInString(name); n > MaxNameLength {
+		return "", fmt.Errorf("%w: %d characters, at most %d allowed", ErrNameTooLong, n, MaxNameLength)
+	}
+	return name, nil
+}
+
+// Name returns the session's human-friendly name, or "" if it has none.
+func (s *Session) Name() string {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	return s.name
+}
+
+// SetName renames the session. The name should have been passed through
+// SanitizeName.
+func (s *Session) SetName(name string) {
+	s.clientsMu.Lock()
+	s.name = name
+	s.clientsMu.Unlock()
+	slog.Info("Session renamed", "id", s.ID, "name", name)
+}
@@ -0,0 +1,135 @@
+package session
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultReadBufferSize is how much PTY output a session reads at once when
+// PoolConfig.ReadBufferSize is unset.
+const DefaultReadBufferSize = 4096
+
+// chunk is a piece of PTY output in a pooled buffer. It is shared by every
+// client it is queued for, each holding a reference, and goes back to its
+// pool when the last one is released. Chunks that are never released, e.g.
+// queued to a client that was dropped, are left to the GC.
+type chunk struct {
+	buf  []byte
+	data []byte // the output, a prefix of buf unless unpooled
+	refs atomic.Int32
+	pool *sync.Pool // nil for unpooled chunks
+}
+
+// chunkPools holds a sync.Pool of buffers per size. Sizes come from the pool
+// config, so there are only ever a few.
+var chunkPools sync.Map // int -> *sync.Pool
+
+func chunkPool(size int) *sync.Pool {
+	if p, ok := chunkPools.Load(size); ok {
+		return p.(*sync.Pool)
+	}
+	p, _ := chunkPools.LoadOrStore(size, &sync.Pool{
+		New: func() any { return &chunk{buf: make([]byte, size)} },
+	})
+	return p.(*sync.Pool)
+}
+
+// getChunk returns an empty chunk from pool, holding one reference.
+func getChunk(pool *sync.Pool) *chunk {
+	c := pool.Get().(*chunk)
+	c.pool = pool
+	c.data = c.buf[:0]
+	c.refs.Store(1)
+	return c
+}
+
+// unpooled wraps output that isn't in a pooled buffer, e.g. because the
+// transcoder or redactor rewrote it.
+func unpooled(data []byte) *chunk {
+	return &chunk{data: data}
+}
+
+func (c *chunk) retain() {
+	if c != nil && c.pool != nil {
+		c.refs.Add(1)
+	}
+}
+
+func (c *chunk) release() {
+	if c != nil && c.pool != nil && c.refs.Add(-1) == 0 {
+		c.data = nil
+		c.pool.Put(c)
+	}
+}
+
+// configureOutput sets how much PTY output is read at once and, if batchSize
+// is positive, up to how much output already waiting to be broadcast is
+// merged into a single frame. Must be called before the session starts.
+func (s *Session) configureOutput(readSize, batchSize int) {
+	if readSize <= 0 {
+		readSize = DefaultReadBufferSize
+	}
+	s.readPool = chunkPool(readSize)
+	s.batchPool = nil
+	s.outputBatchBytes = 0
+	if batchSize > 0 {
+		// A batch stops growing once it reaches batchSize, so the last read
+		// merged into it may overshoot by up to one read buffer
+		s.batchPool = chunkPool(batchSize + readSize)
+		s.outputBatchBytes = batchSize
+	}
+}
+
+// coalesce merges output already waiting in the broadcast channel into out,
+// up to outputBatchBytes, so a burst goes out in fewer, larger frames
+// instead of one per read. Reports whether it reached the end-of-output
+// marker, which the caller must handle after broadcasting the batch.
+func (s *Session) coalesce(out *chunk) (*chunk, bool) {
+	batch := out
+	for len(batch.data) < s.outputBatchBytes {
+		var next *chunk
+		select {
+		case next = <-s.broadcast:
+		default:
+			return batch, false
+		}
+		if next == nil {
+			return batch, true
+		}
+		if batch == out {
+			batch = getChunk(s.batchPool)
+			batch.data = append(batch.data, out.data...)
+			out.release()
+		}
+		batch.data = append(batch.data, next.data...)
+		next.release()
+	}
+	return batch, false
+}
+
+// processOutput runs output through the transcoder and redactor, if any, and
+// broadcasts the result. It takes over the caller's reference to out.
+// Reports whether the redactor is holding output back.
+func (s *Session) processOutput(out *chunk) bool {
+	if s.transcoder == nil && s.redactor == nil {
+		s.broadcastToClients(out)
+		out.release()
+		return false
+	}
+
+	// Both rewrite output into new slices, so the buffer can go back at once
+	data := out.data
+	if s.transcoder != nil {
+		data = s.transcoder.Process(data)
+	}
+	pending := false
+	if s.redactor != nil && len(data) > 0 {
+		data = s.redactor.Process(data)
+		pending = s.redactor.Pending()
+	}
+	out.release()
+	if len(data) > 0 {
+		s.broadcastToClients(unpooled(data))
+	}
+	return pending
+}
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchmarkBroadcast pushes b.N reads of readSize bytes through the broadcast
+// goroutine to one client and reports the frames the client received.
+func benchmarkBroadcast(b *testing.B, readSize, batchSize int) {
+	server, conn := wsPair(b)
+	s := newSession("pty_bench", nil, 80, 24)
+	s.configureOutput(readSize, batchSize)
+	s.clientsMu.Lock()
+	s.clients[server] = s.newClient(server, "bench")
+	s.clientsMu.Unlock()
+	go s.broadcastLoop()
+	b.Cleanup(s.Close)
+
+	var received atomic.Int64
+	frames := 0
+	readDone := make(chan error, 1)
+	want := int64(b.N) * int64(readSize)
+	go func() {
+		for received.Load() < want {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				readDone <- err
+				return
+			}
+			frames++
+			received.Add(int64(len(data)))
+		}
+		readDone <- nil
+	}()
+
+	// Stay well inside the client's queue, so the benchmark measures
+	// throughput rather than slow-client disconnects
+	window := int64(clientQueueSize/2) * int64(readSize)
+	b.SetBytes(int64(readSize))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for int64(i)*int64(readSize)-received.Load() > window {
+			time.Sleep(10 * time.Microsecond)
+		}
+		out := getChunk(s.readPool)
+		out.data = out.buf[:readSize]
+		s.broadcast <- out
+	}
+	if err := <-readDone; err != nil {
+		b.Fatalf("read: %v", err)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(frames)/b.Elapsed().Seconds(), "frames/s")
+	b.ReportMetric(float64(frames)/float64(b.N), "frames/read")
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	b.Run("unbatched", func(b *testing.B) { benchmarkBroadcast(b, DefaultReadBufferSize, 0) })
+	b.Run("batched", func(b *testing.B) { benchmarkBroadcast(b, DefaultReadBufferSize, 64*1024) })
+	b.Run("read32k", func(b *testing.B) { benchmarkBroadcast(b, 32*1024, 0) })
+}
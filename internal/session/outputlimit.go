@@ -0,0 +1,77 @@
+package session
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ControlTypeOutputThrottled tells clients, once per session, that output
+// reached PoolConfig.MaxOutputRate and is being delivered more slowly.
+const ControlTypeOutputThrottled = "output-throttled"
+
+// outputBurst is how much output, in time at the full rate, the limiter
+// lets through at once before throttling, so short bursts such as a screen
+// redraw go out undelayed.
+const outputBurst = 100 * time.Millisecond
+
+// outputLimiter caps how fast a session's PTY output is read, as a token
+// bucket of bytes. While the reader waits, the PTY's buffer fills up and the
+// command blocks on its writes, so the limit slows down the command instead
+// of dropping output.
+type outputLimiter struct {
+	rate  float64 // bytes per second
+	burst float64 // bucket capacity in bytes
+
+	mu        sync.Mutex
+	tokens    float64 // may go negative: a read is taken whole, then paid off
+	last      time.Time
+	throttled bool // whether the limit has engaged yet
+}
+
+func newOutputLimiter(rate int64) *outputLimiter {
+	l := &outputLimiter{rate: float64(rate), last: time.Now()}
+	l.burst = l.rate * outputBurst.Seconds()
+	l.tokens = l.burst
+	return l
+}
+
+// take charges n bytes of output and returns how long the reader must wait
+// before reading more, and whether this is the first time it has to.
+func (l *outputLimiter) take(n int) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0, false
+	}
+	first := !l.throttled
+	l.throttled = true
+	return time.Duration(-l.tokens / l.rate * float64(time.Second)), first
+}
+
+// throttleOutput applies the output rate limit after n bytes were read from
+// the PTY, waiting until more may be read. Reports false if the session was
+// closed while waiting.
+func (s *Session) throttleOutput(n int) bool {
+	wait, first := s.outputLimiter.take(n)
+	if wait <= 0 {
+		return true
+	}
+	if first {
+		slog.Warn("Session output rate limit reached, throttling", "id", s.ID, "limit", int64(s.outputLimiter.rate))
+		s.sendControl(ControlMessage{Type: ControlTypeOutputThrottled})
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.done:
+		return false
+	}
+}
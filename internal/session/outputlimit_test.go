@@ -0,0 +1,80 @@
+package session
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxOutput is the most output a limiter at rate may let through in elapsed:
+// the full burst, the rate since, and one read taken whole.
+func maxOutput(rate int64, elapsed time.Duration, read int) float64 {
+	return float64(rate)*(outputBurst+elapsed).Seconds() + float64(read)
+}
+
+func TestOutputLimiterTake(t *testing.T) {
+	const rate, read = 64 * 1024, 4096
+	l := newOutputLimiter(rate)
+	start := time.Now()
+	total, throttled := 0, 0
+	for time.Since(start) < 500*time.Millisecond {
+		wait, first := l.take(read)
+		total += read
+		if first {
+			throttled++
+		}
+		time.Sleep(wait)
+	}
+	elapsed := time.Since(start)
+	if limit := maxOutput(rate, elapsed, read); float64(total) > limit {
+		t.Errorf("took %d bytes in %s, want at most %.0f", total, elapsed, limit)
+	}
+	if throttled != 1 {
+		t.Errorf("reported the first throttle %d times, want once", throttled)
+	}
+}
+
+func TestOutputRateCap(t *testing.T) {
+	const rate = 32 * 1024
+	p := testPool(t, PoolConfig{MaxOutputRate: rate})
+	// The pause lets the client join before output starts
+	sess, err := p.Create(CreateOptions{Command: "/bin/sh", Args: []string{"-c", "sleep 0.2; yes"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	server, conn := wsPair(t)
+	start := time.Now()
+	if err := sess.AddClient(server, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+
+	total, notified := 0, false
+	for time.Since(start) < time.Second {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		switch kind {
+		case websocket.BinaryMessage:
+			total += len(data)
+		case websocket.TextMessage:
+			var msg ControlMessage
+			if json.Unmarshal(data, &msg) == nil && msg.Type == ControlTypeOutputThrottled {
+				notified = true
+			}
+		}
+	}
+	elapsed := time.Since(start)
+	if limit := maxOutput(rate, elapsed, DefaultReadBufferSize); float64(total) > limit {
+		t.Errorf("delivered %d bytes in %s, want at most %.0f", total, elapsed, limit)
+	}
+	if total < rate/2 {
+		t.Errorf("delivered only %d bytes in %s, want output to keep flowing", total, elapsed)
+	}
+	if !notified {
+		t.Error("no output-throttled message")
+	}
+}
@@ -0,0 +1,30 @@
+package session
+
+import "bytes"
+
+// ControlTypePaste is sent by clients to paste Data into the terminal.
+const ControlTypePaste = "paste"
+
+var (
+	pasteStart = []byte("\x1b[200~")
+	pasteEnd   = []byte("\x1b[201~")
+)
+
+// Paste writes text to the PTY as a paste. With CreateOptions.BracketedPaste
+// it is wrapped in bracketed-paste sequences, so programs that enabled
+// bracketed paste take it as pasted text rather than typed keys, e.g. a
+// shell doesn't run each line as it arrives. Programs that didn't enable it
+// see the sequences as input, which is why wrapping is opt-in per session.
+func (s *Session) Paste(text string) error {
+	if !s.bracketedPaste {
+		return s.Write([]byte(text))
+	}
+	// An end sequence inside the text would end the paste early and let the
+	// rest run as typed input
+	data := bytes.ReplaceAll([]byte(text), pasteEnd, nil)
+	buf := make([]byte, 0, len(pasteStart)+len(data)+len(pasteEnd))
+	buf = append(buf, pasteStart...)
+	buf = append(buf, data...)
+	buf = append(buf, pasteEnd...)
+	return s.Write(buf)
+}
@@ -2,8 +2,13 @@ package session
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -13,106 +18,617 @@ import (
 	"github.com/rs/xid"
 )
 
+// IdleAction is what the cleanup loop does with a session that has been idle
+// for longer than its timeout.
+type IdleAction string
+
+const (
+	IdleActionWarn  IdleAction = "warn"  // Log a warning once per idle period
+	IdleActionClose IdleAction = "close" // Close the session
+)
+
+// EvictionPolicy is what a create does when PoolConfig.MaxSessions live
+// sessions already exist.
+type EvictionPolicy string
+
+const (
+	EvictReject EvictionPolicy = "reject" // Refuse the create (default)
+	EvictLRU    EvictionPolicy = "lru"    // Close the least recently active session without clients
+)
+
 type PoolConfig struct {
 	SessionTimeout      time.Duration
 	CleanupInterval     time.Duration
 	DefaultCommand      string
 	DefaultArgs         []string
 	DefaultWorkdir      string
+	WorkdirRoot         string            // Directory client-requested workdirs must lie within (empty = unrestricted)
+	FallbackCommand     string            // Command tried when the requested one fails to spawn (empty = none)
+	AllowedCommands     []string          // Commands sessions may run, as paths or names looked up in PATH (empty = any)
+	CommandWorkdirs     map[string]string // Default workdir per command path or basename ($VARS expanded)
+	Term                string            // TERM of the terminal clients render in (default: DefaultTerm)
+	ColorTerm           string            // COLORTERM for every session (default: DefaultColorTerm)
+	TmuxTerm            string            // TERM inside tmux panes, tmux's default-terminal (empty = tmux default)
+	Env                 map[string]string // Environment for every session, below profile and request env
 	TmuxEnabled         bool
 	MaxInactive         time.Duration // Max inactivity time for tmux session cleanup
 	TmuxCleanupInterval time.Duration // Interval for tmux cleanup goroutine
+	TmuxHistoryLimit    int           // tmux history-limit for new sessions (0 = tmux default)
+	TmuxStatusOff       bool          // Hide the tmux status bar in new sessions
+	TmuxReplayLines     int           // tmux pane history lines sent to connecting clients (0 = disabled)
+	DeleteKeepsTmux     bool          // Remove detaches from tmux instead of killing it
+	SpoolDir            string        // Directory for disk-spooled output (default: $TMPDIR/terminus-pty)
+	SpoolMaxBytes       int64         // Spool file size before rotation
+	SpoolReplayBytes    int64         // Bytes of spooled output replayed on connect (0 = all retained)
+	ScrollbackBytes     int           // Output kept in memory per direct session and replayed on connect (0 = disabled)
+	ReadBufferSize      int           // PTY output read at once (0 = DefaultReadBufferSize)
+	OutputBatchBytes    int           // Output waiting to be broadcast is merged into frames up to this size (0 = disabled)
+	BellEvents          bool          // Send a bell control message when output rings the bell
+	InputIdleTimeout    time.Duration // No client input for this long triggers InputIdleAction (0 = disabled)
+	InputIdleAction     IdleAction
+	OutputIdleTimeout   time.Duration // No PTY output for this long triggers OutputIdleAction (0 = disabled)
+	OutputIdleAction    IdleAction
+	IdleTimeout         time.Duration // No input or output for this long closes the session, even with clients attached (0 = disabled)
+	RedactPatterns      []*regexp.Regexp
+	RedactOverlap       int                 // Bytes held back between reads so matches split across reads are caught
+	OutputCharset       string              // Charset PTY output is converted from to UTF-8 (empty = pass through)
+	RestartMaxRetries   int                 // Restarts allowed per session with RestartOnFailure
+	RestartBackoff      time.Duration       // Delay before the first restart, doubled on each retry
+	VerifyResize        bool                // Read the PTY size back after resizing and retry once if it didn't stick
+	SingleWriter        bool                // Reject writing clients while another one is attached; observers may still join
+	WriteTimeout        time.Duration       // Bounds each WebSocket write; slower clients are disconnected (0 = DefaultWriteTimeout)
+	InputReplayWindow   time.Duration       // How long a client's last sequenced input number is kept after it disconnects (0 = not kept)
+	MaxOutputBytes      int64               // Terminate sessions after this much output (0 = unlimited)
+	MaxResizeRate       float64             // Resizes applied per second per session; excess are coalesced (0 = unlimited)
+	MaxOutputRate       int64               // Output bytes read per second per session; the command is slowed down beyond that (0 = unlimited)
+	Banner              string              // Shown to the first client of each session (empty = none)
+	CommandBanners      map[string]string   // Banner per command path or basename, overriding Banner
+	InitCommands        []string            // Typed into each new session once it starts
+	CommandSizes        map[string]pty.Size // Default terminal size per command path or basename
+	MinSize             pty.Size            // Smaller sizes are clamped up on create and resize
+	Profiles            map[string]Profile  // Named session defaults selectable per request
+	DefaultSessionID    string              // Well-known session ID whose tmux session is recovered and cleaned up like generated ones (empty = none)
+	ExitedTTL           time.Duration       // How long the exit status of sessions whose command exited is kept (0 = not kept)
+	MaxArgs             int                 // Args accepted per request (0 = unlimited)
+	MaxArgsBytes        int                 // Total length of args accepted per request (0 = unlimited)
+	RecordDir           string              // Directory sessions are recorded to as asciinema v2 cast files (empty = off)
+	RecordStore         RecordingStore      // Where sessions are recorded to, overriding RecordDir (nil = RecordDir)
+	RecordTimestamps    bool                // Add each event's wall-clock time to recordings as an extension field
+	RecordMaxBytes      int64               // Recording segment size that starts a new segment (0 = unlimited)
+	RecordMaxDuration   time.Duration       // Recording segment duration that starts a new segment (0 = unlimited)
+	MaxSessions         int                 // Live sessions allowed at once (0 = unlimited)
+	EvictionPolicy      EvictionPolicy      // What a create beyond MaxSessions does (empty = EvictReject)
 }
 
+// Terminal type advertised to commands when PoolConfig doesn't set one.
+// Clients are expected to render like xterm, e.g. with xterm.js.
+const (
+	DefaultTerm      = "xterm-256color"
+	DefaultColorTerm = "truecolor"
+)
+
+// Default terminal size when neither the request, its profile nor the
+// command's configured size sets one.
+const (
+	defaultCols = 80
+	defaultRows = 24
+)
+
+// CreateOptions holds the per-session parameters for Pool.Create.
+// Zero values fall back to the pool defaults.
+type CreateOptions struct {
+	ID      string // Fixed session ID (default: a generated pty_ ID)
+	Name    string // Human-friendly label, already sanitized with SanitizeName
+	Cols    uint16
+	Rows    uint16
+	Command string
+	Args    []string
+	Workdir string
+	Spool   bool              // Spool output to disk for replay on reconnect (direct sessions only)
+	Profile string            // Named Profile supplying defaults for unset fields
+	Env     map[string]string // Extra environment variables, overriding the profile's
+	Vars    map[string]string // Substituted into the profile's args; see Profile.Vars
+
+	FallbackCommand string // Tried when Command fails to spawn (default: PoolConfig.FallbackCommand)
+
+	RestartPolicy RestartPolicy // Respawn the command when it fails (direct sessions only)
+
+	InitCommands []string // Typed into the session once it starts (default: PoolConfig.InitCommands)
+
+	LineMode pty.LineMode // Terminal attributes applied after spawn (direct sessions only)
+
+	BracketedPaste bool // Wrap paste control messages in bracketed-paste sequences
+
+	MaxOutputBytes int64 // Terminate after this much output (default: PoolConfig.MaxOutputBytes)
+
+	OutputCharset string // Convert output from this charset to UTF-8 (default: PoolConfig.OutputCharset)
+
+	TmuxHistoryLimit int   // tmux history-limit (default: PoolConfig.TmuxHistoryLimit)
+	TmuxStatus       *bool // Show the tmux status bar (default: !PoolConfig.TmuxStatusOff)
+}
+
+// ErrLineModeTmux is returned when line mode options are requested for a
+// tmux session, whose command runs on tmux's terminal rather than ours.
+var ErrLineModeTmux = errors.New("line mode options are not supported for tmux sessions")
+
+// ErrTooManySessions is returned by Create when PoolConfig.MaxSessions live
+// sessions already exist.
+var ErrTooManySessions = errors.New("too many sessions")
+
 type Pool struct {
 	config   PoolConfig
 	sessions map[string]*Session
+	exited   map[string]exitedSession // tombstones of removed sessions whose command exited
+	pending  int                      // creates holding a reserved slot while they spawn
+	draining bool                     // set by Drain; no more sessions are created
 	mu       sync.RWMutex
 }
 
+// exitedSession is a tombstone kept after an exited session is removed.
+type exitedSession struct {
+	status    ExitStatus
+	expiresAt time.Time
+}
+
 func NewPool(config PoolConfig) *Pool {
 	return &Pool{
 		config:   config,
 		sessions: make(map[string]*Session),
+		exited:   make(map[string]exitedSession),
 	}
 }
 
-func (p *Pool) Create(cols, rows uint16, command string, args []string, workdir string) (*Session, error) {
-	cmd := command
+func (p *Pool) Create(opts CreateOptions) (*Session, error) {
+	if err := p.ValidateArgs(opts.Args); err != nil {
+		return nil, err
+	}
+	prof, err := p.profile(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, cmdArgs := opts.Command, opts.Args
+	if cmd == "" {
+		cmd = prof.Command
+		if len(cmdArgs) == 0 {
+			cmdArgs = prof.Args
+		}
+	}
+	if len(prof.Vars) > 0 && opts.Command == "" && len(opts.Args) == 0 {
+		if cmdArgs, err = expandArgs(cmdArgs, opts.Vars, prof.Vars); err != nil {
+			return nil, err
+		}
+		if err := p.ValidateArgs(cmdArgs); err != nil {
+			return nil, err
+		}
+	} else if len(opts.Vars) > 0 {
+		return nil, fmt.Errorf("%w: only a profile's own command and args take vars", ErrInvalidVars)
+	}
 	if cmd == "" {
 		cmd = p.config.DefaultCommand
 	}
+	if err := p.CheckCommand(cmd); err != nil {
+		return nil, err
+	}
 
-	cmdArgs := args
 	if len(cmdArgs) == 0 {
 		cmdArgs = p.config.DefaultArgs
 	}
-	// If still no args and command looks like a shell, use shell defaults
-	if len(cmdArgs) == 0 && (strings.HasSuffix(cmd, "sh") || strings.Contains(cmd, "/sh")) {
-		cmdArgs = []string{"-l", "-i"}
+	cmdArgs = ShellDefaultArgs(cmd, cmdArgs)
+
+	cmdSize, _ := lookupCommand(p.config.CommandSizes, cmd)
+	cols, rows := opts.Cols, opts.Rows
+	if cols == 0 {
+		cols = prof.Cols
+	}
+	if cols == 0 {
+		cols = cmdSize.Cols
+	}
+	if cols == 0 {
+		cols = defaultCols
+	}
+	if rows == 0 {
+		rows = prof.Rows
+	}
+	if rows == 0 {
+		rows = cmdSize.Rows
+	}
+	if rows == 0 {
+		rows = defaultRows
+	}
+	if c, r, clamped := clampSize(cols, rows, p.config.MinSize); clamped {
+		slog.Info("Requested size below minimum, clamped", "cols", cols, "rows", rows, "min_cols", p.config.MinSize.Cols, "min_rows", p.config.MinSize.Rows)
+		cols, rows = c, r
 	}
 
-	wd := workdir
+	wd, err := p.ResolveWorkdir(opts.Workdir)
+	if err != nil {
+		return nil, err
+	}
+	if wd == "" {
+		wd = p.commandWorkdir(cmd)
+	}
 	if wd == "" {
 		wd = p.config.DefaultWorkdir
 	}
+	if wd != "" {
+		// Configured workdirs are trusted but may have been removed since
+		if err := checkWorkdir(wd); err != nil {
+			return nil, err
+		}
+	}
 
-	id := "pty_" + xid.New().String()
-	var ptty *pty.PTY
-	var tmuxSessionName string
-	var err error
+	useTmux := p.config.TmuxEnabled
+	if prof.Tmux != nil {
+		useTmux = *prof.Tmux
+	}
+	envMap := mergeEnv(mergeEnv(p.baseEnv(useTmux), prof.Env), opts.Env)
+	env := envList(envMap)
+	if useTmux && !opts.LineMode.IsZero() {
+		return nil, ErrLineModeTmux
+	}
 
-	if p.config.TmuxEnabled {
-		// Spawn PTY inside tmux for persistence
+	tmuxOpts := tmux.SpawnOptions{
+		HistoryLimit: opts.TmuxHistoryLimit,
+		StatusOff:    p.config.TmuxStatusOff,
+		Env:          env,
+
+		DefaultTerminal: p.config.TmuxTerm,
+		ClientEnv:       p.clientEnv(),
+	}
+	if tmuxOpts.HistoryLimit == 0 {
+		tmuxOpts.HistoryLimit = p.config.TmuxHistoryLimit
+	}
+	if opts.TmuxStatus != nil {
+		tmuxOpts.StatusOff = !*opts.TmuxStatus
+	}
+
+	id := opts.ID
+	if id == "" {
+		id = "pty_" + xid.New().String()
+	}
+	var tmuxSessionName string
+	if useTmux {
 		tmuxSessionName = id // Use session ID as tmux session name
-		ptty, err = pty.SpawnWithTmux(tmuxSessionName, cmd, cmdArgs, cols, rows, wd)
-		if err != nil {
-			return nil, fmt.Errorf("tmux spawn failed: %w", err)
+	}
+
+	if err := p.reserveSlot(); err != nil {
+		return nil, err
+	}
+	reserved := true
+	defer func() {
+		if reserved {
+			p.releaseSlot()
 		}
-		slog.Info("Session created with tmux", "id", id, "tmux_session", tmuxSessionName, "command", cmd, "args", cmdArgs, "workdir", wd, "cols", cols, "rows", rows)
-	} else {
-		// Direct PTY spawn (existing behavior)
-		ptty, err = pty.Spawn(cmd, cmdArgs, cols, rows, wd)
-		if err != nil {
+	}()
+
+	ptty, err := p.spawn(id, tmuxSessionName, cmd, cmdArgs, cols, rows, wd, tmuxOpts)
+	if err != nil {
+		fallback := opts.FallbackCommand
+		if fallback == "" {
+			fallback = p.config.FallbackCommand
+		}
+		if fallback == "" || fallback == cmd || errors.Is(err, ErrResourcesExhausted) {
+			return nil, err
+		}
+		if allowErr := p.CheckCommand(fallback); allowErr != nil {
+			slog.Warn("Primary command failed and fallback is not allowed", "id", id, "command", cmd, "fallback", fallback, "error", err)
 			return nil, err
 		}
-		slog.Info("Session created", "id", id, "command", cmd, "args", cmdArgs, "workdir", wd, "cols", cols, "rows", rows)
+
+		slog.Warn("Primary command failed, trying fallback", "id", id, "command", cmd, "fallback", fallback, "error", err)
+		cmd = fallback
+		cmdArgs = ShellDefaultArgs(cmd, nil)
+		ptty, err = p.spawn(id, tmuxSessionName, cmd, cmdArgs, cols, rows, wd, tmuxOpts)
+		if err != nil {
+			return nil, fmt.Errorf("fallback command failed: %w", err)
+		}
 	}
 
-	session := NewSession(id, ptty, cols, rows)
+	if err := ptty.SetLineMode(opts.LineMode); err != nil {
+		ptty.Close()
+		return nil, fmt.Errorf("failed to set line mode: %w", err)
+	}
+
+	session := newSession(id, ptty, cols, rows)
 	session.TmuxSessionName = tmuxSessionName
+	session.Command = cmd
+	session.Args = cmdArgs
+	session.name = opts.Name
+	session.workdir = wd
+	session.env = envMap
+	session.timeout = prof.Timeout
+	if banner := p.commandBanner(cmd); banner != "" {
+		session.banner = terminalText(banner)
+	}
+	if err := p.configureSession(session, opts, useTmux); err != nil {
+		session.CloseWithTmux()
+		return nil, err
+	}
+
+	session.start()
 
 	p.mu.Lock()
 	p.sessions[id] = session
+	delete(p.exited, id)
+	p.pending--
+	reserved = false
 	p.mu.Unlock()
 
+	initCommands := opts.InitCommands
+	if len(initCommands) == 0 {
+		initCommands = p.config.InitCommands
+	}
+	session.typeInitCommands(initCommands)
+
 	return session, nil
 }
 
+// configureSession applies the pool configuration, and the options of a
+// create, to a session that hasn't started yet. Create and Adopt both use it,
+// so a session behaves the same whether it was created or recovered.
+func (p *Pool) configureSession(session *Session, opts CreateOptions, useTmux bool) error {
+	session.tmuxTerm = p.config.TmuxTerm
+	session.singleWriter = p.config.SingleWriter
+	if p.config.WriteTimeout > 0 {
+		session.writeTimeout = p.config.WriteTimeout
+	}
+	session.inputReplayWindow = p.config.InputReplayWindow
+	session.lineMode = opts.LineMode
+	session.bracketedPaste = opts.BracketedPaste
+	session.verifyResize = p.config.VerifyResize
+	session.configureOutput(p.config.ReadBufferSize, p.config.OutputBatchBytes)
+	session.minSize = p.config.MinSize
+	if p.config.MaxResizeRate > 0 {
+		session.resizeLimiter = &resizeLimiter{interval: time.Duration(float64(time.Second) / p.config.MaxResizeRate)}
+	}
+	if p.config.MaxOutputRate > 0 {
+		session.outputLimiter = newOutputLimiter(p.config.MaxOutputRate)
+	}
+	session.maxOutputBytes = opts.MaxOutputBytes
+	if session.maxOutputBytes == 0 {
+		session.maxOutputBytes = p.config.MaxOutputBytes
+	}
+
+	if p.config.BellEvents {
+		session.bell = &bellDetector{}
+	}
+	charset := opts.OutputCharset
+	if charset == "" {
+		charset = p.config.OutputCharset
+	}
+	if charset != "" {
+		enc, err := LookupCharset(charset)
+		if err != nil {
+			return err
+		}
+		session.transcoder = newTranscoder(enc)
+	}
+	if len(p.config.RedactPatterns) > 0 {
+		session.redactor = newRedactor(p.config.RedactPatterns, p.config.RedactOverlap)
+	}
+
+	if opts.Spool && !useTmux {
+		sp, err := newSpool(p.config.SpoolDir, session.ID, p.config.SpoolMaxBytes)
+		if err != nil {
+			return err
+		}
+		session.spool = sp
+		session.spoolReplayBytes = p.config.SpoolReplayBytes
+	} else if !useTmux && p.config.ScrollbackBytes > 0 {
+		session.scrollback = newScrollback(p.config.ScrollbackBytes)
+	} else if useTmux {
+		session.tmuxReplayLines = p.config.TmuxReplayLines
+	}
+	if store := p.recordStore(); store != nil {
+		rec, err := newRecorder(store, session.ID, session.Cols, session.Rows, recordOptions{
+			timestamps: p.config.RecordTimestamps,
+			maxBytes:   p.config.RecordMaxBytes,
+			maxAge:     p.config.RecordMaxDuration,
+		})
+		if err != nil {
+			return err
+		}
+		session.recorder = rec
+	}
+
+	if opts.RestartPolicy == RestartOnFailure && !useTmux {
+		cmd, args, wd, env, lineMode := session.Command, session.Args, session.workdir, envList(session.env), opts.LineMode
+		session.restarter = &restarter{
+			spawn: func(cols, rows uint16) (*pty.PTY, error) {
+				return spawnDirect(cmd, args, cols, rows, wd, env, lineMode)
+			},
+			maxRetries: p.config.RestartMaxRetries,
+			backoff:    p.config.RestartBackoff,
+		}
+	}
+	return nil
+}
+
+// reserveSlot counts a create against PoolConfig.MaxSessions before it
+// spawns, so concurrent creates can't all pass the check and then exceed the
+// limit. At the limit, EvictLRU frees a slot by closing the least recently
+// active session without clients. Create releases the slot when it inserts
+// the session or fails.
+func (p *Pool) reserveSlot() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.draining {
+		return ErrDraining
+	}
+	if p.config.MaxSessions > 0 {
+		live := p.pending
+		for _, s := range p.sessions {
+			if !s.IsClosed() {
+				live++
+			}
+		}
+		if live >= p.config.MaxSessions && !(p.config.EvictionPolicy == EvictLRU && p.evictLocked()) {
+			return fmt.Errorf("%w: limit is %d", ErrTooManySessions, p.config.MaxSessions)
+		}
+	}
+	p.pending++
+	return nil
+}
+
+// evictLocked closes and removes the least recently active live session
+// that has no clients or observers. Reports false if every session is in
+// use. Must be called with p.mu held.
+func (p *Pool) evictLocked() bool {
+	var victim *Session
+	var victimActivity time.Time
+	for _, s := range p.sessions {
+		if s.IsClosed() || s.ClientCount() > 0 {
+			continue
+		}
+		if activity := s.GetLastActivity(); victim == nil || activity.Before(victimActivity) {
+			victim, victimActivity = s, activity
+		}
+	}
+	if victim == nil {
+		return false
+	}
+	slog.Info("Evicting least recently active session for a new one", "id", victim.ID, "last_activity", victimActivity)
+	if p.config.DeleteKeepsTmux {
+		victim.Close()
+	} else {
+		victim.CloseWithTmux()
+	}
+	delete(p.sessions, victim.ID)
+	return true
+}
+
+func (p *Pool) releaseSlot() {
+	p.mu.Lock()
+	p.pending--
+	p.mu.Unlock()
+}
+
+// spawn starts cmd in a new PTY, inside the named tmux session when
+// tmuxSessionName is non-empty.
+func (p *Pool) spawn(id, tmuxSessionName, cmd string, cmdArgs []string, cols, rows uint16, wd string, tmuxOpts tmux.SpawnOptions) (*pty.PTY, error) {
+	if tmuxSessionName != "" {
+		// Spawn PTY inside tmux for persistence
+		ptty, err := pty.SpawnWithTmux(tmuxSessionName, cmd, cmdArgs, cols, rows, wd, tmuxOpts)
+		if err != nil {
+			// SpawnSession cleans up a session it created itself and never
+			// touches one that already existed under the name
+			return nil, fmt.Errorf("tmux spawn failed: %w", classifySpawnError(id, err))
+		}
+		slog.Info("Session created with tmux", "id", id, "tmux_session", tmuxSessionName, "command", cmd, "args", cmdArgs, "workdir", wd, "cols", cols, "rows", rows)
+		return ptty, nil
+	}
+
+	// Direct PTY spawn (existing behavior)
+	ptty, err := pty.Spawn(cmd, cmdArgs, cols, rows, wd, tmuxOpts.Env)
+	if err != nil {
+		return nil, classifySpawnError(id, err)
+	}
+	slog.Info("Session created", "id", id, "command", cmd, "args", cmdArgs, "workdir", wd, "cols", cols, "rows", rows)
+	return ptty, nil
+}
+
+// clientEnv returns the environment of the terminal clients render in: of
+// direct sessions' commands, and of the tmux client attached to tmux
+// sessions, which translates from the panes' terminal type to it.
+func (p *Pool) clientEnv() []string {
+	term, colorTerm := p.config.Term, p.config.ColorTerm
+	if term == "" {
+		term = DefaultTerm
+	}
+	if colorTerm == "" {
+		colorTerm = DefaultColorTerm
+	}
+	return []string{"TERM=" + term, "COLORTERM=" + colorTerm}
+}
+
+// baseEnv returns the environment every new session starts from, before
+// profile and request env. tmux sets TERM in its panes from TmuxTerm, so
+// tmux sessions only get COLORTERM.
+func (p *Pool) baseEnv(useTmux bool) map[string]string {
+	env := make(map[string]string, len(p.config.Env)+2)
+	for _, kv := range p.clientEnv() {
+		k, v, _ := strings.Cut(kv, "=")
+		if k == "TERM" && useTmux {
+			continue
+		}
+		env[k] = v
+	}
+	for k, v := range p.config.Env {
+		env[k] = v
+	}
+	return env
+}
+
+// spawnDirect starts cmd in a new direct PTY and applies lineMode to it.
+func spawnDirect(cmd string, cmdArgs []string, cols, rows uint16, wd string, env []string, lineMode pty.LineMode) (*pty.PTY, error) {
+	ptty, err := pty.Spawn(cmd, cmdArgs, cols, rows, wd, env)
+	if err != nil {
+		return nil, err
+	}
+	if err := ptty.SetLineMode(lineMode); err != nil {
+		ptty.Close()
+		return nil, fmt.Errorf("failed to set line mode: %w", err)
+	}
+	return ptty, nil
+}
+
+// commandWorkdir returns the configured default workdir for cmd, matched by
+// exact command first and then by basename, with env vars expanded.
+func (p *Pool) commandWorkdir(cmd string) string {
+	wd, ok := lookupCommand(p.config.CommandWorkdirs, cmd)
+	if !ok {
+		return ""
+	}
+	return os.ExpandEnv(wd)
+}
+
+// commandBanner returns the banner for cmd: its per-command banner if one is
+// configured, otherwise the global banner.
+func (p *Pool) commandBanner(cmd string) string {
+	if banner, ok := lookupCommand(p.config.CommandBanners, cmd); ok {
+		return banner
+	}
+	return p.config.Banner
+}
+
+// lookupCommand looks up a per-command setting by exact command first and
+// then by basename.
+func lookupCommand[V any](m map[string]V, cmd string) (V, bool) {
+	v, ok := m[cmd]
+	if !ok {
+		v, ok = m[filepath.Base(cmd)]
+	}
+	return v, ok
+}
+
 // ReattachTmux reattaches to an existing tmux session. Only works if TmuxEnabled.
 func (p *Pool) ReattachTmux(session *Session, cols, rows uint16) error {
 	if !p.config.TmuxEnabled || session.TmuxSessionName == "" {
-		return fmt.Errorf("session %s is not a tmux session", session.ID)
+		return fmt.Errorf("%w: %s", ErrNotTmux, session.ID)
 	}
 
 	// Check if tmux session still exists
 	if !tmux.SessionExists(session.TmuxSessionName) {
-		return fmt.Errorf("tmux session %s no longer exists", session.TmuxSessionName)
+		return fmt.Errorf("%w: %s", ErrTmuxSessionGone, session.TmuxSessionName)
 	}
 
 	// If PTY is already closed, reattach
 	if session.IsClosed() {
-		return fmt.Errorf("session is closed and cannot be reattached")
+		return ErrSessionClosed
 	}
 
 	// Create new PTY attachment to existing tmux session
-	ptty, err := pty.AttachTmux(session.TmuxSessionName, cols, rows)
+	ptty, err := pty.AttachTmux(session.TmuxSessionName, cols, rows, p.clientEnv())
 	if err != nil {
 		return fmt.Errorf("failed to reattach to tmux session: %w", err)
 	}
 
 	// Replace the PTY in the session
-	session.ReplacePTY(ptty)
+	if err := session.ReplacePTY(ptty); err != nil {
+		return fmt.Errorf("failed to reattach to tmux session: %w", err)
+	}
 
 	slog.Info("Reattached to tmux session", "id", session.ID, "tmux_session", session.TmuxSessionName)
 	return nil
@@ -128,14 +644,69 @@ func (p *Pool) Get(id string) (*Session, bool) {
 	return session, ok
 }
 
-func (p *Pool) Remove(id string) {
-	p.mu.Lock()
+// Exited returns the exit status of a session whose command exited by
+// itself, or whose tmux session ended, for PoolConfig.ExitedTTL after it
+// exited.
+func (p *Pool) Exited(id string) (ExitStatus, bool) {
+	if p.config.ExitedTTL <= 0 {
+		return ExitStatus{}, false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	if session, ok := p.sessions[id]; ok {
-		// Explicit DELETE should kill tmux session too
-		session.CloseWithTmux()
+		if !session.IsClosed() {
+			return ExitStatus{}, false
+		}
+		return session.ExitStatus()
+	}
+	tomb, ok := p.exited[id]
+	if !ok || time.Now().After(tomb.expiresAt) {
+		return ExitStatus{}, false
+	}
+	return tomb.status, true
+}
+
+// List returns the open sessions ordered by creation time, oldest first, so
+// repeated listings are stable.
+func (p *Pool) List() []*Session {
+	p.mu.RLock()
+	sessions := make([]*Session, 0, len(p.sessions))
+	for _, session := range p.sessions {
+		if !session.IsClosed() {
+			sessions = append(sessions, session)
+		}
+	}
+	p.mu.RUnlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions
+}
+
+// Remove closes and removes a session. Returns false if no such session exists.
+func (p *Pool) Remove(id string) bool {
+	return p.RemoveWithTmux(id, !p.config.DeleteKeepsTmux)
+}
+
+// RemoveWithTmux closes and removes a session, killing its tmux session if
+// killTmux is set and otherwise leaving it running detached.
+func (p *Pool) RemoveWithTmux(id string, killTmux bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	session, ok := p.sessions[id]
+	if ok {
+		if killTmux {
+			session.CloseWithTmux()
+		} else {
+			session.Close()
+		}
 		delete(p.sessions, id)
 	}
-	p.mu.Unlock()
+	return ok
 }
 
 func (p *Pool) StartCleanup(ctx context.Context) {
@@ -159,22 +730,58 @@ func (p *Pool) cleanup() {
 	now := time.Now()
 	var toRemove []string
 
+	for id, tomb := range p.exited {
+		if now.After(tomb.expiresAt) {
+			delete(p.exited, id)
+		}
+	}
+
 	for id, session := range p.sessions {
 		if session.IsClosed() {
+			if status, ok := session.ExitStatus(); ok && p.config.ExitedTTL > 0 {
+				p.exited[id] = exitedSession{status: status, expiresAt: status.ExitedAt.Add(p.config.ExitedTTL)}
+			}
 			toRemove = append(toRemove, id)
 			continue
 		}
 
 		if session.DisconnectedAt != nil && session.ClientCount() == 0 {
-			if now.Sub(*session.DisconnectedAt) > p.config.SessionTimeout {
+			timeout := p.config.SessionTimeout
+			if session.timeout > 0 {
+				timeout = session.timeout
+			}
+			if now.Sub(*session.DisconnectedAt) > timeout {
 				toRemove = append(toRemove, id)
 				slog.Info("Session expired", "id", id, "disconnected_for", now.Sub(*session.DisconnectedAt), "tmux", session.TmuxSessionName != "")
+				continue
 			}
 		}
+
+		if p.config.IdleTimeout > 0 {
+			last := session.LastInputAt()
+			if out := session.LastOutputAt(); out.After(last) {
+				last = out
+			}
+			if now.Sub(last) > p.config.IdleTimeout {
+				slog.Info("Session idle, closing", "id", id, "idle", "input and output", "idle_for", now.Sub(last), "clients", session.ClientCount())
+				session.DisconnectAllClients(CloseCode4004, "idle timeout")
+				toRemove = append(toRemove, id)
+				continue
+			}
+		}
+
+		if p.checkIdle(session, "input", session.LastInputAt(), &session.inputIdleWarnedAt, p.config.InputIdleTimeout, p.config.InputIdleAction, now) ||
+			p.checkIdle(session, "output", session.LastOutputAt(), &session.outputIdleWarnedAt, p.config.OutputIdleTimeout, p.config.OutputIdleAction, now) {
+			session.DisconnectAllClients(CloseCode4004, "idle timeout")
+			toRemove = append(toRemove, id)
+		}
 	}
 
 	for _, id := range toRemove {
 		if session, ok := p.sessions[id]; ok {
+			// No-op for sessions whose clients were already disconnected
+			// above with a more specific code
+			session.DisconnectAllClients(CloseCode4007, "session expired")
 			// Use CloseWithTmux to kill tmux sessions on timeout
 			session.CloseWithTmux()
 			delete(p.sessions, id)
@@ -182,11 +789,32 @@ func (p *Pool) cleanup() {
 	}
 }
 
+// checkIdle applies an idle policy to one activity timestamp. It returns true
+// if the session should be closed. Warnings are logged once per idle period:
+// warnedAt remembers the activity timestamp that was warned about.
+func (p *Pool) checkIdle(session *Session, kind string, last time.Time, warnedAt *time.Time, timeout time.Duration, action IdleAction, now time.Time) bool {
+	if timeout <= 0 || now.Sub(last) <= timeout {
+		return false
+	}
+
+	if action == IdleActionClose {
+		slog.Info("Session idle, closing", "id", session.ID, "idle", kind, "idle_for", now.Sub(last))
+		return true
+	}
+
+	if !warnedAt.Equal(last) {
+		*warnedAt = last
+		slog.Warn("Session idle", "id", session.ID, "idle", kind, "idle_for", now.Sub(last))
+	}
+	return false
+}
+
 func (p *Pool) CloseAll() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	for id, session := range p.sessions {
+		session.DisconnectAllClients(CloseCode4008, "server shutting down")
 		// On server shutdown, kill tmux sessions too
 		session.CloseWithTmux()
 		delete(p.sessions, id)
@@ -195,14 +823,47 @@ func (p *Pool) CloseAll() {
 	slog.Info("All sessions closed")
 }
 
+// DetachAll closes all sessions like CloseAll but leaves their tmux sessions
+// running. Clients are told the server is shutting down.
+func (p *Pool) DetachAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, session := range p.sessions {
+		session.DisconnectAllClients(CloseCode4008, "server shutting down")
+		session.Close()
+		delete(p.sessions, id)
+	}
+
+	slog.Info("All sessions detached")
+}
+
+// Config returns the pool configuration.
+func (p *Pool) Config() PoolConfig {
+	return p.config
+}
+
 func (p *Pool) Count() int {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	return len(p.sessions)
 }
 
+// TmuxCount returns how many of the pool's sessions are tmux-backed.
+func (p *Pool) TmuxCount() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	n := 0
+	for _, s := range p.sessions {
+		if s.TmuxSessionName != "" {
+			n++
+		}
+	}
+	return n
+}
+
 // StartTmuxCleanup starts the background goroutine that cleans up orphaned tmux sessions.
-// This cleans tmux sessions with "pty_" prefix that have no clients and exceed max-inactive.
+// This cleans tmux sessions with "pty_" prefix, or the default session's, that have no clients and exceed max-inactive.
 func (p *Pool) StartTmuxCleanup(ctx context.Context) {
 	if !p.config.TmuxEnabled {
 		return // No cleanup needed if tmux is disabled
@@ -229,10 +890,34 @@ func (p *Pool) StartTmuxCleanup(ctx context.Context) {
 	}
 }
 
+// isOrphanedTmux reports whether an untracked tmux session (e.g. left over
+// from a server restart, or detached by DELETE with keepTmux) should be
+// killed: nothing but our own stale attachments is attached to it, and it
+// has been inactive for longer than MaxInactive.
+func (p *Pool) isOrphanedTmux(tmuxSessionName string, ownPIDs map[int]bool, now time.Time) bool {
+	pids, err := tmux.SessionClientPIDs(tmuxSessionName)
+	if err != nil {
+		slog.Warn("Failed to list tmux clients", "session", tmuxSessionName, "error", err)
+		return false
+	}
+	for _, pid := range pids {
+		if !ownPIDs[pid] {
+			return false // someone is attached with their own tmux client
+		}
+	}
+
+	activity, err := tmux.SessionActivity(tmuxSessionName)
+	if err != nil {
+		slog.Warn("Failed to get tmux session activity", "session", tmuxSessionName, "error", err)
+		return false
+	}
+	return now.Sub(activity) > p.config.MaxInactive
+}
+
 // cleanupTmuxSessions checks for orphaned tmux sessions and kills them.
 func (p *Pool) cleanupTmuxSessions() {
-	// List all tmux sessions with our prefix
-	sessions, err := tmux.ListSessions("pty_")
+	// List all tmux sessions that are ours
+	sessions, err := p.TmuxSessions()
 	if err != nil {
 		slog.Error("Failed to list tmux sessions", "error", err)
 		return
@@ -246,6 +931,14 @@ func (p *Pool) cleanupTmuxSessions() {
 	var killed []string
 
 	p.mu.RLock()
+	// Our own tmux attachments count as clients in tmux, so collect their
+	// PIDs to tell them apart from users attached with their own tmux client.
+	ownPIDs := make(map[int]bool)
+	for _, s := range p.sessions {
+		if pid := s.attachPID(); pid != 0 {
+			ownPIDs[pid] = true
+		}
+	}
 	for _, tmuxSessionName := range sessions {
 		// Check if this tmux session is tracked in our pool
 		var trackedSession *Session
@@ -265,13 +958,8 @@ func (p *Pool) cleanupTmuxSessions() {
 					killed = append(killed, tmuxSessionName)
 				}
 			}
-		} else {
-			// Session is not in our pool but has our prefix - orphaned
-			// Check if it has no attached clients
-			clientCount := tmux.GetSessionClientCount(tmuxSessionName)
-			if clientCount == 0 {
-				killed = append(killed, tmuxSessionName)
-			}
+		} else if p.isOrphanedTmux(tmuxSessionName, ownPIDs, now) {
+			killed = append(killed, tmuxSessionName)
 		}
 	}
 	p.mu.RUnlock()
@@ -282,12 +970,14 @@ func (p *Pool) cleanupTmuxSessions() {
 			slog.Error("Failed to kill tmux session", "session", sessionName, "error", err)
 		} else {
 			slog.Info("Killed inactive tmux session", "session", sessionName)
+			promTmuxKilled.Inc()
 		}
 
 		// Also remove from pool if tracked
 		p.mu.Lock()
 		for id, s := range p.sessions {
 			if s.TmuxSessionName == sessionName {
+				s.DisconnectAllClients(CloseCode4007, "session expired")
 				s.Close()
 				delete(p.sessions, id)
 				break
@@ -0,0 +1,582 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/pty"
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
+)
+
+// testPool returns a pool of direct sessions running sh.
+func testPool(t *testing.T, config PoolConfig) *Pool {
+	t.Helper()
+	if config.DefaultCommand == "" {
+		config.DefaultCommand = "/bin/sh"
+	}
+	if config.SessionTimeout == 0 {
+		config.SessionTimeout = time.Minute
+	}
+	p := NewPool(config)
+	t.Cleanup(p.CloseAll)
+	return p
+}
+
+func TestCreateFailingSetupClosesSession(t *testing.T) {
+	p := testPool(t, PoolConfig{})
+	if _, err := p.Create(CreateOptions{OutputCharset: "no-such-charset"}); err == nil {
+		t.Fatal("Create with an unknown charset succeeded")
+	}
+	if n := p.Count(); n != 0 {
+		t.Errorf("pool has %d sessions after a failed create, want 0", n)
+	}
+}
+
+func TestMaxSessionsRejects(t *testing.T) {
+	p := testPool(t, PoolConfig{MaxSessions: 1, EvictionPolicy: EvictReject})
+	if _, err := p.Create(CreateOptions{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := p.Create(CreateOptions{}); !errors.Is(err, ErrTooManySessions) {
+		t.Fatalf("Create beyond the limit: got %v, want ErrTooManySessions", err)
+	}
+}
+
+func TestLRUEvictionFreesSlot(t *testing.T) {
+	p := testPool(t, PoolConfig{MaxSessions: 3, EvictionPolicy: EvictLRU})
+	var sessions []*Session
+	for i := 0; i < 3; i++ {
+		s, err := p.Create(CreateOptions{})
+		if err != nil {
+			t.Fatalf("Create %d: %v", i, err)
+		}
+		sessions = append(sessions, s)
+		time.Sleep(2 * time.Millisecond)
+	}
+	s1, s2, s3 := sessions[0], sessions[1], sessions[2]
+	s1.UpdateActivity() // s2 is now the least recently active
+
+	if _, err := p.Create(CreateOptions{}); err != nil {
+		t.Fatalf("Create at the limit: %v", err)
+	}
+	if _, ok := p.Get(s2.ID); ok || !s2.IsClosed() {
+		t.Fatal("least recently active session was not evicted")
+	}
+	if n := p.Count(); n != 3 {
+		t.Fatalf("pool has %d sessions, want 3", n)
+	}
+
+	// s3 is now the least recently active, but in use
+	conn, _ := wsPair(t)
+	if err := s3.AddClient(conn, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+	if _, err := p.Create(CreateOptions{}); err != nil {
+		t.Fatalf("Create at the limit: %v", err)
+	}
+	if _, ok := p.Get(s3.ID); !ok {
+		t.Fatal("session with a client was evicted")
+	}
+	if _, ok := p.Get(s1.ID); ok {
+		t.Fatal("least recently active idle session was not evicted")
+	}
+}
+
+func TestLRUEvictionRejectsWhenAllInUse(t *testing.T) {
+	p := testPool(t, PoolConfig{MaxSessions: 1, EvictionPolicy: EvictLRU})
+	s, err := p.Create(CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	conn, _ := wsPair(t)
+	s.AddObserver(conn, "o")
+	if _, err := p.Create(CreateOptions{}); !errors.Is(err, ErrTooManySessions) {
+		t.Fatalf("Create with every session in use: got %v, want ErrTooManySessions", err)
+	}
+}
+
+func TestCreateSizeBeforeConnect(t *testing.T) {
+	p := testPool(t, PoolConfig{ScrollbackBytes: 4096})
+	sess, err := p.Create(CreateOptions{Cols: 300, Rows: 90, Command: "/bin/sh", Args: []string{"-c", "stty size; exec cat"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// No client ever attached, so only the requested size can have applied
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(string(sess.scrollback.Bytes()), "90 300") {
+		if time.Now().After(deadline) {
+			t.Fatalf("command saw size %q, want 90 300", sess.scrollback.Bytes())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// privateTmux skips the test without tmux, and otherwise points tmux at a
+// private server, so the test leaves the user's alone.
+func privateTmux(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	// Inside tmux, $TMUX would name the server regardless of TMUX_TMPDIR
+	t.Setenv("TMUX", "")
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	t.Cleanup(func() { exec.Command("tmux", "kill-server").Run() })
+}
+
+func TestCreateTmuxSizeBeforeConnect(t *testing.T) {
+	privateTmux(t)
+	p := testPool(t, PoolConfig{TmuxEnabled: true})
+	sess, err := p.Create(CreateOptions{Cols: 300, Rows: 90})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// The window is created at the requested size and then fitted to the
+	// session's own tmux client, which has the same size including the
+	// status bar
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		details, err := tmux.DescribeSession(sess.TmuxSessionName)
+		if err != nil {
+			t.Fatalf("DescribeSession: %v", err)
+		}
+		if details.Cols == 300 && details.Rows == 90 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tmux window is %dx%d before any client connected, want 300x90", details.Cols, details.Rows)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAdoptConfiguresLikeCreate(t *testing.T) {
+	privateTmux(t)
+	p := testPool(t, PoolConfig{
+		TmuxEnabled:       true,
+		BellEvents:        true,
+		RedactPatterns:    []*regexp.Regexp{regexp.MustCompile(`secret`)},
+		OutputCharset:     "iso-8859-1",
+		MaxOutputRate:     1 << 20,
+		MaxOutputBytes:    1 << 30,
+		WriteTimeout:      3 * time.Second,
+		InputReplayWindow: time.Minute,
+		TmuxReplayLines:   100,
+		MinSize:           pty.Size{Cols: 20, Rows: 5},
+	})
+	created, err := p.Create(CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// Detach it, as a restarted server would find it
+	p.RemoveWithTmux(created.ID, false)
+	adopted, err := p.Adopt(created.ID)
+	if err != nil {
+		t.Fatalf("Adopt: %v", err)
+	}
+
+	for _, s := range []*Session{created, adopted} {
+		if s.bell == nil || s.redactor == nil || s.transcoder == nil || s.outputLimiter == nil {
+			t.Errorf("session (recovered %v) lacks output processing", s.recovered)
+		}
+		if s.maxOutputBytes != 1<<30 || s.writeTimeout != 3*time.Second || s.inputReplayWindow != time.Minute ||
+			s.tmuxReplayLines != 100 || s.minSize != (pty.Size{Cols: 20, Rows: 5}) {
+			t.Errorf("session (recovered %v) not configured from the pool", s.recovered)
+		}
+	}
+}
+
+// detachedTmuxSession creates a tmux session and drops it from the pool,
+// leaving it running like one detached with keepTmux.
+func detachedTmuxSession(t *testing.T, p *Pool) string {
+	t.Helper()
+	sess, err := p.Create(CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	p.RemoveWithTmux(sess.ID, false)
+	return sess.TmuxSessionName
+}
+
+// attachExternal attaches a tmux client to name as a user would, and
+// returns its PID.
+func attachExternal(t *testing.T, name string) int {
+	t.Helper()
+	client, err := pty.AttachTmux(name, 80, 24, nil)
+	if err != nil {
+		t.Fatalf("AttachTmux: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	pid := client.Cmd.Process.Pid
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pids, _ := tmux.SessionClientPIDs(name)
+		if slices.Contains(pids, pid) {
+			return pid
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("tmux client did not attach")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCleanupKeepsRecentlyActiveOrphan(t *testing.T) {
+	privateTmux(t)
+	p := testPool(t, PoolConfig{TmuxEnabled: true, MaxInactive: time.Hour})
+	name := detachedTmuxSession(t, p)
+
+	p.cleanupTmuxSessions()
+	if !tmux.SessionExists(name) {
+		t.Error("untracked session without clients killed before -max-inactive")
+	}
+}
+
+func TestCleanupKillsInactiveOrphan(t *testing.T) {
+	privateTmux(t)
+	p := testPool(t, PoolConfig{TmuxEnabled: true, MaxInactive: time.Nanosecond})
+	name := detachedTmuxSession(t, p)
+	time.Sleep(10 * time.Millisecond)
+
+	p.cleanupTmuxSessions()
+	if tmux.SessionExists(name) {
+		t.Error("inactive untracked session without clients not killed")
+	}
+}
+
+func TestCleanupKeepsOrphanWithExternalClient(t *testing.T) {
+	privateTmux(t)
+	p := testPool(t, PoolConfig{TmuxEnabled: true, MaxInactive: time.Nanosecond})
+	name := detachedTmuxSession(t, p)
+	pid := attachExternal(t, name)
+	time.Sleep(10 * time.Millisecond)
+
+	p.cleanupTmuxSessions()
+	if !tmux.SessionExists(name) {
+		t.Fatal("untracked session with a user's tmux client attached was killed")
+	}
+	// The same client owned by the server doesn't keep it alive
+	if !p.isOrphanedTmux(name, map[int]bool{pid: true}, time.Now()) {
+		t.Error("session with only the server's own tmux client is not orphaned")
+	}
+}
+
+func TestExitedTombstone(t *testing.T) {
+	p := testPool(t, PoolConfig{ScrollbackBytes: 4096, ExitedTTL: time.Minute})
+	sess, err := p.Create(CreateOptions{Command: "/bin/sh", Args: []string{"-c", "echo finished; exit 3"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	select {
+	case <-sess.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session didn't close after its command exited")
+	}
+
+	// The tombstone outlives the session's removal from the pool
+	p.cleanup()
+	if _, ok := p.Get(sess.ID); ok {
+		t.Fatal("exited session still in the pool")
+	}
+	status, ok := p.Exited(sess.ID)
+	if !ok {
+		t.Fatal("no tombstone after cleanup")
+	}
+	if status.Code != 3 || !strings.Contains(string(status.Output), "finished") {
+		t.Errorf("tombstone code %d, output %q; want 3 and the final output", status.Code, status.Output)
+	}
+
+	// ...until its TTL is up
+	p.mu.Lock()
+	tomb := p.exited[sess.ID]
+	tomb.expiresAt = time.Now().Add(-time.Second)
+	p.exited[sess.ID] = tomb
+	p.mu.Unlock()
+	if _, ok := p.Exited(sess.ID); ok {
+		t.Error("expired tombstone still served")
+	}
+	p.cleanup()
+	if _, ok := p.exited[sess.ID]; ok {
+		t.Error("cleanup kept the expired tombstone")
+	}
+}
+
+func TestCreateFallbackCommand(t *testing.T) {
+	p := testPool(t, PoolConfig{FallbackCommand: "/bin/cat"})
+
+	// The request's fallback wins over the configured one
+	sess, err := p.Create(CreateOptions{Command: "/no/such/shell", FallbackCommand: "/bin/sh"})
+	if err != nil {
+		t.Fatalf("Create with a missing command: %v", err)
+	}
+	if sess.Command != "/bin/sh" {
+		t.Errorf("command = %q, want the fallback /bin/sh", sess.Command)
+	}
+	sess, err = p.Create(CreateOptions{Command: "/no/such/shell"})
+	if err != nil {
+		t.Fatalf("Create with the configured fallback: %v", err)
+	}
+	if sess.Command != "/bin/cat" {
+		t.Errorf("command = %q, want the configured fallback /bin/cat", sess.Command)
+	}
+
+	// A command that exists but can't be executed falls back too, though
+	// not to a command outside the allowed ones
+	broken := filepath.Join(t.TempDir(), "broken")
+	if err := os.WriteFile(broken, []byte{0, 1, 2, 3}, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	p = testPool(t, PoolConfig{AllowedCommands: []string{broken, "/bin/sh"}})
+	if _, err := p.Create(CreateOptions{Command: broken, FallbackCommand: "/bin/cat"}); err == nil {
+		t.Error("Create fell back to a command that isn't allowed")
+	}
+	sess, err = p.Create(CreateOptions{Command: broken, FallbackCommand: "/bin/sh"})
+	if err != nil {
+		t.Fatalf("Create with an unexecutable command: %v", err)
+	}
+	if sess.Command != "/bin/sh" {
+		t.Errorf("command = %q, want the fallback /bin/sh", sess.Command)
+	}
+	if n := p.Count(); n != 1 {
+		t.Errorf("pool has %d sessions, want 1", n)
+	}
+}
+
+func TestCreateTmuxHistoryLimit(t *testing.T) {
+	privateTmux(t)
+	p := testPool(t, PoolConfig{TmuxEnabled: true, TmuxHistoryLimit: 4000})
+	for _, tt := range []struct {
+		opts CreateOptions
+		want string
+	}{
+		{CreateOptions{}, "4000"},
+		{CreateOptions{TmuxHistoryLimit: 6000}, "6000"},
+	} {
+		sess, err := p.Create(tt.opts)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		out, err := exec.Command("tmux", "display-message", "-p", "-t", sess.TmuxSessionName, "#{history_limit}").Output()
+		if err != nil {
+			t.Fatalf("display-message: %v", err)
+		}
+		if got := strings.TrimSpace(string(out)); got != tt.want {
+			t.Errorf("history limit %s with TmuxHistoryLimit %d, want %s", got, tt.opts.TmuxHistoryLimit, tt.want)
+		}
+	}
+}
+
+func TestIdleTimeouts(t *testing.T) {
+	const timeout = time.Minute
+	for _, tt := range []struct {
+		name   string
+		config PoolConfig
+		closed []string // of "input", "output" and "both": the activity that went stale
+	}{
+		{"input close", PoolConfig{InputIdleTimeout: timeout, InputIdleAction: IdleActionClose}, []string{"input", "both"}},
+		{"output close", PoolConfig{OutputIdleTimeout: timeout, OutputIdleAction: IdleActionClose}, []string{"output", "both"}},
+		{"input warn", PoolConfig{InputIdleTimeout: timeout, InputIdleAction: IdleActionWarn}, nil},
+		{"output warn", PoolConfig{OutputIdleTimeout: timeout, OutputIdleAction: IdleActionWarn}, nil},
+		{"input and output", PoolConfig{IdleTimeout: timeout}, []string{"both"}},
+	} {
+		p := testPool(t, tt.config)
+		stale := time.Now().Add(-2 * timeout).UnixNano()
+		sessions := make(map[string]*Session)
+		for _, kind := range []string{"input", "output", "both"} {
+			sess, err := p.Create(CreateOptions{Command: "/bin/cat"})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if kind != "output" {
+				sess.lastInputAt.Store(stale)
+			}
+			if kind != "input" {
+				sess.lastOutputAt.Store(stale)
+			}
+			sessions[kind] = sess
+		}
+
+		p.cleanup()
+		for kind, sess := range sessions {
+			if want := slices.Contains(tt.closed, kind); sess.IsClosed() != want {
+				t.Errorf("%s: session with stale %s closed = %v, want %v", tt.name, kind, sess.IsClosed(), want)
+			}
+		}
+		if tt.config.InputIdleAction == IdleActionWarn && sessions["input"].inputIdleWarnedAt.IsZero() {
+			t.Errorf("%s: stale input not warned about", tt.name)
+		}
+		if tt.config.OutputIdleAction == IdleActionWarn && sessions["output"].outputIdleWarnedAt.IsZero() {
+			t.Errorf("%s: stale output not warned about", tt.name)
+		}
+	}
+}
+
+func TestCreateCommandWorkdir(t *testing.T) {
+	notes := t.TempDir()
+	t.Setenv("NOTES_DIR", notes)
+	other := t.TempDir()
+	p := testPool(t, PoolConfig{
+		CommandWorkdirs: map[string]string{"sh": "$NOTES_DIR"},
+		DefaultWorkdir:  other,
+		ScrollbackBytes: 4096,
+	})
+
+	// Matched by basename, with the template expanded
+	sess, err := p.Create(CreateOptions{Command: "/bin/sh", Args: []string{"-c", "pwd; exec cat"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(string(sess.scrollback.Bytes()), notes) {
+		if time.Now().After(deadline) {
+			t.Fatalf("sh ran in %q, want %s", sess.scrollback.Bytes(), notes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, tt := range []struct {
+		opts CreateOptions
+		want string
+	}{
+		{CreateOptions{Command: "/bin/cat"}, other},                      // no template for cat
+		{CreateOptions{Command: "/bin/sh", Workdir: other}, other},       // the request wins
+		{CreateOptions{Command: "/bin/sh", Args: []string{"-i"}}, notes}, // whatever the args
+	} {
+		sess, err := p.Create(tt.opts)
+		if err != nil {
+			t.Fatalf("Create(%+v): %v", tt.opts, err)
+		}
+		if sess.workdir != tt.want {
+			t.Errorf("Create(%+v) in %s, want %s", tt.opts, sess.workdir, tt.want)
+		}
+	}
+}
+
+func TestCreateTmuxStatus(t *testing.T) {
+	privateTmux(t)
+	yes, no := true, false
+	for _, tt := range []struct {
+		name      string
+		statusOff bool
+		status    *bool
+		want      string
+	}{
+		{"tmux default", false, nil, "on"},
+		{"off by config", true, nil, "off"},
+		{"on by request", true, &yes, "on"},
+		{"off by request", false, &no, "off"},
+	} {
+		p := testPool(t, PoolConfig{TmuxEnabled: true, TmuxStatusOff: tt.statusOff})
+		sess, err := p.Create(CreateOptions{TmuxStatus: tt.status})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		got, err := tmux.ShowOption(sess.TmuxSessionName, "status")
+		if err != nil {
+			t.Fatalf("ShowOption: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: status %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCreateProfilePrecedence(t *testing.T) {
+	p := testPool(t, PoolConfig{
+		DefaultCommand: "/bin/sh",
+		Profiles: map[string]Profile{
+			"dev": {
+				Command: "/bin/sh",
+				Args:    []string{"-c", "exec cat"},
+				Env:     map[string]string{"FROM_PROFILE": "yes", "OVERRIDDEN": "profile"},
+				Cols:    120,
+				Rows:    40,
+				Timeout: 5 * time.Minute,
+			},
+		},
+	})
+
+	// The profile fills in what the request leaves out
+	sess, err := p.Create(CreateOptions{Profile: "dev"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if sess.Command != "/bin/sh" || !slices.Equal(sess.Args, []string{"-c", "exec cat"}) {
+		t.Errorf("command %s %q, want the profile's", sess.Command, sess.Args)
+	}
+	if sess.Cols != 120 || sess.Rows != 40 || sess.timeout != 5*time.Minute {
+		t.Errorf("size %dx%d, timeout %s; want the profile's 120x40 and 5m", sess.Cols, sess.Rows, sess.timeout)
+	}
+	if sess.env["FROM_PROFILE"] != "yes" || sess.env["OVERRIDDEN"] != "profile" {
+		t.Errorf("env %v, want the profile's", sess.env)
+	}
+
+	// Request fields win, field by field
+	sess, err = p.Create(CreateOptions{
+		Profile: "dev",
+		Command: "/bin/cat",
+		Cols:    100,
+		Env:     map[string]string{"OVERRIDDEN": "request"},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if sess.Command != "/bin/cat" || len(sess.Args) != 0 {
+		t.Errorf("command %s %q, want the request's without the profile's args", sess.Command, sess.Args)
+	}
+	if sess.Cols != 100 || sess.Rows != 40 {
+		t.Errorf("size %dx%d, want the request's cols and the profile's rows", sess.Cols, sess.Rows)
+	}
+	if sess.env["FROM_PROFILE"] != "yes" || sess.env["OVERRIDDEN"] != "request" {
+		t.Errorf("env %v, want the request's merged over the profile's", sess.env)
+	}
+
+	// Without a profile the pool defaults apply
+	sess, err = p.Create(CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if sess.Cols != defaultCols || sess.Rows != defaultRows || sess.timeout != 0 || sess.env["FROM_PROFILE"] != "" {
+		t.Errorf("without a profile: size %dx%d, timeout %s, env %v", sess.Cols, sess.Rows, sess.timeout, sess.env)
+	}
+
+	if _, err := p.Create(CreateOptions{Profile: "missing"}); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("unknown profile: %v, want ErrUnknownProfile", err)
+	}
+}
+
+func TestCreateCommandSize(t *testing.T) {
+	p := testPool(t, PoolConfig{
+		CommandSizes: map[string]pty.Size{
+			"cat":     {Cols: 200, Rows: 50},
+			"/bin/sh": {Cols: 100},
+		},
+		Profiles: map[string]Profile{"small": {Cols: 60, Rows: 20}},
+	})
+	for _, tt := range []struct {
+		name       string
+		opts       CreateOptions
+		cols, rows uint16
+	}{
+		{"by basename", CreateOptions{Command: "/bin/cat"}, 200, 50},
+		{"by path, rows from the default", CreateOptions{Command: "/bin/sh"}, 100, defaultRows},
+		{"no entry", CreateOptions{Command: "/bin/sleep", Args: []string{"60"}}, defaultCols, defaultRows},
+		{"request wins", CreateOptions{Command: "/bin/cat", Cols: 90}, 90, 50},
+		{"profile wins", CreateOptions{Command: "/bin/cat", Profile: "small"}, 60, 20},
+	} {
+		sess, err := p.Create(tt.opts)
+		if err != nil {
+			t.Fatalf("%s: Create: %v", tt.name, err)
+		}
+		if sess.Cols != tt.cols || sess.Rows != tt.rows {
+			t.Errorf("%s: size %dx%d, want %dx%d", tt.name, sess.Cols, sess.Rows, tt.cols, tt.rows)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profile is a named set of session defaults that clients select with
+// CreateOptions.Profile. Zero fields fall back to the pool defaults, and
+// fields given in the request take precedence over the profile.
+type Profile struct {
+	Command string
+	Args    []string                  // Used only when Command comes from the profile; may hold {name} placeholders for Vars
+	Vars    map[string]*regexp.Regexp // Variables clients may substitute into Args, with the pattern values must match
+	Env     map[string]string         // Extra environment variables for the command
+	Cols    uint16
+	Rows    uint16
+	Timeout time.Duration // Session timeout after disconnect (default: PoolConfig.SessionTimeout)
+	Tmux    *bool         // Run inside tmux (default: PoolConfig.TmuxEnabled)
+}
+
+// ErrUnknownProfile is returned when a request names a profile that isn't configured.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// profile returns the named profile, or the zero Profile for an empty name.
+func (p *Pool) profile(name string) (Profile, error) {
+	if name == "" {
+		return Profile{}, nil
+	}
+	prof, ok := p.config.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	return prof, nil
+}
+
+// ErrInvalidEnv is returned by ValidateEnv for an unusable variable name or value.
+var ErrInvalidEnv = errors.New("invalid environment variable")
+
+// ValidateEnv checks that env can be passed to a command: names must be
+// non-empty and free of '=' and NUL bytes, and values free of NUL bytes.
+func ValidateEnv(env map[string]string) error {
+	for k, v := range env {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return fmt.Errorf("%w: name %q", ErrInvalidEnv, k)
+		}
+		if strings.ContainsRune(v, 0) {
+			return fmt.Errorf("%w: value of %s contains a NUL byte", ErrInvalidEnv, k)
+		}
+	}
+	return nil
+}
+
+// mergeEnv returns the variables of base overridden by those of override.
+func mergeEnv(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// envList converts an environment map to KEY=value entries in a stable order.
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Process-wide Prometheus counters. Per-session counters in metrics.go back
+// the /pty/{id}/metrics endpoint; these aggregate across sessions for
+// scraping, labeled by whether the session is tmux-backed.
+var (
+	promBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "terminus",
+		Name:      "pty_bytes_total",
+		Help:      "Bytes written to (in) and read from (out) session PTYs.",
+	}, []string{"direction", "tmux"})
+	promWriteFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "terminus",
+		Name:      "websocket_write_failures_total",
+		Help:      "WebSocket writes that failed and dropped the client.",
+	}, []string{"tmux"})
+	promConnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "terminus",
+		Name:      "client_connects_total",
+		Help:      "WebSocket clients attached to a session.",
+	}, []string{"tmux"})
+	promDisconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "terminus",
+		Name:      "client_disconnects_total",
+		Help:      "WebSocket clients detached from a session.",
+	}, []string{"tmux"})
+	promTmuxKilled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "terminus",
+		Name:      "tmux_sessions_killed_total",
+		Help:      "tmux sessions killed by the inactive/orphan cleanup.",
+	})
+
+	activeSessionsDesc = prometheus.NewDesc("terminus_sessions_active",
+		"Sessions currently in the pool.", []string{"tmux"}, nil)
+)
+
+// promCounters holds a session's children of the labeled counters, resolved
+// once so the I/O paths don't look labels up on every read.
+type promCounters struct {
+	bytesIn       prometheus.Counter
+	bytesOut      prometheus.Counter
+	writeFailures prometheus.Counter
+	connects      prometheus.Counter
+	disconnects   prometheus.Counter
+}
+
+func newPromCounters(tmux bool) promCounters {
+	label := strconv.FormatBool(tmux)
+	return promCounters{
+		bytesIn:       promBytes.WithLabelValues("in", label),
+		bytesOut:      promBytes.WithLabelValues("out", label),
+		writeFailures: promWriteFailures.WithLabelValues(label),
+		connects:      promConnects.WithLabelValues(label),
+		disconnects:   promDisconnects.WithLabelValues(label),
+	}
+}
+
+// RegisterMetrics registers the session counters and the pool's active
+// sessions gauge with reg.
+func (p *Pool) RegisterMetrics(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		promBytes, promWriteFailures, promConnects, promDisconnects, promTmuxKilled,
+		poolCollector{p},
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poolCollector reports the active sessions gauge, counted at scrape time so
+// it can't drift from the pool's contents.
+type poolCollector struct {
+	pool *Pool
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	var tmuxCount, directCount int
+	c.pool.mu.RLock()
+	for _, s := range c.pool.sessions {
+		if s.TmuxSessionName != "" {
+			tmuxCount++
+		} else {
+			directCount++
+		}
+	}
+	c.pool.mu.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(tmuxCount), "true")
+	ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(directCount), "false")
+}
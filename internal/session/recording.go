@@ -0,0 +1,443 @@
+package session
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// recordSyncInterval is how often a recording with new events is flushed
+// and fsynced, bounding what a crash can lose.
+const recordSyncInterval = 5 * time.Second
+
+// recorder writes a session's output to an asciinema v2 cast file: a JSON
+// header line followed by one [elapsed, type, data] event per line. With
+// timestamps, each event gets a fourth element, an object of extension
+// fields whose "time" is the wall-clock time of the event.
+//
+// Event data is a JSON string, which can only hold valid UTF-8. Output that
+// isn't, e.g. a binary dump, is still recorded as a string with the invalid
+// bytes replaced, for players, and its exact bytes go into the "raw"
+// extension field, base64-encoded.
+//
+// With a size or duration limit, the recording is rotated into segments,
+// each a cast file of its own whose event times start at zero again. A
+// segment's header records its offset from the start of the recording, so
+// the segments can be joined back into one cast, see Pool.CopyRecording.
+type recorder struct {
+	store      RecordingStore
+	path       string // where the first segment is, a file path for DirRecordingStore
+	base       string // name of the first segment without .cast
+	start      time.Time
+	timestamps bool
+	maxBytes   int64         // segment size that triggers a rotation (0 = unlimited)
+	maxAge     time.Duration // segment duration that triggers a rotation (0 = unlimited)
+
+	mu         sync.Mutex
+	file       io.WriteCloser
+	w          *bufio.Writer
+	segments   []string // names of the segments so far, the current one last
+	segStart   time.Time
+	segBytes   int64 // bytes written to the current segment
+	size       int64 // bytes written to all segments
+	cols, rows uint16
+	pending    []byte // trailing bytes of an incomplete UTF-8 sequence
+	dirty      bool   // events written since the last sync
+	stop       chan struct{}
+}
+
+// recordOptions holds the recording settings from PoolConfig.
+type recordOptions struct {
+	timestamps bool
+	maxBytes   int64
+	maxAge     time.Duration
+}
+
+// castEventExt holds the extension fields appended to an event.
+type castEventExt struct {
+	Time string `json:"time,omitempty"` // RFC 3339 wall-clock time, with -record-timestamps
+	Raw  string `json:"raw,omitempty"`  // base64 of the exact data, if it isn't valid UTF-8
+}
+
+// castHeader is the first line of an asciinema v2 cast file. Segment and
+// Offset are extension fields set on the segments after the first.
+type castHeader struct {
+	Version   int     `json:"version"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	Timestamp int64   `json:"timestamp"`
+	Segment   int     `json:"segment,omitempty"`
+	Offset    float64 `json:"offset,omitempty"` // seconds since the start of the recording
+}
+
+// newRecorder creates <id>.cast in store and writes its header. An existing
+// recording, e.g. of an earlier session with the same fixed ID, is kept and
+// the new one gets a timestamp suffix. Further segments are named after the
+// first, as <id>.1.cast, <id>.2.cast and so on.
+func newRecorder(store RecordingStore, id string, cols, rows uint16, opts recordOptions) (*recorder, error) {
+	now := time.Now()
+	base := id
+	f, err := store.Create(base + ".cast")
+	if errors.Is(err, os.ErrExist) {
+		base = id + "-" + strconv.FormatInt(now.Unix(), 10)
+		f, err = store.Create(base + ".cast")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	r := &recorder{
+		store:      store,
+		path:       base + ".cast",
+		base:       base,
+		start:      now,
+		timestamps: opts.timestamps,
+		maxBytes:   opts.maxBytes,
+		maxAge:     opts.maxAge,
+		cols:       cols,
+		rows:       rows,
+		stop:       make(chan struct{}),
+	}
+	if named, ok := f.(interface{ Name() string }); ok {
+		r.path = named.Name()
+	}
+	if err := r.beginSegment(f, base+".cast", now); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	go r.syncLoop()
+	return r, nil
+}
+
+// beginSegment makes f, stored under name, the current segment and writes
+// its header. Called with mu held, or before the recorder is shared.
+func (r *recorder) beginSegment(f io.WriteCloser, name string, now time.Time) error {
+	r.file = f
+	r.w = bufio.NewWriter(f)
+	r.segStart = now
+	r.segBytes = 0
+	r.segments = append(r.segments, name)
+
+	header := castHeader{Version: 2, Width: int(r.cols), Height: int(r.rows), Timestamp: now.Unix()}
+	if n := len(r.segments) - 1; n > 0 {
+		header.Segment = n
+		header.Offset = now.Sub(r.start).Seconds()
+	}
+	line, _ := json.Marshal(header)
+	r.writeLine(line)
+	if err := r.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write recording header: %w", err)
+	}
+	return nil
+}
+
+// rotate closes the current segment and starts the next one. If the next
+// one can't be created, recording continues in the current segment.
+// Called with mu held.
+func (r *recorder) rotate(now time.Time) {
+	name := fmt.Sprintf("%s.%d.cast", r.base, len(r.segments))
+	f, err := r.store.Create(name)
+	if err != nil {
+		slog.Warn("Failed to rotate recording", "name", name, "error", err)
+		r.segStart = now // don't retry on every event
+		return
+	}
+	if err := r.closeSegment(); err != nil {
+		slog.Warn("Failed to close recording segment", "name", r.segments[len(r.segments)-1], "error", err)
+	}
+	if err := r.beginSegment(f, name, now); err != nil {
+		slog.Warn("Failed to start recording segment", "name", name, "error", err)
+	}
+}
+
+// closeSegment flushes, syncs and closes the current segment. Called with
+// mu held.
+func (r *recorder) closeSegment() error {
+	err := r.w.Flush()
+	if syncErr := r.sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file = nil
+	r.dirty = false
+	return err
+}
+
+// sync syncs the current segment to stable storage, if its writer can.
+// Called with mu held.
+func (r *recorder) sync() error {
+	if s, ok := r.file.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// writeLine appends a line to the current segment. Called with mu held.
+func (r *recorder) writeLine(line []byte) {
+	r.w.Write(line)
+	r.w.WriteByte('\n')
+	r.segBytes += int64(len(line)) + 1
+	r.size += int64(len(line)) + 1
+}
+
+// Output records an output event. A multi-byte character split across
+// reads is held back until it is complete, since events carry text.
+func (r *recorder) Output(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) > 0 {
+		data = append(r.pending, data...)
+		r.pending = nil
+	}
+	if cut := incompleteUTF8Suffix(data); cut > 0 {
+		r.pending = append([]byte(nil), data[len(data)-cut:]...)
+		data = data[:len(data)-cut]
+	}
+	if len(data) > 0 {
+		r.writeEvent("o", string(data))
+	}
+}
+
+// Resize records a resize event.
+func (r *recorder) Resize(cols, rows uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent("r", fmt.Sprintf("%dx%d", cols, rows))
+	r.cols, r.rows = cols, rows
+}
+
+// writeEvent appends one event line, first rotating to a new segment if
+// the current one reached a limit. Called with mu held.
+func (r *recorder) writeEvent(kind, data string) {
+	if r.file == nil {
+		return
+	}
+	now := time.Now()
+	if (r.maxBytes > 0 && r.segBytes >= r.maxBytes) || (r.maxAge > 0 && now.Sub(r.segStart) >= r.maxAge) {
+		r.rotate(now)
+	}
+	elapsed := now.Sub(r.segStart).Seconds()
+	fields := []any{elapsed, kind, data}
+	var ext castEventExt
+	if r.timestamps {
+		ext.Time = now.UTC().Format(time.RFC3339Nano)
+	}
+	if !utf8.ValidString(data) {
+		ext.Raw = base64.StdEncoding.EncodeToString([]byte(data))
+	}
+	if ext != (castEventExt{}) {
+		fields = append(fields, ext)
+	}
+	event, _ := json.Marshal(fields)
+	r.writeLine(event)
+	r.dirty = true
+}
+
+func (r *recorder) syncLoop() {
+	ticker := time.NewTicker(recordSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			if r.dirty && r.file != nil {
+				r.w.Flush()
+				r.sync()
+				r.dirty = false
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// Close writes any held-back output, then flushes, syncs and closes the file.
+func (r *recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	close(r.stop)
+	if len(r.pending) > 0 {
+		r.writeEvent("o", string(r.pending))
+		r.pending = nil
+	}
+	return r.closeSegment()
+}
+
+// Segments returns the names of the recording's segments, in order. Events
+// written so far are flushed first, so reading the segments sees them all.
+func (r *recorder) Segments() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		r.w.Flush()
+	}
+	return slices.Clone(r.segments)
+}
+
+// Size returns the bytes written to all segments.
+func (r *recorder) Size() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.size
+}
+
+// incompleteUTF8Suffix returns the length of an incomplete UTF-8 sequence at
+// the end of data, or 0 if data ends on a character boundary.
+func incompleteUTF8Suffix(data []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		b := data[len(data)-i]
+		if utf8.RuneStart(b) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return i
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// RecordingPath returns the path of the session's cast file, its first
+// segment if it was rotated, or "" if it isn't being recorded.
+func (s *Session) RecordingPath() string {
+	if s.recorder == nil {
+		return ""
+	}
+	return s.recorder.path
+}
+
+// RecordingSegments returns the names of the session's recording segments
+// in the pool's RecordingStore, or nil if it isn't being recorded.
+func (s *Session) RecordingSegments() []string {
+	if s.recorder == nil {
+		return nil
+	}
+	return s.recorder.Segments()
+}
+
+// RecordingSize returns the size of the session's recording in bytes, over
+// all segments.
+func (s *Session) RecordingSize() int64 {
+	if s.recorder == nil {
+		return 0
+	}
+	return s.recorder.Size()
+}
+
+// ErrNoRecording is returned for sessions that aren't recorded.
+var ErrNoRecording = errors.New("session is not recorded")
+
+// CopyRecording writes a recording made of segments to w as a single cast:
+// the first segment's header followed by the events of every segment, with
+// their times made relative to the start of the recording again.
+func (p *Pool) CopyRecording(w io.Writer, segments []string) error {
+	store := p.recordStore()
+	if store == nil || len(segments) == 0 {
+		return ErrNoRecording
+	}
+	bw := bufio.NewWriter(w)
+	for i, name := range segments {
+		if err := copySegment(bw, store, name, i == 0); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// CopyRecordingSegment writes one segment of a recording to w as stored.
+func (p *Pool) CopyRecordingSegment(w io.Writer, name string) error {
+	store := p.recordStore()
+	if store == nil {
+		return ErrNoRecording
+	}
+	f, err := store.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// copySegment writes the events of one segment to w, shifted by the offset
+// in its header, and the header itself if withHeader is set.
+func copySegment(w *bufio.Writer, store RecordingStore, name string, withHeader bool) error {
+	f, err := store.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	header, err := br.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read recording header of %s: %w", name, err)
+	}
+	if withHeader {
+		w.Write(header)
+	}
+	var h castHeader
+	if err := json.Unmarshal(header, &h); err != nil {
+		return fmt.Errorf("invalid recording header in %s: %w", name, err)
+	}
+	if h.Offset == 0 {
+		_, err = io.Copy(w, br)
+		return err
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			line = shiftEvent(line, h.Offset)
+			w.Write(line)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// shiftEvent adds offset seconds to the time of an event line. Lines that
+// don't parse as events, e.g. one cut short by a crash, are kept as is.
+func shiftEvent(line []byte, offset float64) []byte {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil || len(fields) < 3 {
+		return line
+	}
+	var elapsed float64
+	if err := json.Unmarshal(fields[0], &elapsed); err != nil {
+		return line
+	}
+	fields[0], _ = json.Marshal(elapsed + offset)
+	shifted, _ := json.Marshal(fields)
+	return append(shifted, '\n')
+}
+
+func (s *Session) closeRecorder() {
+	if s.recorder == nil {
+		return
+	}
+	if err := s.recorder.Close(); err != nil {
+		slog.Warn("Failed to close recording", "id", s.ID, "path", s.recorder.path, "error", err)
+	}
+}
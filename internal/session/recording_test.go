@@ -0,0 +1,387 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readCastLines returns the header and event lines of a cast file.
+func readCastLines(t *testing.T, path string) (header map[string]any, events [][]json.RawMessage) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		if header == nil {
+			if err := json.Unmarshal(sc.Bytes(), &header); err != nil {
+				t.Fatalf("header %q: %v", sc.Text(), err)
+			}
+			continue
+		}
+		var event []json.RawMessage
+		if err := json.Unmarshal(sc.Bytes(), &event); err != nil {
+			t.Fatalf("event %q: %v", sc.Text(), err)
+		}
+		events = append(events, event)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return header, events
+}
+
+func TestRecorderTimestamps(t *testing.T) {
+	before := time.Now()
+	r, err := newRecorder(DirRecordingStore{Dir: t.TempDir()}, "pty_test", 80, 24, recordOptions{timestamps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Output([]byte("hello"))
+	r.Resize(100, 30)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+
+	header, events := readCastLines(t, r.path)
+	if header["version"] != float64(2) {
+		t.Errorf("header version = %v, want 2", header["version"])
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	for i, event := range events {
+		if len(event) != 4 {
+			t.Fatalf("event %d has %d elements, want 4", i, len(event))
+		}
+		// The standard fields are unchanged
+		var elapsed float64
+		var kind string
+		if json.Unmarshal(event[0], &elapsed) != nil || json.Unmarshal(event[1], &kind) != nil {
+			t.Fatalf("event %d: malformed standard fields %s", i, event)
+		}
+		var ext castEventExt
+		if err := json.Unmarshal(event[3], &ext); err != nil {
+			t.Fatalf("event %d extension %s: %v", i, event[3], err)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, ext.Time)
+		if err != nil {
+			t.Fatalf("event %d time %q: %v", i, ext.Time, err)
+		}
+		if ts.Before(before) || ts.After(after) {
+			t.Errorf("event %d time %s outside [%s, %s]", i, ts, before, after)
+		}
+	}
+}
+
+func TestRecorderWithoutTimestamps(t *testing.T) {
+	r, err := newRecorder(DirRecordingStore{Dir: t.TempDir()}, "pty_test", 80, 24, recordOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Output([]byte("hello"))
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, events := readCastLines(t, r.path)
+	if len(events) != 1 || len(events[0]) != 3 {
+		t.Fatalf("events = %s, want one with 3 elements", events)
+	}
+}
+
+func TestRecorderRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	r, err := newRecorder(DirRecordingStore{Dir: dir}, "pty_test", 80, 24, recordOptions{maxBytes: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const events = 40
+	for i := 0; i < events; i++ {
+		r.Output([]byte(fmt.Sprintf("line %02d\r\n", i)))
+		time.Sleep(time.Millisecond)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments := r.Segments()
+	if len(segments) < 2 {
+		t.Fatalf("got %d segments, want several", len(segments))
+	}
+	var size int64
+	seen := 0
+	for i, name := range segments {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += info.Size()
+		// Each segment is a cast of its own
+		header, evs := readCastLines(t, path)
+		if header["version"] != float64(2) || header["width"] != float64(80) {
+			t.Errorf("segment %d header = %v", i, header)
+		}
+		if i > 0 && header["segment"] != float64(i) {
+			t.Errorf("segment %d header segment = %v", i, header["segment"])
+		}
+		seen += len(evs)
+	}
+	if seen != events {
+		t.Errorf("segments hold %d events, want %d", seen, events)
+	}
+	if r.Size() != size {
+		t.Errorf("Size() = %d, segment files total %d", r.Size(), size)
+	}
+
+	// Joined, the segments make one cast with the events in order
+	var joined bytes.Buffer
+	p := NewPool(PoolConfig{RecordDir: dir})
+	if err := p.CopyRecording(&joined, segments); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "joined.cast")
+	if err := os.WriteFile(path, joined.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	header, evs := readCastLines(t, path)
+	if _, ok := header["segment"]; ok {
+		t.Errorf("joined header %v has a segment number", header)
+	}
+	if len(evs) != events {
+		t.Fatalf("joined cast has %d events, want %d", len(evs), events)
+	}
+	last := -1.0
+	for i, ev := range evs {
+		var elapsed float64
+		var data string
+		json.Unmarshal(ev[0], &elapsed)
+		json.Unmarshal(ev[2], &data)
+		if elapsed < last {
+			t.Errorf("event %d at %f goes back in time from %f", i, elapsed, last)
+		}
+		last = elapsed
+		if want := fmt.Sprintf("line %02d\r\n", i); data != want {
+			t.Errorf("event %d = %q, want %q", i, data, want)
+		}
+	}
+	if last < float64(events)*time.Millisecond.Seconds() {
+		t.Errorf("last event at %fs, want offsets restored", last)
+	}
+}
+
+func TestRecorderRotatesByDuration(t *testing.T) {
+	r, err := newRecorder(DirRecordingStore{Dir: t.TempDir()}, "pty_test", 80, 24, recordOptions{maxAge: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Output([]byte("a"))
+	time.Sleep(30 * time.Millisecond)
+	r.Output([]byte("b"))
+	r.Close()
+	if n := len(r.Segments()); n != 2 {
+		t.Fatalf("got %d segments, want 2", n)
+	}
+}
+
+// eventData returns the exact bytes an event recorded: its raw extension
+// field if present, otherwise its data string.
+func eventData(t *testing.T, event []json.RawMessage) []byte {
+	t.Helper()
+	if len(event) > 3 {
+		var ext castEventExt
+		if err := json.Unmarshal(event[3], &ext); err != nil {
+			t.Fatalf("extension %s: %v", event[3], err)
+		}
+		if ext.Raw != "" {
+			raw, err := base64.StdEncoding.DecodeString(ext.Raw)
+			if err != nil {
+				t.Fatalf("raw %q: %v", ext.Raw, err)
+			}
+			return raw
+		}
+	}
+	var data string
+	if err := json.Unmarshal(event[2], &data); err != nil {
+		t.Fatalf("data %s: %v", event[2], err)
+	}
+	return []byte(data)
+}
+
+func TestRecorderRoundTripsBytes(t *testing.T) {
+	chunks := [][]byte{
+		[]byte("nul\x00byte "),
+		[]byte("ctl \x01\x07\x1b[31m\x7f "),
+		[]byte("utf8 h\xc3\xa9llo \xe2\x82"), // € split across reads
+		[]byte("\xac "),
+		[]byte("high \xff\xfe\x80 "),
+		[]byte("bad \xc3\x28 \xed\xa0\x80 "), // invalid continuation, surrogate
+		[]byte("tail \xe2\x82"),              // incomplete at close
+	}
+	var want []byte
+	r, err := newRecorder(DirRecordingStore{Dir: t.TempDir()}, "pty_test", 80, 24, recordOptions{timestamps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range chunks {
+		r.Output(c)
+		want = append(want, c...)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(r.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range bytes.Split(bytes.TrimSuffix(raw, []byte("\n")), []byte("\n")) {
+		if !json.Valid(line) {
+			t.Errorf("line %d is not valid JSON: %q", i, line)
+		}
+	}
+
+	_, events := readCastLines(t, r.path)
+	var got []byte
+	for _, ev := range events {
+		got = append(got, eventData(t, ev)...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("recorded bytes = %q, want %q", got, want)
+	}
+}
+
+// memRecordingStore is a RecordingStore in memory.
+type memRecordingStore struct {
+	mu    sync.Mutex
+	files map[string]*bytes.Buffer
+}
+
+type memFile struct {
+	store *memRecordingStore
+	buf   *bytes.Buffer
+}
+
+func (f memFile) Write(p []byte) (int, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	return f.buf.Write(p)
+}
+
+func (f memFile) Close() error { return nil }
+
+func (m *memRecordingStore) Create(name string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; ok {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrExist)
+	}
+	if m.files == nil {
+		m.files = make(map[string]*bytes.Buffer)
+	}
+	m.files[name] = &bytes.Buffer{}
+	return memFile{m, m.files[name]}, nil
+}
+
+func (m *memRecordingStore) Open(name string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buf, ok := m.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(bytes.Clone(buf.Bytes()))), nil
+}
+
+func TestRecordingStoreBackend(t *testing.T) {
+	store := &memRecordingStore{}
+	p := testPool(t, PoolConfig{RecordStore: store, ExitedTTL: time.Minute})
+	sess, err := p.Create(CreateOptions{Command: "/bin/echo", Args: []string{"hello from memory"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sess.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session didn't close after its command exited")
+	}
+
+	status, ok := p.Exited(sess.ID)
+	if !ok {
+		t.Fatal("no exit status")
+	}
+	if want := []string{sess.ID + ".cast"}; !slices.Equal(status.RecordingSegments, want) {
+		t.Fatalf("segments = %q, want %q", status.RecordingSegments, want)
+	}
+	var cast bytes.Buffer
+	if err := p.CopyRecordingSegment(&cast, status.RecordingSegments[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(cast.String(), `{"version":2,`) || !strings.Contains(cast.String(), "hello from memory") {
+		t.Errorf("recording = %q", cast.String())
+	}
+	// Nothing went to disk
+	if status.Recording != sess.ID+".cast" {
+		t.Errorf("recording location = %q, want the store name", status.Recording)
+	}
+
+	// A second recording under the same ID doesn't overwrite the first
+	r, err := newRecorder(store, sess.ID, 80, 24, recordOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if r.path == sess.ID+".cast" || len(store.files) != 2 {
+		t.Errorf("second recording stored as %q, files %d", r.path, len(store.files))
+	}
+}
+
+func TestSessionRecordingTimestamps(t *testing.T) {
+	dir := t.TempDir()
+	p := testPool(t, PoolConfig{RecordDir: dir, RecordTimestamps: true, ExitedTTL: time.Minute})
+	sess, err := p.Create(CreateOptions{Command: "/bin/echo", Args: []string{"stamped"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sess.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session didn't close after its command exited")
+	}
+	status, ok := p.Exited(sess.ID)
+	if !ok || len(status.RecordingSegments) != 1 {
+		t.Fatalf("exit status %+v, want one recording segment", status)
+	}
+
+	_, events := readCastLines(t, filepath.Join(dir, status.RecordingSegments[0]))
+	if len(events) == 0 {
+		t.Fatal("no events recorded")
+	}
+	for i, event := range events {
+		if len(event) != 4 {
+			t.Fatalf("event %d = %s, want the timestamp extension", i, event)
+		}
+		var ext castEventExt
+		if err := json.Unmarshal(event[3], &ext); err != nil {
+			t.Fatalf("event %d extension %s: %v", i, event[3], err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, ext.Time); err != nil {
+			t.Errorf("event %d time %q: %v", i, ext.Time, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package session
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// RecordingStore is where session recordings are written, e.g. a local
+// directory, or object storage for servers whose disk doesn't outlive them.
+// A recording is stored as cast files named after the session ID: <id>.cast,
+// then <id>.1.cast, <id>.2.cast and so on if it is rotated into segments.
+type RecordingStore interface {
+	// Create creates the named file for writing. It fails with an error
+	// wrapping os.ErrExist if the name is taken, e.g. by the recording of an
+	// earlier session with the same fixed ID. Writers with a Sync method are
+	// synced periodically.
+	Create(name string) (io.WriteCloser, error)
+
+	// Open opens a file Create created for reading.
+	Open(name string) (io.ReadCloser, error)
+}
+
+// DirRecordingStore stores recordings as files in a local directory, which
+// is created on first use.
+type DirRecordingStore struct {
+	Dir string
+}
+
+func (d DirRecordingStore) Create(name string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(d.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create record dir: %w", err)
+	}
+	return os.OpenFile(filepath.Join(d.Dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+}
+
+func (d DirRecordingStore) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(d.Dir, name))
+}
+
+// recordStore returns the store sessions are recorded to, or nil if
+// recording is off.
+func (p *Pool) recordStore() RecordingStore {
+	if p.config.RecordStore != nil {
+		return p.config.RecordStore
+	}
+	if p.config.RecordDir != "" {
+		return DirRecordingStore{Dir: p.config.RecordDir}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
+)
+
+// ErrNotTmux is returned when reattaching a session that isn't tmux-backed.
+var ErrNotTmux = errors.New("session is not a tmux session")
+
+// ErrTmuxSessionGone is returned when the tmux session to attach to no longer
+// exists.
+var ErrTmuxSessionGone = errors.New("tmux session no longer exists")
+
+// ErrAlreadyAttached is returned by Reattach when the session already has a
+// PTY attached to its tmux session.
+var ErrAlreadyAttached = errors.New("session is already attached")
+
+// Recover adopts the tmux sessions a previous server process left running,
+// so they can be listed and reattached instead of being killed as orphans.
+// Like a session whose clients disconnected, a recovered session expires
+// after the session timeout if nobody reattaches. Returns how many sessions
+// were adopted.
+func (p *Pool) Recover() int {
+	if !p.config.TmuxEnabled {
+		return 0
+	}
+	names, err := p.TmuxSessions()
+	if err != nil {
+		slog.Warn("Failed to list tmux sessions to recover", "error", err)
+		return 0
+	}
+
+	recovered := 0
+	for _, name := range names {
+		if _, exists := p.Get(name); exists {
+			continue
+		}
+		if _, err := p.Adopt(name); err != nil {
+			slog.Warn("Failed to recover tmux session", "tmux_session", name, "error", err)
+			continue
+		}
+		recovered++
+	}
+	if recovered > 0 {
+		slog.Info("Recovered tmux sessions from a previous run", "count", recovered)
+	}
+	return recovered
+}
+
+// ownsTmuxSession reports whether a tmux session name is one of the
+// server's: a generated pty_ ID or the configured default session.
+func (p *Pool) ownsTmuxSession(name string) bool {
+	return strings.HasPrefix(name, "pty_") || (name != "" && name == p.config.DefaultSessionID)
+}
+
+// TmuxSessions lists the names of the server's tmux sessions, tracked or
+// not.
+func (p *Pool) TmuxSessions() ([]string, error) {
+	names, err := tmux.ListSessions("")
+	if err != nil {
+		return nil, err
+	}
+	own := names[:0]
+	for _, name := range names {
+		if p.ownsTmuxSession(name) {
+			own = append(own, name)
+		}
+	}
+	return own, nil
+}
+
+// Adopt adds a running tmux session of the server that the pool doesn't
+// track, e.g. one left by a previous server process or detached by DELETE
+// with keepTmux, under its tmux session name, which is the ID it had. The
+// session has no PTY until Reattach or AttachRecovered attaches one.
+// Returns the tracked session if the pool already has one by that ID.
+func (p *Pool) Adopt(name string) (*Session, error) {
+	if !p.config.TmuxEnabled {
+		return nil, fmt.Errorf("%w: %s", ErrNotTmux, name)
+	}
+	if !p.ownsTmuxSession(name) || !tmux.SessionExists(name) {
+		return nil, fmt.Errorf("%w: %s", ErrTmuxSessionGone, name)
+	}
+	details, err := tmux.DescribeSession(name)
+	if err != nil {
+		return nil, err
+	}
+	cols, rows := details.Cols, details.Rows
+	if cols == 0 || rows == 0 {
+		cols, rows = defaultCols, defaultRows
+	}
+
+	session := newSession(name, nil, cols, rows)
+	session.TmuxSessionName = name
+	session.Command = details.Command
+	session.CreatedAt = details.CreatedAt
+	now := time.Now()
+	session.DisconnectedAt = &now
+	session.recovered = true
+	session.env = p.baseEnv(true)
+	if err := p.configureSession(session, CreateOptions{}, true); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if existing, ok := p.sessions[name]; ok && !existing.IsClosed() {
+		p.mu.Unlock()
+		session.Close()
+		return existing, nil
+	}
+	session.startDetached()
+	p.sessions[name] = session
+	p.mu.Unlock()
+
+	slog.Info("Recovered tmux session", "id", name, "command", details.Command, "cols", cols, "rows", rows)
+	return session, nil
+}
+
+// startDetached launches the broadcast goroutine of a recovered session,
+// which has no PTY to read from until it is attached.
+func (s *Session) startDetached() {
+	s.prom = newPromCounters(true)
+	s.readerDone = make(chan struct{})
+	close(s.readerDone)
+	go s.broadcastLoop()
+}
+
+// Recovered reports whether the session was adopted from tmux rather than
+// created by this server process.
+func (s *Session) Recovered() bool {
+	return s.recovered
+}
+
+// Attached reports whether the session has a PTY. Only recovered sessions
+// can be without one.
+func (s *Session) Attached() bool {
+	return s.currentPTY() != nil
+}
+
+// Reattach attaches a PTY to a recovered tmux session that has none, at
+// cols x rows, or its last known size where zero. Returns
+// ErrAlreadyAttached if it has one and ErrTmuxSessionGone, after removing
+// the session, if its tmux session has ended.
+func (p *Pool) Reattach(s *Session, cols, rows uint16) error {
+	if s.TmuxSessionName == "" {
+		return fmt.Errorf("%w: %s", ErrNotTmux, s.ID)
+	}
+	s.attachMu.Lock()
+	defer s.attachMu.Unlock()
+	if s.currentPTY() != nil {
+		return ErrAlreadyAttached
+	}
+
+	s.ptyMu.Lock()
+	if cols == 0 {
+		cols = s.Cols
+	}
+	if rows == 0 {
+		rows = s.Rows
+	}
+	if c, r, clamped := clampSize(cols, rows, s.minSize); clamped {
+		cols, rows = c, r
+	}
+	s.Cols, s.Rows = cols, rows
+	s.ptyMu.Unlock()
+
+	err := p.ReattachTmux(s, cols, rows)
+	if errors.Is(err, ErrTmuxSessionGone) {
+		p.RemoveWithTmux(s.ID, false)
+	}
+	return err
+}
+
+// AttachRecovered attaches a PTY to a recovered session that has none yet,
+// at the session's last known size. Other sessions are left alone, so it is
+// safe to call before every connect.
+func (p *Pool) AttachRecovered(s *Session) error {
+	if !s.recovered {
+		return nil
+	}
+	if err := p.Reattach(s, 0, 0); err != nil && !errors.Is(err, ErrAlreadyAttached) {
+		return fmt.Errorf("failed to attach recovered session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package session
+
+import (
+	"regexp"
+	"time"
+)
+
+// redactReplacement replaces every redacted match in PTY output.
+const redactReplacement = "****"
+
+// redactFlushDelay is how long held-back output waits for more data before
+// being flushed, so interactive echo isn't delayed noticeably.
+const redactFlushDelay = 20 * time.Millisecond
+
+// redactMaxPending bounds held-back output so a pattern that keeps matching a
+// continuous stream can't buffer indefinitely.
+const redactMaxPending = 64 * 1024
+
+// redactor masks regex matches in PTY output. Because a match may be split
+// across reads, the last overlap bytes of each chunk are held back and
+// prepended to the next one; they are flushed once output goes quiet.
+type redactor struct {
+	patterns []*regexp.Regexp
+	overlap  int
+	pending  []byte
+}
+
+func newRedactor(patterns []*regexp.Regexp, overlap int) *redactor {
+	return &redactor{
+		patterns: patterns,
+		overlap:  overlap,
+	}
+}
+
+// Process redacts a chunk of output, returning the bytes that are safe to
+// emit now. Some trailing bytes may be retained until the next call or Flush.
+func (r *redactor) Process(data []byte) []byte {
+	buf := append(r.pending, data...)
+
+	cut := len(buf) - r.overlap
+	if cut <= 0 {
+		r.pending = buf
+		return nil
+	}
+
+	matches := r.findMatches(buf)
+	// Never split a match: if one spans the cut point, hold it back whole.
+	for _, m := range matches {
+		if m[0] < cut && m[1] > cut {
+			cut = m[0]
+		}
+	}
+
+	out := redactRange(buf[:cut], matches)
+	r.pending = append([]byte(nil), buf[cut:]...)
+	if len(r.pending) > redactMaxPending {
+		out = append(out, r.Flush()...)
+	}
+	return out
+}
+
+// Flush redacts and returns any held-back output.
+func (r *redactor) Flush() []byte {
+	if len(r.pending) == 0 {
+		return nil
+	}
+	buf := r.pending
+	r.pending = nil
+	return redactRange(buf, r.findMatches(buf))
+}
+
+// Redact masks every match in a complete buffer, such as a tmux capture,
+// independently of the stream Process works on.
+func (r *redactor) Redact(buf []byte) []byte {
+	return redactRange(buf, r.findMatches(buf))
+}
+
+// Redact masks the session's redaction patterns in output taken from
+// outside the PTY stream, e.g. tmux scrollback or screen captures, which
+// clients must not see unredacted either. Returns data as is without
+// patterns.
+func (s *Session) Redact(data []byte) []byte {
+	if s.redactor == nil {
+		return data
+	}
+	return s.redactor.Redact(data)
+}
+
+// Pending reports whether output is being held back.
+func (r *redactor) Pending() bool {
+	return len(r.pending) > 0
+}
+
+// findMatches returns the non-overlapping match ranges of all patterns in buf,
+// sorted by start offset. Earlier patterns win when matches overlap.
+func (r *redactor) findMatches(buf []byte) [][2]int {
+	var matches [][2]int
+	for _, re := range r.patterns {
+		for _, loc := range re.FindAllIndex(buf, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			m := [2]int{loc[0], loc[1]}
+			overlaps := false
+			for _, existing := range matches {
+				if m[0] < existing[1] && existing[0] < m[1] {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				matches = append(matches, m)
+			}
+		}
+	}
+
+	// Insertion sort; match counts per chunk are small.
+	for i := 1; i < len(matches); i++ {
+		for j := i; j > 0 && matches[j][0] < matches[j-1][0]; j-- {
+			matches[j], matches[j-1] = matches[j-1], matches[j]
+		}
+	}
+	return matches
+}
+
+// redactRange copies buf, replacing every match that lies within it.
+func redactRange(buf []byte, matches [][2]int) []byte {
+	out := make([]byte, 0, len(buf))
+	pos := 0
+	for _, m := range matches {
+		if m[1] > len(buf) {
+			break
+		}
+		out = append(out, buf[pos:m[0]]...)
+		out = append(out, redactReplacement...)
+		pos = m[1]
+	}
+	return append(out, buf[pos:]...)
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var testRedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`token=[a-z0-9]+`),
+	regexp.MustCompile(`AKIA[A-Z0-9]{8}`),
+}
+
+// processAll feeds chunks through a fresh redactor and flushes it, returning
+// everything it emitted.
+func processAll(overlap int, chunks ...string) string {
+	r := newRedactor(testRedactPatterns, overlap)
+	var out strings.Builder
+	for _, c := range chunks {
+		out.Write(r.Process([]byte(c)))
+	}
+	out.Write(r.Flush())
+	return out.String()
+}
+
+func TestRedactWholeBuffer(t *testing.T) {
+	r := newRedactor(testRedactPatterns, 16)
+	in := "a token=abc123 b AKIAABCD1234 c token=x"
+	want := "a **** b **** c ****"
+	if got := string(r.Redact([]byte(in))); got != want {
+		t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+	}
+	if r.Pending() {
+		t.Error("Redact left output pending")
+	}
+}
+
+func TestRedactProcessAtEverySplit(t *testing.T) {
+	in := "prompt$ export token=s3cr3t && aws AKIAABCD1234 done token=zz\r\n"
+	want := "prompt$ export **** && aws **** done ****\r\n"
+
+	if got := processAll(16, in); got != want {
+		t.Fatalf("single chunk = %q, want %q", got, want)
+	}
+	// Two chunks: the split point lands before, inside and after each match
+	for i := 0; i <= len(in); i++ {
+		if got := processAll(16, in[:i], in[i:]); got != want {
+			t.Errorf("split at %d (%q|%q) = %q, want %q", i, in[:i], in[i:], got, want)
+		}
+	}
+	// Three chunks, so a match can span a whole middle chunk
+	for i := 0; i <= len(in); i++ {
+		for j := i; j <= len(in); j++ {
+			if got := processAll(16, in[:i], in[i:j], in[j:]); got != want {
+				t.Fatalf("split at %d,%d = %q, want %q", i, j, got, want)
+			}
+		}
+	}
+}
+
+func TestRedactProcessByteAtATime(t *testing.T) {
+	in := "token=abcdef AKIAABCD1234"
+	chunks := strings.Split(in, "")
+	if got, want := processAll(16, chunks...), "**** ****"; got != want {
+		t.Errorf("byte at a time = %q, want %q", got, want)
+	}
+}
+
+func TestRedactHoldsBackOnlyTheOverlap(t *testing.T) {
+	r := newRedactor(testRedactPatterns, 4)
+	out := string(r.Process([]byte("hello world")))
+	if out != "hello w" {
+		t.Errorf("Process emitted %q, want %q", out, "hello w")
+	}
+	if !r.Pending() {
+		t.Fatal("nothing held back")
+	}
+	if got := string(r.Flush()); got != "orld" {
+		t.Errorf("Flush = %q, want %q", got, "orld")
+	}
+	if r.Pending() {
+		t.Error("output still pending after Flush")
+	}
+}
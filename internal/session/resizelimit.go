@@ -0,0 +1,61 @@
+package session
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// resizeLimitWarnInterval limits how often a resize storm is logged per session.
+const resizeLimitWarnInterval = time.Minute
+
+// resizeLimiter caps how often a session's PTY is resized. Resizes arriving
+// faster than the limit are coalesced: only the latest requested size is
+// applied, once the interval has passed.
+type resizeLimiter struct {
+	interval time.Duration
+
+	mu         sync.Mutex
+	last       time.Time   // when a resize was last applied
+	timer      *time.Timer // non-nil while a coalesced resize is scheduled
+	cols, rows uint16      // latest size requested while throttled
+	lastWarnAt time.Time
+}
+
+// admit reports whether a resize may be applied now. Otherwise the size is
+// remembered and apply is called with the latest one when the interval ends.
+func (l *resizeLimiter) admit(id string, cols, rows uint16, apply func(cols, rows uint16)) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.timer == nil && now.Sub(l.last) >= l.interval {
+		l.last = now
+		return true
+	}
+
+	l.cols, l.rows = cols, rows
+	if now.Sub(l.lastWarnAt) >= resizeLimitWarnInterval {
+		l.lastWarnAt = now
+		slog.Warn("Session resize rate limit exceeded, coalescing resizes", "id", id, "interval", l.interval)
+	}
+	if l.timer == nil {
+		l.timer = time.AfterFunc(l.interval-now.Sub(l.last), func() {
+			l.mu.Lock()
+			cols, rows := l.cols, l.rows
+			l.timer = nil
+			l.last = time.Now()
+			l.mu.Unlock()
+			apply(cols, rows)
+		})
+	}
+	return false
+}
+
+// applyCoalescedResize applies a resize deferred by the rate limiter.
+func (s *Session) applyCoalescedResize(cols, rows uint16) {
+	if err := s.resize(cols, rows); err != nil && !errors.Is(err, ErrSessionClosed) {
+		slog.Warn("Failed to apply coalesced resize", "id", s.ID, "cols", cols, "rows", rows, "error", err)
+	}
+}
@@ -0,0 +1,47 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResizeFloodThrottled(t *testing.T) {
+	p := testPool(t, PoolConfig{MaxResizeRate: 2})
+	sess, err := p.Create(CreateOptions{Command: "/bin/cat"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	before := sess.Metrics().ResizeCount
+
+	for i := range 1000 {
+		if err := sess.Resize(uint16(80+i%100), uint16(24+i%20)); err != nil {
+			t.Fatalf("Resize: %v", err)
+		}
+	}
+	if err := sess.Resize(200, 50); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	// Only the first went through right away
+	if n := sess.Metrics().ResizeCount - before; n != 1 {
+		t.Errorf("%d resizes applied during the flood, want 1", n)
+	}
+
+	// The latest size follows once the interval is up
+	deadline := time.Now().Add(5 * time.Second)
+	for sess.Metrics().ResizeCount-before < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("coalesced resize never applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(time.Second)
+	if n := sess.Metrics().ResizeCount - before; n != 2 {
+		t.Errorf("%d resizes applied in all, want 2", n)
+	}
+	sess.ptyMu.Lock()
+	cols, rows := sess.Cols, sess.Rows
+	sess.ptyMu.Unlock()
+	if cols != 200 || rows != 50 {
+		t.Errorf("size %dx%d after the flood, want the latest 200x50", cols, rows)
+	}
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/pty"
+)
+
+// RestartPolicy controls what happens when a session's command exits.
+type RestartPolicy string
+
+const (
+	RestartNever     RestartPolicy = "never"      // Close the session (default)
+	RestartOnFailure RestartPolicy = "on-failure" // Respawn the command after a nonzero exit
+)
+
+// ControlTypeRestart signals that the command failed and was respawned.
+const ControlTypeRestart = "restart"
+
+// maxRestartBackoff caps the doubling delay between restarts.
+const maxRestartBackoff = time.Minute
+
+// restarter respawns a session's command after it fails. It is only used by
+// the session's readPTY goroutine, except that Exec swaps spawn and resets
+// attempts for the new command.
+type restarter struct {
+	spawn      func(cols, rows uint16) (*pty.PTY, error) // guarded by the session's ptyMu
+	maxRetries int
+	backoff    time.Duration
+	attempts   int // guarded by the session's ptyMu
+}
+
+// restart is called by readPTY once the PTY stops producing output, with the
+// command's exit code. If the command failed and retries remain, it respawns the command after a backoff,
+// swaps in the new PTY, notifies clients and returns it. Otherwise it returns
+// nil and the session should close.
+func (s *Session) restart(old *pty.PTY, code int) *pty.PTY {
+	r := s.restarter
+	if r == nil || s.IsClosed() {
+		return nil
+	}
+
+	if code == 0 {
+		slog.Info("Command exited cleanly, not restarting", "id", s.ID, "command", s.Command)
+		return nil
+	}
+	s.ptyMu.Lock()
+	if s.PTY != old {
+		// Exec replaced the command; its failure doesn't count
+		s.ptyMu.Unlock()
+		return nil
+	}
+	if r.attempts >= r.maxRetries {
+		s.ptyMu.Unlock()
+		slog.Warn("Command failed, restart limit reached", "id", s.ID, "command", s.Command, "exit_code", code, "restarts", r.maxRetries)
+		return nil
+	}
+	delay := r.backoff << r.attempts
+	if delay <= 0 || delay > maxRestartBackoff {
+		delay = maxRestartBackoff
+	}
+	r.attempts++
+	attempt := r.attempts
+	s.ptyMu.Unlock()
+	slog.Warn("Command failed, restarting", "id", s.ID, "command", s.Command, "exit_code", code, "attempt", attempt, "delay", delay)
+
+	select {
+	case <-time.After(delay):
+	case <-s.done:
+		return nil
+	}
+
+	s.ptyMu.Lock()
+	if s.IsClosed() || s.PTY != old {
+		// Closed, or Exec replaced the command while we waited
+		s.ptyMu.Unlock()
+		return nil
+	}
+	next, err := r.spawn(s.Cols, s.Rows)
+	if err != nil {
+		s.ptyMu.Unlock()
+		slog.Error("Failed to restart command", "id", s.ID, "command", s.Command, "error", err)
+		return nil
+	}
+	s.PTY = next
+	s.ptyMu.Unlock()
+	old.Close()
+
+	s.sendControl(ControlMessage{Type: ControlTypeRestart, Attempt: attempt, ExitCode: code})
+	return next
+}
@@ -0,0 +1,73 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRestartOnFailure(t *testing.T) {
+	p := testPool(t, PoolConfig{RestartMaxRetries: 1, RestartBackoff: 200 * time.Millisecond})
+	sess, err := p.Create(CreateOptions{
+		Command:       "/bin/sh",
+		Args:          []string{"-c", "exit 1"},
+		RestartPolicy: RestartOnFailure,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	server, conn := wsPair(t)
+	if err := sess.AddClient(server, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+
+	// The command fails, is restarted once, fails again and the session ends
+	var controls []ControlMessage
+	var closeErr *websocket.CloseError
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("read: %v", err)
+			}
+			break
+		}
+		if kind != websocket.TextMessage {
+			continue
+		}
+		var msg ControlMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("control message %q: %v", data, err)
+		}
+		controls = append(controls, msg)
+	}
+
+	var restarts []ControlMessage
+	var exit *ControlMessage
+	for i, msg := range controls {
+		switch msg.Type {
+		case ControlTypeRestart:
+			restarts = append(restarts, msg)
+		case ControlTypeExit:
+			exit = &controls[i]
+		}
+	}
+	if len(restarts) != 1 || restarts[0].Attempt != 1 || restarts[0].ExitCode != 1 {
+		t.Errorf("restart messages = %+v, want one for attempt 1 with exit code 1", restarts)
+	}
+	if exit == nil || exit.Code == nil || *exit.Code != 1 {
+		t.Errorf("exit message = %+v, want exit code 1", exit)
+	}
+	if closeErr.Code != CloseCode4003 {
+		t.Errorf("close code = %d, want %d", closeErr.Code, CloseCode4003)
+	}
+	select {
+	case <-sess.done:
+	case <-time.After(5 * time.Second):
+		t.Error("session still open after the restart limit was reached")
+	}
+}
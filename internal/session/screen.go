@@ -0,0 +1,36 @@
+package session
+
+import (
+	"errors"
+
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
+)
+
+// ErrNoHistory is returned by Screen for direct sessions that keep no
+// output history.
+var ErrNoHistory = errors.New("session keeps no output history")
+
+// Screen returns what the session's terminal currently shows, with escape
+// sequences. tmux sessions capture the visible pane. Direct sessions have no
+// terminal state to read back, so they return their output history, the
+// same a connecting client replays, which ends with the current screen.
+// Like that history, the result is redacted.
+func (s *Session) Screen() ([]byte, error) {
+	if s.TmuxSessionName != "" {
+		screen, err := tmux.CaptureScreen(s.TmuxSessionName, true)
+		if err != nil {
+			return nil, err
+		}
+		return s.Redact([]byte(screen)), nil
+	}
+
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	switch {
+	case s.spool != nil:
+		return s.spool.ReadTail(s.spoolReplayBytes)
+	case s.scrollback != nil:
+		return s.scrollback.Bytes(), nil
+	}
+	return nil, ErrNoHistory
+}
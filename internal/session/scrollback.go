@@ -0,0 +1,80 @@
+package session
+
+import "sync"
+
+// scrollback keeps the most recent output of a direct (non-tmux) session in
+// a fixed-size ring so reconnecting clients see prior context instead of a
+// blank screen. Older output is overwritten once the ring is full.
+type scrollback struct {
+	mu   sync.Mutex
+	buf  []byte
+	next int  // index the next byte is written at
+	full bool // buf has wrapped at least once
+}
+
+func newScrollback(size int) *scrollback {
+	return &scrollback{buf: make([]byte, size)}
+}
+
+// Write appends data, overwriting the oldest bytes when the ring is full.
+func (sb *scrollback) Write(data []byte) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if len(data) >= len(sb.buf) {
+		copy(sb.buf, data[len(data)-len(sb.buf):])
+		sb.next = 0
+		sb.full = true
+		return
+	}
+	n := copy(sb.buf[sb.next:], data)
+	if n < len(data) {
+		copy(sb.buf, data[n:])
+		sb.full = true
+	}
+	sb.next = (sb.next + len(data)) % len(sb.buf)
+	if sb.next == 0 {
+		sb.full = true
+	}
+}
+
+// Len returns how much output is retained.
+func (sb *scrollback) Len() int {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.full {
+		return len(sb.buf)
+	}
+	return sb.next
+}
+
+// Bytes returns a copy of the retained output, oldest first.
+func (sb *scrollback) Bytes() []byte {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if !sb.full {
+		return append([]byte(nil), sb.buf[:sb.next]...)
+	}
+	out := make([]byte, 0, len(sb.buf))
+	out = append(out, sb.buf[sb.next:]...)
+	return append(out, sb.buf[:sb.next]...)
+}
+
+// ReplayBytes returns how much output history a client joining now would be
+// sent before live output, e.g. so a client taking over the session can show
+// a loading state.
+func (s *Session) ReplayBytes() int64 {
+	if s.spool != nil {
+		n := s.spool.Size()
+		if s.spoolReplayBytes > 0 && n > s.spoolReplayBytes {
+			n = s.spoolReplayBytes
+		}
+		return n
+	}
+	if s.scrollback != nil {
+		return int64(s.scrollback.Len())
+	}
+	return 0
+}
@@ -1,11 +1,16 @@
 package session
 
 import (
+	"errors"
+	"log/slog"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/itsmylife44/terminus-pty/internal/pty"
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
 )
 
 type Session struct {
@@ -16,17 +21,81 @@ type Session struct {
 	CreatedAt       time.Time
 	DisconnectedAt  *time.Time
 	TmuxSessionName string // tmux session name when TmuxEnabled, empty otherwise
+	Command         string // command actually spawned, after defaults and fallback
+	Args            []string
 	LastActivityAt  time.Time
 
-	clients           map[*websocket.Conn]string // maps connection to client ID
+	clients           map[*websocket.Conn]*client
+	observers         map[*websocket.Conn]*client // read-only clients; never the active client
 	clientsMu         sync.RWMutex
 	connectedClientId string // current active client ID (empty if no clients)
-	broadcast         chan []byte
+	reservedFor       string // client ID a takeover reserved the session for
+	reservedUntil     time.Time
+	broadcast         chan *chunk
+	readPool          *sync.Pool // buffers PTY output is read into
+	batchPool         *sync.Pool // buffers coalesced output is merged into, nil unless batching
+	outputBatchBytes  int
+	outbox            chan outFrame // frames sent to all clients as-is, bypassing output processing
+	spool             *spool        // disk-backed output history, nil unless spooling is enabled
+	spoolReplayBytes  int64
+	scrollback        *scrollback    // in-memory output history for direct sessions without a spool
+	tmuxReplayLines   int            // pane history lines a tmux session sends to joining clients
+	bell              *bellDetector  // non-nil when bell events are enabled
+	transcoder        *transcoder    // non-nil when output is converted from a legacy charset
+	redactor          *redactor      // non-nil when output redaction is configured
+	recorder          *recorder      // non-nil when output is recorded to a cast file
+	restarter         *restarter     // non-nil when the command restarts on failure
+	verifyResize      bool           // read the size back after resizing and retry once
+	minSize           pty.Size       // smaller resizes are clamped up to this
+	maxOutputBytes    int64          // total output after which the session is terminated (0 = unlimited)
+	timeout           time.Duration  // overrides PoolConfig.SessionTimeout when non-zero
+	banner            []byte         // shown to the first client to attach, then cleared; guarded by clientsMu
+	name              string         // human-friendly label; guarded by clientsMu
+	exitStatus        *ExitStatus    // set when the command exited by itself; guarded by clientsMu
+	drained           chan struct{}  // closed when the broadcast goroutine reaches the end-of-output marker
+	resizeLimiter     *resizeLimiter // non-nil when resizes are rate limited
+	outputLimiter     *outputLimiter // non-nil when output is rate limited
+	writeTimeout      time.Duration  // bounds each write to a client
+	inputReplayWindow time.Duration  // how long sequenced input state outlives its client
+	inputMu           sync.Mutex
+	inputSeqs         map[string]*inputState // by client ID; guarded by inputMu
 	done              chan struct{}
 	closeOnce         sync.Once
+	ptyMu             sync.RWMutex  // guards the PTY pointer, which ReplacePTY swaps
+	readerDone        chan struct{} // closed when the current readPTY goroutine exits; guarded by ptyMu
+
+	workdir        string            // working directory of the command; guarded by ptyMu
+	env            map[string]string // extra environment of the command; guarded by ptyMu
+	lineMode       pty.LineMode      // terminal attributes reapplied when the command is respawned
+	bracketedPaste bool              // wrap pastes in bracketed-paste sequences
+	tmuxTerm       string            // TERM inside tmux panes, reapplied when the command is replaced
+	singleWriter   bool              // reject a second writing client instead of letting both type
+
+	recovered bool       // adopted from tmux after a server restart
+	attachMu  sync.Mutex // serializes attaching a recovered session's PTY
+
+	debug              atomic.Bool  // log per-read/write/broadcast details for this session only
+	lastInputAt        atomic.Int64 // unix nanos of the last client input written to the PTY
+	lastOutputAt       atomic.Int64 // unix nanos of the last PTY output
+	inputIdleWarnedAt  time.Time    // owned by Pool.cleanup
+	outputIdleWarnedAt time.Time    // owned by Pool.cleanup
+
+	metrics metrics
+	prom    promCounters
 }
 
+// ErrSessionClosed is returned by operations on a session that has been closed.
+var ErrSessionClosed = errors.New("session is closed")
+
 func NewSession(id string, p *pty.PTY, cols, rows uint16) *Session {
+	s := newSession(id, p, cols, rows)
+	s.start()
+	return s
+}
+
+// newSession builds a session without starting its I/O goroutines, so the
+// pool can configure output processing before any output is read.
+func newSession(id string, p *pty.PTY, cols, rows uint16) *Session {
 	now := time.Now()
 	s := &Session{
 		ID:             id,
@@ -35,83 +104,352 @@ func NewSession(id string, p *pty.PTY, cols, rows uint16) *Session {
 		Rows:           rows,
 		CreatedAt:      now,
 		LastActivityAt: now,
-		clients:        make(map[*websocket.Conn]string),
-		broadcast:      make(chan []byte, 256),
+		clients:        make(map[*websocket.Conn]*client),
+		observers:      make(map[*websocket.Conn]*client),
+		broadcast:      make(chan *chunk, 256),
+		outbox:         make(chan outFrame, 16),
 		done:           make(chan struct{}),
+		drained:        make(chan struct{}),
+		writeTimeout:   DefaultWriteTimeout,
 	}
+	// Set here too, so a session closed before it starts, e.g. when its
+	// output setup fails, can still count its disconnects
+	s.prom = newPromCounters(p != nil && p.IsTmux())
+	s.lastInputAt.Store(now.UnixNano())
+	s.lastOutputAt.Store(now.UnixNano())
+	s.configureOutput(DefaultReadBufferSize, 0)
+	return s
+}
 
-	go s.readPTY()
+// start launches the PTY read and broadcast goroutines.
+func (s *Session) start() {
+	s.prom = newPromCounters(s.PTY != nil && s.PTY.IsTmux())
+	s.readerDone = make(chan struct{})
+	go s.readPTY(s.PTY, s.readerDone)
 	go s.broadcastLoop()
-
-	return s
 }
 
-func (s *Session) readPTY() {
-	buf := make([]byte, 4096)
+// readPTY copies output from p to the broadcast channel and closes done when
+// it exits. The goroutine only ever blocks in the Read syscall, so idle
+// sessions cost no CPU; it exits when the read fails, which Close triggers by
+// closing the PTY. If p was replaced by ReplacePTY the session stays open.
+func (s *Session) readPTY(p *pty.PTY, done chan struct{}) {
+	defer close(done)
 	for {
+		out := getChunk(s.readPool)
+		n, err := p.Read(out.buf)
+		if err != nil {
+			out.release()
+			if s.currentPTY() != p {
+				// Replaced; the reader for the new PTY takes over
+				return
+			}
+			if s.IsClosed() {
+				return
+			}
+			exit := commandExit(p)
+			if next := s.restart(p, exit.Code); next != nil {
+				p = next
+				continue
+			}
+			if s.currentPTY() != p {
+				// Replaced while the exit was being handled
+				return
+			}
+			s.finishExit(exit)
+			s.Close()
+			return
+		}
+		if n == 0 {
+			out.release()
+			continue
+		}
+		s.lastOutputAt.Store(time.Now().UnixNano())
+		total := s.metrics.bytesOut.Add(int64(n))
+		s.prom.bytesOut.Add(float64(n))
+		if s.maxOutputBytes > 0 && total > s.maxOutputBytes {
+			slog.Warn("Session exceeded output limit, terminating", "id", s.ID, "limit", s.maxOutputBytes)
+			out.release()
+			s.DisconnectAllClients(CloseCode4002, "output limit exceeded")
+			s.CloseWithTmux()
+			return
+		}
+		if s.debug.Load() {
+			s.debugLog("PTY read", "bytes", n)
+		}
+
+		out.data = out.buf[:n]
 		select {
+		case s.broadcast <- out:
 		case <-s.done:
+			out.release()
 			return
 		default:
-			n, err := s.PTY.Read(buf)
-			if err != nil {
-				s.Close()
-				return
-			}
-			if n > 0 {
-				data := make([]byte, n)
-				copy(data, buf[:n])
-				select {
-				case s.broadcast <- data:
-				case <-s.done:
-					return
-				default:
-				}
-			}
+			// Broadcast backlog is full; drop rather than stall the reader
+			out.release()
+		}
+		if s.outputLimiter != nil && !s.throttleOutput(n) {
+			return
 		}
 	}
 }
 
 func (s *Session) broadcastLoop() {
+	var flush <-chan time.Time
 	for {
 		select {
 		case <-s.done:
 			return
-		case data := <-s.broadcast:
-			s.broadcastToClients(data)
+		case out := <-s.broadcast:
+			end := out == nil
+			if !end && s.outputBatchBytes > 0 {
+				out, end = s.coalesce(out)
+			}
+			if out != nil && s.processOutput(out) {
+				flush = time.After(redactFlushDelay)
+			}
+			if end {
+				// End of output: flush anything held back and signal readPTY
+				if s.redactor != nil {
+					flush = nil
+					if data := s.redactor.Flush(); len(data) > 0 {
+						s.broadcastToClients(unpooled(data))
+					}
+				}
+				close(s.drained)
+			}
+		case <-flush:
+			flush = nil
+			if data := s.redactor.Flush(); len(data) > 0 {
+				s.broadcastToClients(unpooled(data))
+			}
+		case frame := <-s.outbox:
+			s.broadcastFrame(outFrame{messageType: frame.messageType, data: frame.data})
+			if frame.sent != nil {
+				close(frame.sent)
+			}
 		}
 	}
 }
 
-func (s *Session) broadcastToClients(data []byte) {
+// outFrame is a WebSocket message queued for all clients.
+type outFrame struct {
+	messageType int
+	data        []byte
+	sent        chan struct{} // closed once queued to every client, if non-nil
+	chunk       *chunk        // output buffer data is in, released once written
+}
+
+// sendFrame queues a message for all clients. It is delivered by the
+// broadcast goroutine, so it never races with output writes on a connection.
+func (s *Session) sendFrame(messageType int, data []byte) {
+	select {
+	case s.outbox <- outFrame{messageType: messageType, data: data}:
+	case <-s.done:
+	}
+}
+
+// broadcastToClients records output in the session's history and queues it
+// for all clients. The caller keeps its reference to out.
+func (s *Session) broadcastToClients(out *chunk) {
+	data := out.data
 	s.clientsMu.RLock()
-	clients := make([]*websocket.Conn, 0, len(s.clients))
-	for client := range s.clients {
-		clients = append(clients, client)
+	// Record history under the clients lock so a joining client either
+	// replays this chunk or receives it live, never both.
+	if s.spool != nil {
+		if err := s.spool.Write(data); err != nil {
+			slog.Warn("Failed to spool output", "id", s.ID, "error", err)
+		}
 	}
+	if s.scrollback != nil {
+		s.scrollback.Write(data)
+	}
+	rang := s.bell != nil && s.bell.Scan(data)
 	s.clientsMu.RUnlock()
+	if s.recorder != nil {
+		s.recorder.Output(data)
+	}
+
+	s.broadcastFrame(outFrame{messageType: websocket.BinaryMessage, data: data, chunk: out})
+	if rang {
+		s.broadcastControl(ControlMessage{Type: ControlTypeBell})
+	}
+}
 
-	var failed []*websocket.Conn
-	for _, client := range clients {
-		if err := client.WriteMessage(websocket.BinaryMessage, data); err != nil {
-			failed = append(failed, client)
+// broadcastFrame queues a single WebSocket message for all connected
+// clients. It never blocks on a connection: a client whose queue is full is
+// disconnected with CloseCode4005 instead.
+func (s *Session) broadcastFrame(frame outFrame) {
+	var slow []*client
+	s.clientsMu.RLock()
+	count := len(s.clients) + len(s.observers)
+	for _, c := range s.clients {
+		if !c.queue(frame) {
+			slow = append(slow, c)
 		}
 	}
+	for _, c := range s.observers {
+		if !c.queue(frame) {
+			slow = append(slow, c)
+		}
+	}
+	s.clientsMu.RUnlock()
+	if s.debug.Load() {
+		s.debugLog("Broadcast", "bytes", len(frame.data), "clients", count, "slow", len(slow))
+	}
 
-	for _, client := range failed {
-		client.Close()
+	if len(slow) > 0 {
+		s.dropSlow(slow)
 	}
 }
 
-// AddClient registers a new WebSocket client with a client ID.
-// Returns the generated client ID.
-func (s *Session) AddClient(conn *websocket.Conn, clientID string) {
+// dropSlow disconnects clients that fell clientQueueSize frames behind. The
+// close frames are sent after releasing clientsMu: a slow client's full
+// socket could hold them up for closeFrameTimeout, stalling everyone else.
+func (s *Session) dropSlow(slow []*client) {
 	s.clientsMu.Lock()
-	s.clients[conn] = clientID
+	dropped := slow[:0]
+	for _, c := range slow {
+		if s.removeLocked(c.conn) != c {
+			// Already removed, e.g. it disconnected meanwhile
+			continue
+		}
+		slog.Warn("Client too slow, disconnecting", "id", s.ID, "clientId", c.id)
+		close(c.send)
+		dropped = append(dropped, c)
+	}
+	s.clientsMu.Unlock()
+
+	for _, c := range dropped {
+		c.closeConn(CloseCode4005, "too slow")
+	}
+}
+
+// AddClient registers a new WebSocket client with a client ID and sends it a
+// ready control message. If the session spools output or keeps scrollback, that history is replayed
+// to the new client before it joins the live broadcast; tmux sessions replay
+// the captured pane history instead. The first client to attach
+// also receives the session's banner, if any. Returns ErrSessionReserved
+// if a recent takeover reserved the session for a different client, and
+// ErrSessionOccupied if the pool is in single-writer mode and another client
+// is already attached.
+func (s *Session) AddClient(conn *websocket.Conn, clientID string) error {
+	ready, history := s.readyFrame(clientID), s.tmuxHistory()
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	if s.reservedFor != "" {
+		if time.Now().Before(s.reservedUntil) && clientID != s.reservedFor {
+			return ErrSessionReserved
+		}
+		s.reservedFor = ""
+	}
+	if s.singleWriter && len(s.clients) > 0 {
+		return ErrSessionOccupied
+	}
+
+	c := s.newClient(conn, clientID)
+	replayed := s.welcomeLocked(c, ready, history)
+	s.clients[conn] = c
 	s.connectedClientId = clientID
+	s.joinedLocked()
+	if replayed {
+		go s.redrawTmux()
+	}
+	return nil
+}
+
+// AddObserver registers a read-only client. Observers receive the same ready
+// message, history and output as AddClient's clients, but never become the
+// active client, so they don't make the session occupied and aren't blocked
+// by a takeover reservation.
+func (s *Session) AddObserver(conn *websocket.Conn, clientID string) {
+	ready, history := s.readyFrame(clientID), s.tmuxHistory()
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	c := s.newClient(conn, clientID)
+	replayed := s.welcomeLocked(c, ready, history)
+	s.observers[conn] = c
+	s.joinedLocked()
+	if replayed {
+		go s.redrawTmux()
+	}
+}
+
+// welcomeLocked queues the ready message and output history for a joining
+// client and, for the first client only, the banner. tmuxHist is the pane
+// history from tmuxHistory, captured before taking clientsMu since it runs
+// tmux. Reports whether tmux pane history was replayed. Must be called with
+// clientsMu held, before c joins the maps.
+func (s *Session) welcomeLocked(c *client, ready outFrame, tmuxHist []byte) bool {
+	c.queue(ready)
+	replayed := false
+	if s.spool != nil {
+		history, err := s.spool.ReadTail(s.spoolReplayBytes)
+		if err != nil {
+			slog.Warn("Failed to read spool", "id", s.ID, "error", err)
+		} else if len(history) > 0 {
+			c.queue(outFrame{messageType: websocket.BinaryMessage, data: history})
+		}
+	} else if s.scrollback != nil {
+		if history := s.scrollback.Bytes(); len(history) > 0 {
+			c.queue(outFrame{messageType: websocket.BinaryMessage, data: history})
+		}
+	} else if len(tmuxHist) > 0 {
+		c.queue(outFrame{messageType: websocket.BinaryMessage, data: tmuxHist})
+		replayed = true
+	}
+	if s.banner != nil {
+		c.queue(outFrame{messageType: websocket.BinaryMessage, data: s.banner})
+		s.banner = nil
+	}
+	return replayed
+}
+
+// tmuxHistory captures the last tmuxReplayLines lines of a tmux session's
+// pane, ending with the visible screen. The tmux client attached to the PTY
+// only repaints the visible pane, so without it a reconnecting client would
+// miss whatever scrolled by while it was away. The escape sequences tmux
+// captures render as-is; only line endings need converting for a terminal.
+// The capture bypasses the output stream, so it is redacted here.
+func (s *Session) tmuxHistory() []byte {
+	if s.TmuxSessionName == "" || s.tmuxReplayLines <= 0 {
+		return nil
+	}
+	history, err := tmux.CapturePaneEscaped(s.TmuxSessionName, s.tmuxReplayLines)
+	if err != nil {
+		slog.Warn("Failed to capture tmux pane", "id", s.ID, "error", err)
+		return nil
+	}
+	history = strings.TrimSuffix(history, "\n")
+	return s.Redact([]byte(strings.ReplaceAll(history, "\n", "\r\n")))
+}
+
+// redrawTmux has tmux repaint the pane after a client was sent its history,
+// so the screen and cursor match the pane again, including any output the
+// client missed between the capture and joining the broadcast.
+func (s *Session) redrawTmux() {
+	if err := tmux.RefreshClients(s.TmuxSessionName); err != nil {
+		slog.Warn("Failed to redraw tmux pane", "id", s.ID, "error", err)
+	}
+}
+
+// joinedLocked updates bookkeeping after a client or observer joined. Must
+// be called with clientsMu held.
+func (s *Session) joinedLocked() {
+	s.metrics.observeClients(len(s.clients) + len(s.observers))
+	s.prom.connects.Inc()
 	s.DisconnectedAt = nil
 	s.LastActivityAt = time.Now()
-	s.clientsMu.Unlock()
+}
+
+// CanJoin reports whether a client with clientID may currently attach, i.e.
+// the session is not reserved for someone else by a takeover.
+func (s *Session) CanJoin(clientID string) bool {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	return s.reservedFor == "" || clientID == s.reservedFor || !time.Now().Before(s.reservedUntil)
 }
 
 // UpdateActivity updates the last activity timestamp.
@@ -130,23 +468,74 @@ func (s *Session) GetLastActivity() time.Time {
 
 func (s *Session) RemoveClient(conn *websocket.Conn) {
 	s.clientsMu.Lock()
-	clientID := s.clients[conn]
+	defer s.clientsMu.Unlock()
+
+	if c := s.removeLocked(conn); c != nil {
+		c.finish(0, "")
+	}
+}
+
+// removeLocked removes conn from the clients or observers and returns it, or
+// nil if it was already dropped, e.g. by a takeover. The caller stops the
+// returned client. Must be called with clientsMu held.
+func (s *Session) removeLocked(conn *websocket.Conn) *client {
+	if c, ok := s.observers[conn]; ok {
+		delete(s.observers, conn)
+		s.prom.disconnects.Inc()
+		s.markDisconnectedLocked()
+		return c
+	}
+
+	c, ok := s.clients[conn]
+	if !ok {
+		// Don't disturb the new occupant
+		return nil
+	}
 	delete(s.clients, conn)
-	// Clear connectedClientId if the removed client was the active one
-	if s.connectedClientId == clientID {
+	s.prom.disconnects.Inc()
+	s.inputLeft(c.id)
+	// Hand the active client ID to a remaining client if the active one left
+	if s.connectedClientId == c.id {
 		s.connectedClientId = ""
+		for _, remaining := range s.clients {
+			s.connectedClientId = remaining.id
+			break
+		}
 	}
-	if len(s.clients) == 0 {
+	s.markDisconnectedLocked()
+	return c
+}
+
+// markDisconnectedLocked starts the disconnect timeout once neither clients
+// nor observers remain. Must be called with clientsMu held.
+func (s *Session) markDisconnectedLocked() {
+	if len(s.clients) == 0 && len(s.observers) == 0 {
 		now := time.Now()
 		s.DisconnectedAt = &now
 	}
-	s.clientsMu.Unlock()
 }
 
+// Disconnected reports whether every client and observer has left, so the
+// session expires after the session timeout unless one reconnects. Sessions
+// nobody has connected to yet are not disconnected.
+func (s *Session) Disconnected() bool {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	return s.DisconnectedAt != nil
+}
+
+// ClientCount returns the number of connected clients, including observers.
 func (s *Session) ClientCount() int {
 	s.clientsMu.RLock()
 	defer s.clientsMu.RUnlock()
-	return len(s.clients)
+	return len(s.clients) + len(s.observers)
+}
+
+// ObserverCount returns the number of connected read-only observers.
+func (s *Session) ObserverCount() int {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	return len(s.observers)
 }
 
 // IsOccupied returns true if there's at least one connected client.
@@ -166,33 +555,282 @@ func (s *Session) ConnectedClientID() string {
 // CloseCode4001 is the WebSocket close code for session takeover.
 const CloseCode4001 = 4001
 
-// DisconnectAllClients disconnects all connected clients with a close frame.
-// Used for session takeover. Returns the number of clients disconnected.
+// CloseCode4002 is the WebSocket close code for a session terminated for
+// exceeding its output limit.
+const CloseCode4002 = 4002
+
+// CloseCode4003 is the WebSocket close code for a session whose command
+// exited on its own.
+const CloseCode4003 = 4003
+
+// CloseCode4004 is the WebSocket close code for a session closed after
+// PoolConfig.IdleTimeout without input or output.
+const CloseCode4004 = 4004
+
+// CloseCode4005 is the WebSocket close code for a client that fell too far
+// behind the session's output.
+const CloseCode4005 = 4005
+
+// CloseCode4006 is the WebSocket close code for a tmux session whose tmux
+// session ended.
+const CloseCode4006 = 4006
+
+// CloseCode4007 is the WebSocket close code for a session closed by the
+// pool's cleanup after its session timeout, or whose tmux session was
+// killed for inactivity. Such sessions had no clients when checked, so this
+// reaches only clients that connected just as the session expired.
+const CloseCode4007 = 4007
+
+// CloseCode4008 is the WebSocket close code for a session closed because the
+// server is shutting down.
+const CloseCode4008 = 4008
+
+// CloseCode4009 is the WebSocket close code for a client that lost a race
+// for a single-writer session to another client connecting at the same time.
+const CloseCode4009 = 4009
+
+// takeoverReservation is how long a takeover keeps the session reserved for
+// the taking client, so a displaced client that reconnects automatically
+// can't slip in first.
+const takeoverReservation = 10 * time.Second
+
+// ErrSessionReserved is returned by AddClient when a takeover reserved the
+// session for a different client.
+var ErrSessionReserved = errors.New("session is reserved for another client")
+
+// ErrSessionOccupied is returned by AddClient in single-writer mode when the
+// session already has a writing client.
+var ErrSessionOccupied = errors.New("session already has a writer")
+
+// closeFrameTimeout bounds how long sending a close frame may block.
+const closeFrameTimeout = time.Second
+
+// DisconnectAllClients disconnects all connected clients and observers with
+// a close frame, after the output already queued for them. Returns the
+// number of connections closed.
 func (s *Session) DisconnectAllClients(closeCode int, closeMessage string) int {
 	s.clientsMu.Lock()
 	defer s.clientsMu.Unlock()
+	count, _ := s.disconnectLocked(closeCode, closeMessage, true, true)
+	return count
+}
 
-	count := len(s.clients)
-	for conn := range s.clients {
-		// Send close frame with custom code and message
-		conn.WriteMessage(websocket.CloseMessage,
-			websocket.FormatCloseMessage(closeCode, closeMessage))
-		conn.Close()
+// Takeover disconnects all clients and reserves the session for newClientID,
+// atomically with respect to AddClient, so after a takeover the intended
+// client is the only one that can attach until the reservation lapses.
+// Observers keep watching unless dropObservers is set.
+// Returns the number of connections closed.
+func (s *Session) Takeover(newClientID string, closeCode int, closeMessage string, dropObservers bool) int {
+	s.clientsMu.Lock()
+	count, dropped := s.disconnectLocked(closeCode, closeMessage, dropObservers, false)
+	s.reservedFor = newClientID
+	s.reservedUntil = time.Now().Add(takeoverReservation)
+	s.clientsMu.Unlock()
+
+	for _, c := range dropped {
+		c.closeConn(closeCode, closeMessage)
 	}
-	s.clients = make(map[*websocket.Conn]string)
-	s.connectedClientId = ""
 	return count
 }
 
+// disconnectLocked stops all clients, and observers too if withObservers is
+// set. With flush, each client is sent its queued output before the close
+// frame; otherwise queued output is discarded and the stopped clients are
+// returned, for the caller to close with closeConn after releasing
+// clientsMu. Must be called with clientsMu held. Returns the number of
+// clients stopped.
+func (s *Session) disconnectLocked(closeCode int, closeMessage string, withObservers, flush bool) (int, []*client) {
+	count := len(s.clients)
+	dropped := closeClients(nil, s.clients, closeCode, closeMessage, flush)
+	s.clients = make(map[*websocket.Conn]*client)
+	s.connectedClientId = ""
+	if withObservers {
+		count += len(s.observers)
+		dropped = closeClients(dropped, s.observers, closeCode, closeMessage, flush)
+		s.observers = make(map[*websocket.Conn]*client)
+	}
+	s.prom.disconnects.Add(float64(count))
+	if count > 0 {
+		s.markDisconnectedLocked()
+	}
+	return count, dropped
+}
+
+// closeClients stops each client, see disconnectLocked. Unless flush is set,
+// the stopped clients are appended to dropped, whose connections are still
+// to be closed.
+func closeClients(dropped []*client, clients map[*websocket.Conn]*client, closeCode int, closeMessage string, flush bool) []*client {
+	for _, c := range clients {
+		if flush {
+			c.finish(closeCode, closeMessage)
+		} else {
+			c.drop()
+			dropped = append(dropped, c)
+		}
+	}
+	return dropped
+}
+
+// currentPTY returns the PTY currently attached to the session.
+func (s *Session) currentPTY() *pty.PTY {
+	s.ptyMu.RLock()
+	defer s.ptyMu.RUnlock()
+	return s.PTY
+}
+
+// attachPID returns the PID of the process attaching this session's PTY to
+// tmux, or 0 if there is none.
+func (s *Session) attachPID() int {
+	p := s.currentPTY()
+	if p == nil || !p.IsTmux() || p.Cmd == nil || p.Cmd.Process == nil || s.IsClosed() {
+		return 0
+	}
+	return p.Cmd.Process.Pid
+}
+
+// Write sends input to the PTY. Returns ErrSessionClosed if the session is
+// closed, including when Close races with the write.
 func (s *Session) Write(data []byte) error {
-	_, err := s.PTY.Write(data)
-	return err
+	p := s.currentPTY()
+	if p == nil || s.IsClosed() {
+		return ErrSessionClosed
+	}
+	if _, err := p.Write(data); err != nil {
+		if s.IsClosed() {
+			return ErrSessionClosed
+		}
+		return err
+	}
+	s.lastInputAt.Store(time.Now().UnixNano())
+	s.metrics.bytesIn.Add(int64(len(data)))
+	s.prom.bytesIn.Add(float64(len(data)))
+	if s.debug.Load() {
+		s.debugLog("PTY write", "bytes", len(data))
+	}
+	return nil
 }
 
+// SetDebug turns verbose logging of this session's I/O on or off.
+func (s *Session) SetDebug(enabled bool) {
+	s.debug.Store(enabled)
+	slog.Info("Session debug logging changed", "id", s.ID, "debug", enabled)
+}
+
+// Debug reports whether verbose logging is enabled for this session.
+func (s *Session) Debug() bool {
+	return s.debug.Load()
+}
+
+// debugLog logs an I/O detail for a session in debug mode. It logs at info
+// level so that it shows up without lowering the level for every session.
+func (s *Session) debugLog(msg string, args ...any) {
+	slog.Info(msg, append([]any{"id", s.ID, "debug", true}, args...)...)
+}
+
+// LastInputAt returns when client input was last written to the PTY.
+func (s *Session) LastInputAt() time.Time {
+	return time.Unix(0, s.lastInputAt.Load())
+}
+
+// LastOutputAt returns when the PTY last produced output.
+func (s *Session) LastOutputAt() time.Time {
+	return time.Unix(0, s.lastOutputAt.Load())
+}
+
+// Resize changes the PTY window size. Returns ErrSessionClosed if the
+// session is closed.
+// Sizes below the session's minimum are raised to it and clients are told
+// with a size-clamped control message.
+// Resizes beyond the session's rate limit are coalesced and applied later.
 func (s *Session) Resize(cols, rows uint16) error {
+	if c, r, clamped := clampSize(cols, rows, s.minSize); clamped {
+		slog.Debug("Resize below minimum size, clamped", "id", s.ID, "cols", cols, "rows", rows, "min_cols", s.minSize.Cols, "min_rows", s.minSize.Rows)
+		cols, rows = c, r
+		s.sendControl(ControlMessage{Type: ControlTypeSizeClamped, Cols: cols, Rows: rows})
+	}
+	if s.resizeLimiter != nil {
+		if s.IsClosed() {
+			return ErrSessionClosed
+		}
+		if !s.resizeLimiter.admit(s.ID, cols, rows, s.applyCoalescedResize) {
+			return nil
+		}
+	}
+	return s.resize(cols, rows)
+}
+
+func (s *Session) resize(cols, rows uint16) error {
+	s.ptyMu.Lock()
+	defer s.ptyMu.Unlock()
+	if s.PTY == nil && s.TmuxSessionName != "" && !s.IsClosed() {
+		// Recovered and not attached yet; the size applies on attach
+		s.Cols, s.Rows = cols, rows
+		return nil
+	}
+	if s.PTY == nil || s.IsClosed() {
+		return ErrSessionClosed
+	}
 	s.Cols = cols
 	s.Rows = rows
-	return s.PTY.Resize(cols, rows)
+	if err := s.PTY.Resize(cols, rows); err != nil {
+		if s.IsClosed() {
+			return ErrSessionClosed
+		}
+		return err
+	}
+	if s.verifyResize {
+		if err := s.PTY.EnsureSize(cols, rows); err != nil {
+			slog.Warn("PTY resize did not take effect", "id", s.ID, "cols", cols, "rows", rows, "error", err)
+		}
+	}
+	s.metrics.resizes.Add(1)
+	if s.recorder != nil {
+		s.recorder.Resize(cols, rows)
+	}
+	return nil
+}
+
+// clearScreen moves the cursor home and clears the screen and scrollback.
+var clearScreen = []byte("\x1b[H\x1b[2J\x1b[3J")
+
+// Refresh forces clients to repaint. tmux sessions ask tmux to redraw its
+// attached clients, which reaches our clients as regular output. Spooled
+// sessions clear the screen and replay the spooled history, and sessions
+// keeping scrollback replay that. Other direct sessions nudge the window size so full-screen programs receive SIGWINCH
+// and redraw themselves.
+func (s *Session) Refresh() error {
+	if s.IsClosed() {
+		return ErrSessionClosed
+	}
+
+	if s.TmuxSessionName != "" {
+		return tmux.RefreshClients(s.TmuxSessionName)
+	}
+
+	if s.spool != nil {
+		history, err := s.spool.ReadTail(s.spoolReplayBytes)
+		if err != nil {
+			return err
+		}
+		s.sendFrame(websocket.BinaryMessage, append(append([]byte(nil), clearScreen...), history...))
+		return nil
+	}
+	if s.scrollback != nil {
+		s.sendFrame(websocket.BinaryMessage, append(append([]byte(nil), clearScreen...), s.scrollback.Bytes()...))
+		return nil
+	}
+
+	s.ptyMu.Lock()
+	defer s.ptyMu.Unlock()
+	if s.PTY == nil {
+		return ErrSessionClosed
+	}
+	if s.Rows > 1 {
+		if err := s.PTY.Resize(s.Cols, s.Rows-1); err != nil {
+			return err
+		}
+	}
+	return s.PTY.Resize(s.Cols, s.Rows)
 }
 
 // Close closes the session. For tmux sessions, it only closes the PTY attachment,
@@ -203,15 +841,23 @@ func (s *Session) Close() {
 		close(s.done)
 
 		s.clientsMu.Lock()
-		for client := range s.clients {
-			client.Close()
-		}
-		s.clients = make(map[*websocket.Conn]string)
+		dropped := closeClients(nil, s.clients, 0, "", false)
+		dropped = closeClients(dropped, s.observers, 0, "", false)
+		s.prom.disconnects.Add(float64(len(dropped)))
+		s.clients = make(map[*websocket.Conn]*client)
+		s.observers = make(map[*websocket.Conn]*client)
 		s.connectedClientId = ""
+		if s.spool != nil {
+			s.spool.Close()
+		}
 		s.clientsMu.Unlock()
+		for _, c := range dropped {
+			c.closeConn(0, "")
+		}
+		s.closeRecorder()
 
-		if s.PTY != nil {
-			s.PTY.Close()
+		if p := s.currentPTY(); p != nil {
+			p.Close()
 		}
 	})
 }
@@ -223,35 +869,54 @@ func (s *Session) CloseWithTmux() {
 		close(s.done)
 
 		s.clientsMu.Lock()
-		for client := range s.clients {
-			client.Close()
-		}
-		s.clients = make(map[*websocket.Conn]string)
+		dropped := closeClients(nil, s.clients, 0, "", false)
+		dropped = closeClients(dropped, s.observers, 0, "", false)
+		s.prom.disconnects.Add(float64(len(dropped)))
+		s.clients = make(map[*websocket.Conn]*client)
+		s.observers = make(map[*websocket.Conn]*client)
 		s.connectedClientId = ""
+		if s.spool != nil {
+			s.spool.Close()
+		}
 		s.clientsMu.Unlock()
+		for _, c := range dropped {
+			c.closeConn(0, "")
+		}
+		s.closeRecorder()
 
-		if s.PTY != nil {
-			s.PTY.CloseWithTmux()
+		if p := s.currentPTY(); p != nil {
+			p.CloseWithTmux()
 		}
 	})
 }
 
 // ReplacePTY replaces the current PTY with a new one (used for tmux reattachment).
-func (s *Session) ReplacePTY(newPTY *pty.PTY) {
-	// Close old PTY (but not tmux session)
-	if s.PTY != nil {
-		s.PTY.Close()
+// Only the read goroutine is swapped: the broadcast loop and clients are
+// untouched, and the new reader starts once the old one has handed off its
+// last output, so delivery stays continuous and in order.
+func (s *Session) ReplacePTY(newPTY *pty.PTY) error {
+	s.ptyMu.Lock()
+	if s.IsClosed() {
+		s.ptyMu.Unlock()
+		newPTY.Close()
+		return ErrSessionClosed
+	}
+	old, prevDone := s.PTY, s.readerDone
+	done := make(chan struct{})
+	s.PTY, s.readerDone = newPTY, done
+	s.ptyMu.Unlock()
+	s.metrics.reattaches.Add(1)
+
+	// Close old PTY (but not tmux session); its reader exits on the read error
+	if old != nil {
+		old.Close()
 	}
-	s.PTY = newPTY
-
-	// Restart the read loop with new PTY
-	// Note: The old readPTY goroutine will exit on the next Read error
-	// We need a fresh done channel for the new PTY
-	s.done = make(chan struct{})
-	s.closeOnce = sync.Once{}
 
-	go s.readPTY()
-	go s.broadcastLoop()
+	go func() {
+		<-prevDone
+		s.readPTY(newPTY, done)
+	}()
+	return nil
 }
 
 func (s *Session) IsClosed() bool {
@@ -262,3 +927,17 @@ func (s *Session) IsClosed() bool {
 		return false
 	}
 }
+
+// typeInitCommands writes each command followed by a newline to a new
+// session, as if typed by the user. They are written right away rather than
+// after the first prompt, since prompts can't be detected reliably; the
+// terminal buffers them until the command reads its input. Reattaching to an
+// existing tmux session doesn't go through here, so nothing is re-run.
+func (s *Session) typeInitCommands(commands []string) {
+	for _, command := range commands {
+		if err := s.Write([]byte(command + "\n")); err != nil {
+			slog.Warn("Failed to write init command", "id", s.ID, "error", err)
+			return
+		}
+	}
+}
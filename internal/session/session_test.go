@@ -0,0 +1,423 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/itsmylife44/terminus-pty/internal/pty"
+)
+
+// wsPair returns the server and client ends of a WebSocket connection.
+func wsPair(t testing.TB) (server, client *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			close(conns)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server, ok := <-conns
+	if !ok {
+		t.FailNow()
+	}
+	t.Cleanup(func() { server.Close() })
+	return server, client
+}
+
+func TestTakeoverRacingConnect(t *testing.T) {
+	p := testPool(t, PoolConfig{})
+	for i := 0; i < 50; i++ {
+		sess, err := p.Create(CreateOptions{})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		conn, _ := wsPair(t)
+
+		var (
+			wg     sync.WaitGroup
+			addErr error
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			addErr = sess.AddClient(conn, "old")
+		}()
+		go func() {
+			defer wg.Done()
+			sess.Takeover("new", CloseCode4001, "takeover", false)
+		}()
+		wg.Wait()
+
+		// Whichever ran first, the old client must not be left attached and
+		// the reservation must hold
+		if addErr != nil && !errors.Is(addErr, ErrSessionReserved) {
+			t.Fatalf("AddClient: %v", addErr)
+		}
+		if n := sess.ClientCount(); n != 0 {
+			t.Fatalf("iteration %d: %d clients after takeover, want 0", i, n)
+		}
+		if id := sess.ConnectedClientID(); id != "" {
+			t.Fatalf("iteration %d: connected client %q after takeover, want none", i, id)
+		}
+		if sess.CanJoin("old") || !sess.CanJoin("new") {
+			t.Fatalf("iteration %d: reservation not held for the new client", i)
+		}
+
+		next, _ := wsPair(t)
+		if err := sess.AddClient(next, "new"); err != nil {
+			t.Fatalf("iteration %d: reserved client rejected: %v", i, err)
+		}
+		if id := sess.ConnectedClientID(); id != "new" {
+			t.Fatalf("iteration %d: connected client %q, want %q", i, id, "new")
+		}
+		p.Remove(sess.ID)
+	}
+}
+
+func TestTakeoverClosesOutsideLock(t *testing.T) {
+	p := testPool(t, PoolConfig{DefaultCommand: "/bin/cat"})
+	sess, err := p.Create(CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	conn, _ := wsPair(t)
+	if err := sess.AddClient(conn, "old"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+	// A frame the unread client end can't take, so the close frame has to
+	// wait for the writer until closeFrameTimeout
+	sess.clientsMu.RLock()
+	sess.clients[conn].queue(outFrame{messageType: websocket.BinaryMessage, data: make([]byte, 64<<20)})
+	sess.clientsMu.RUnlock()
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		sess.Takeover("new", CloseCode4001, "takeover", false)
+		close(done)
+	}()
+	for sess.ClientCount() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("session was locked until the close frame was sent")
+	default:
+	}
+	<-done
+}
+
+func TestRefreshReplaysScrollback(t *testing.T) {
+	p := testPool(t, PoolConfig{ScrollbackBytes: 4096})
+	sess, err := p.Create(CreateOptions{Command: "/bin/sh", Args: []string{"-c", "echo painted; exec cat"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(string(sess.scrollback.Bytes()), "painted") {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for output")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	server, client := wsPair(t)
+	if err := sess.AddClient(server, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+	if err := sess.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	for {
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for the repaint: %v", err)
+		}
+		if kind == websocket.BinaryMessage && strings.HasPrefix(string(data), string(clearScreen)) {
+			if !strings.Contains(string(data), "painted") {
+				t.Fatalf("repaint %q lacks the scrollback", data)
+			}
+			return
+		}
+	}
+}
+
+func TestWriteRacingClose(t *testing.T) {
+	p := testPool(t, PoolConfig{DefaultCommand: "/bin/cat"})
+	for i := 0; i < 20; i++ {
+		sess, err := p.Create(CreateOptions{})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		var wg sync.WaitGroup
+		errs := make(chan error, 4*100)
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					if err := sess.Write([]byte("x")); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		sess.Close()
+		wg.Wait()
+		close(errs)
+
+		// Writes either went through or failed because the session closed
+		for err := range errs {
+			if !errors.Is(err, ErrSessionClosed) {
+				t.Fatalf("iteration %d: Write during Close: %v, want ErrSessionClosed", i, err)
+			}
+		}
+		if err := sess.Write([]byte("x")); !errors.Is(err, ErrSessionClosed) {
+			t.Fatalf("iteration %d: Write after Close: %v, want ErrSessionClosed", i, err)
+		}
+		if err := sess.Resize(100, 30); !errors.Is(err, ErrSessionClosed) {
+			t.Fatalf("iteration %d: Resize after Close: %v, want ErrSessionClosed", i, err)
+		}
+		p.Remove(sess.ID)
+	}
+}
+
+func TestMaxOutputBytesTerminates(t *testing.T) {
+	p := testPool(t, PoolConfig{MaxOutputBytes: 64 << 10})
+	sess, err := p.Create(CreateOptions{Command: "/bin/sh", Args: []string{"-c", "sleep 0.2; yes"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	server, client := wsPair(t)
+	if err := sess.AddClient(server, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+
+	var received int
+	for {
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, data, err := client.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != CloseCode4002 {
+				t.Fatalf("connection ended with %v, want close code %d", err, CloseCode4002)
+			}
+			break
+		}
+		if kind == websocket.BinaryMessage {
+			received += len(data)
+		}
+	}
+	if received > 64<<10 {
+		t.Errorf("client received %d bytes, more than the limit", received)
+	}
+	if !sess.IsClosed() {
+		t.Error("session still open after exceeding the output limit")
+	}
+	// The close frame is sent before the command is killed
+	deadline := time.Now().Add(5 * time.Second)
+	for sess.PTY.Cmd.Process.Signal(syscall.Signal(0)) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("command still running after exceeding the output limit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplacePTYMidOutput(t *testing.T) {
+	oldOut, oldIn, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newOut, newIn, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldIn.Close()
+	defer newIn.Close()
+	sess := newSession("pty_replace", &pty.PTY{File: oldOut}, 80, 24)
+	sess.start()
+	defer sess.Close()
+	server, client := wsPair(t)
+	if err := sess.AddClient(server, "c"); err != nil {
+		t.Fatalf("AddClient: %v", err)
+	}
+
+	var oldStream, newStream strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&oldStream, "a%04d\n", i)
+	}
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&newStream, "b%04d\n", i)
+	}
+	// Output keeps coming from the old PTY until it is replaced
+	go func() {
+		for _, line := range strings.SplitAfter(oldStream.String(), "\n") {
+			if _, err := oldIn.WriteString(line); err != nil {
+				return
+			}
+			time.Sleep(50 * time.Microsecond)
+		}
+	}()
+
+	var got strings.Builder
+	read := func(until string) {
+		t.Helper()
+		for !strings.Contains(got.String(), until) {
+			client.SetReadDeadline(time.Now().Add(5 * time.Second))
+			kind, data, err := client.ReadMessage()
+			if err != nil {
+				t.Fatalf("read: %v (waiting for %q)", err, until)
+			}
+			if kind == websocket.BinaryMessage {
+				got.Write(data)
+			}
+		}
+	}
+	read("a0100\n")
+	if err := sess.ReplacePTY(&pty.PTY{File: newOut}); err != nil {
+		t.Fatalf("ReplacePTY: %v", err)
+	}
+	if _, err := newIn.WriteString(newStream.String()); err != nil {
+		t.Fatal(err)
+	}
+	read("b0999\n")
+
+	// What the old PTY delivered is an unbroken start of its output, and
+	// all of the new PTY's output follows it
+	out := got.String()
+	i := strings.Index(out, "b0000\n")
+	if !strings.HasPrefix(oldStream.String(), out[:i]) {
+		t.Errorf("old output lost or reordered: %q", out[:i])
+	}
+	if out[i:] != newStream.String() {
+		t.Errorf("new output lost or reordered: %q", out[i:])
+	}
+	if sess.IsClosed() {
+		t.Error("session closed by replacing its PTY")
+	}
+}
+
+// logBuffer collects log output from concurrent goroutines.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs sends the default logger's JSON output to the returned buffer
+// for the rest of the test.
+func captureLogs(t *testing.T) *logBuffer {
+	t.Helper()
+	logs := &logBuffer{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return logs
+}
+
+func TestDebugLogsOnlyFlaggedSession(t *testing.T) {
+	logs := captureLogs(t)
+	p := testPool(t, PoolConfig{})
+	var sessions [2]*Session
+	for i := range sessions {
+		sess, err := p.Create(CreateOptions{Command: "/bin/cat"})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		server, _ := wsPair(t)
+		if err := sess.AddClient(server, "c"); err != nil {
+			t.Fatalf("AddClient: %v", err)
+		}
+		sessions[i] = sess
+	}
+	flagged, quiet := sessions[0], sessions[1]
+	flagged.SetDebug(true)
+
+	// debugEntries returns the messages of debug log entries by session ID.
+	debugEntries := func() map[string][]string {
+		entries := make(map[string][]string)
+		for line := range strings.Lines(logs.String()) {
+			var entry struct {
+				Msg   string `json:"msg"`
+				ID    string `json:"id"`
+				Debug bool   `json:"debug"`
+			}
+			if json.Unmarshal([]byte(line), &entry) == nil && entry.Debug {
+				entries[entry.ID] = append(entries[entry.ID], entry.Msg)
+			}
+		}
+		return entries
+	}
+	echo := func(sess *Session, input string) {
+		t.Helper()
+		before := sess.Metrics().BytesOut
+		if err := sess.Write([]byte(input)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for sess.Metrics().BytesOut < before+2*int64(len(input)+1) {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the echo")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		// Broadcasting trails the read a little
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	echo(flagged, "loud\n")
+	echo(quiet, "hush\n")
+	entries := debugEntries()
+	for _, msg := range []string{"PTY write", "PTY read", "Broadcast"} {
+		if !slices.Contains(entries[flagged.ID], msg) {
+			t.Errorf("no %q debug log for the flagged session, got %q", msg, entries[flagged.ID])
+		}
+	}
+	if len(entries[quiet.ID]) > 0 {
+		t.Errorf("debug logs for the other session: %q", entries[quiet.ID])
+	}
+
+	// Turning it off stops them
+	flagged.SetDebug(false)
+	n := len(entries[flagged.ID])
+	echo(flagged, "again\n")
+	if got := len(debugEntries()[flagged.ID]); got != n {
+		t.Errorf("%d more debug logs after turning debug off", got-n)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package session
+
+import "strings"
+
+// ShellDefaultArgs returns args unchanged, or login/interactive flags when no
+// args were given and cmd looks like a shell.
+func ShellDefaultArgs(cmd string, args []string) []string {
+	if len(args) == 0 && (strings.HasSuffix(cmd, "sh") || strings.Contains(cmd, "/sh")) {
+		return []string{"-l", "-i"}
+	}
+	return args
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package session
+
+// ShellDefaultArgs returns args unchanged. Windows shells are interactive
+// without flags, and Unix shell flags like -l would break e.g. PowerShell,
+// whose name also ends in "sh".
+func ShellDefaultArgs(cmd string, args []string) []string {
+	return args
+}
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+
+	"github.com/itsmylife44/terminus-pty/internal/pty"
+)
+
+// ErrUnknownSignal is returned for signal names not accepted over the API.
+var ErrUnknownSignal = errors.New("unknown signal")
+
+// LookupSignal returns the signal for an API signal name such as "SIGINT".
+func LookupSignal(name string) (syscall.Signal, error) {
+	sig, ok := signals[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownSignal, name)
+	}
+	return sig, nil
+}
+
+// Signal delivers a signal to the session's command. Direct sessions signal
+// the spawned process; tmux sessions are handled by signalTmux.
+func (s *Session) Signal(name string) error {
+	sig, err := LookupSignal(name)
+	if err != nil {
+		return err
+	}
+	if s.IsClosed() {
+		return ErrSessionClosed
+	}
+
+	if s.TmuxSessionName != "" {
+		return signalTmux(s.TmuxSessionName, sig)
+	}
+
+	if err := s.currentPTY().Signal(sig); err != nil {
+		if errors.Is(err, os.ErrProcessDone) || errors.Is(err, pty.ErrPTYClosed) {
+			return ErrSessionClosed
+		}
+		return err
+	}
+	return nil
+}
+
+// SignalInfo describes a signal accepted over the API.
+type SignalInfo struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+}
+
+// Signals returns the accepted signals ordered by number.
+func Signals() []SignalInfo {
+	list := make([]SignalInfo, 0, len(signals))
+	for name, sig := range signals {
+		list = append(list, SignalInfo{Name: name, Number: int(sig)})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Number < list[j].Number
+	})
+	return list
+}
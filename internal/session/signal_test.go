@@ -0,0 +1,42 @@
+package session
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestSignals(t *testing.T) {
+	list := Signals()
+	byName := make(map[string]int, len(list))
+	for i, info := range list {
+		if i > 0 && info.Number < list[i-1].Number {
+			t.Errorf("%s listed after %s, want ordered by number", info.Name, list[i-1].Name)
+		}
+		byName[info.Name] = info.Number
+		// Every listed name is accepted
+		if sig, err := LookupSignal(info.Name); err != nil || int(sig) != info.Number {
+			t.Errorf("LookupSignal(%s) = %d, %v; want %d", info.Name, sig, err, info.Number)
+		}
+	}
+
+	common := map[string]syscall.Signal{"SIGINT": syscall.SIGINT, "SIGKILL": syscall.SIGKILL}
+	if runtime.GOOS != "windows" {
+		common["SIGTERM"] = syscall.SIGTERM
+		common["SIGHUP"] = syscall.SIGHUP
+	}
+	for name, sig := range common {
+		if n, ok := byName[name]; !ok || n != int(sig) {
+			t.Errorf("%s listed as %d (listed %v), want %d", name, n, ok, sig)
+		}
+	}
+}
+
+func TestLookupSignalUnknown(t *testing.T) {
+	for _, name := range []string{"SIGNOPE", "sigint", "9", ""} {
+		if _, err := LookupSignal(name); !errors.Is(err, ErrUnknownSignal) {
+			t.Errorf("LookupSignal(%q): %v, want ErrUnknownSignal", name, err)
+		}
+	}
+}
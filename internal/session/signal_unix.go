@@ -0,0 +1,47 @@
+//go:build !windows
+
+package session
+
+import (
+	"syscall"
+
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
+)
+
+// signals maps the signal names accepted over the API to their values.
+var signals = map[string]syscall.Signal{
+	"SIGHUP":   syscall.SIGHUP,
+	"SIGINT":   syscall.SIGINT,
+	"SIGQUIT":  syscall.SIGQUIT,
+	"SIGKILL":  syscall.SIGKILL,
+	"SIGUSR1":  syscall.SIGUSR1,
+	"SIGUSR2":  syscall.SIGUSR2,
+	"SIGTERM":  syscall.SIGTERM,
+	"SIGCONT":  syscall.SIGCONT,
+	"SIGSTOP":  syscall.SIGSTOP,
+	"SIGTSTP":  syscall.SIGTSTP,
+	"SIGWINCH": syscall.SIGWINCH,
+}
+
+// signalKeys are the keys that make a tmux pane's terminal deliver a signal
+// to its foreground job, the way a user pressing them would.
+var signalKeys = map[syscall.Signal]string{
+	syscall.SIGINT:  "C-c",
+	syscall.SIGQUIT: "C-\\",
+	syscall.SIGTSTP: "C-z",
+}
+
+// signalTmux delivers a signal to a tmux session's command. Our process is
+// only the attach client, so SIGINT, SIGQUIT and SIGTSTP are sent as their
+// keys to reach the foreground job, and other signals go to the pane's
+// process.
+func signalTmux(name string, sig syscall.Signal) error {
+	if key, ok := signalKeys[sig]; ok {
+		return tmux.SendKeys(name, key)
+	}
+	pid, err := tmux.PanePID(name)
+	if err != nil {
+		return err
+	}
+	return syscall.Kill(pid, sig)
+}
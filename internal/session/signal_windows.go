@@ -0,0 +1,20 @@
+//go:build windows
+
+package session
+
+import (
+	"errors"
+	"syscall"
+)
+
+// signals maps the signal names accepted over the API to their values.
+// Windows has no signals; the PTY emulates these two, see pty.PTY.Signal.
+var signals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// signalTmux is never reached: tmux mode is rejected on Windows.
+func signalTmux(name string, sig syscall.Signal) error {
+	return errors.ErrUnsupported
+}
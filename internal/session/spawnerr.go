@@ -0,0 +1,24 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"syscall"
+)
+
+// ErrResourcesExhausted wraps spawn failures caused by the host running out
+// of file descriptors or processes. Unlike a bad command or workdir, these
+// are usually transient.
+var ErrResourcesExhausted = errors.New("host is out of resources")
+
+// classifySpawnError wraps err in ErrResourcesExhausted if it was caused by
+// fd or process exhaustion, logging a warning so operators know to raise
+// ulimits. Other errors are returned unchanged.
+func classifySpawnError(id string, err error) error {
+	if !errors.Is(err, syscall.EMFILE) && !errors.Is(err, syscall.ENFILE) && !errors.Is(err, syscall.EAGAIN) {
+		return err
+	}
+	slog.Warn("Spawn failed, host out of file descriptors or processes; consider raising ulimits", "id", id, "error", err)
+	return fmt.Errorf("%w: %w", ErrResourcesExhausted, err)
+}
@@ -0,0 +1,29 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifySpawnError(t *testing.T) {
+	for _, tt := range []struct {
+		err       error
+		exhausted bool
+	}{
+		{&os.PathError{Op: "open", Path: "/dev/ptmx", Err: syscall.EMFILE}, true},
+		{fmt.Errorf("fork: %w", syscall.EAGAIN), true},
+		{syscall.ENFILE, true},
+		{&os.PathError{Op: "fork/exec", Path: "/no/such", Err: syscall.ENOENT}, false},
+	} {
+		err := classifySpawnError("test", tt.err)
+		if got := errors.Is(err, ErrResourcesExhausted); got != tt.exhausted {
+			t.Errorf("%v: exhausted = %v, want %v", tt.err, got, tt.exhausted)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%v: cause lost in %v", tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package session
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// spool persists PTY output to disk so direct (non-tmux) sessions can replay
+// history beyond what fits in memory. Output is appended to <id>.spool; once
+// it exceeds maxBytes it is rotated to <id>.spool.1, replacing any previous
+// rotation, which bounds disk usage to roughly twice maxBytes.
+type spool struct {
+	path     string
+	maxBytes int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newSpool(dir, id string, maxBytes int64) (*spool, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "terminus-pty")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+
+	sp := &spool{
+		path:     filepath.Join(dir, id+".spool"),
+		maxBytes: maxBytes,
+	}
+	if err := sp.open(); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+func (sp *spool) open() error {
+	f, err := os.OpenFile(sp.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open spool file: %w", err)
+	}
+	sp.file = f
+	sp.size = 0
+	return nil
+}
+
+// Write appends output to the spool, rotating when the size limit is reached.
+func (sp *spool) Write(data []byte) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.file == nil {
+		return os.ErrClosed
+	}
+
+	if sp.maxBytes > 0 && sp.size+int64(len(data)) > sp.maxBytes && sp.size > 0 {
+		sp.file.Close()
+		if err := os.Rename(sp.path, sp.path+".1"); err != nil {
+			sp.file = nil
+			return fmt.Errorf("failed to rotate spool file: %w", err)
+		}
+		if err := sp.open(); err != nil {
+			sp.file = nil
+			return err
+		}
+	}
+
+	n, err := sp.file.Write(data)
+	sp.size += int64(n)
+	return err
+}
+
+// ReadTail returns the last n bytes of spooled output across the rotated and
+// current files. If n <= 0, all retained output is returned.
+func (sp *spool) ReadTail(n int64) ([]byte, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	var out []byte
+	for _, path := range []string{sp.path + ".1", sp.path} {
+		data, err := readFileTail(path, n)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		out = append(out, data...)
+	}
+
+	if n > 0 && int64(len(out)) > n {
+		out = out[int64(len(out))-n:]
+	}
+	return out, nil
+}
+
+// Size returns how much output is retained across the rotated and current
+// files.
+func (sp *spool) Size() int64 {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	size := sp.size
+	if info, err := os.Stat(sp.path + ".1"); err == nil {
+		size += info.Size()
+	}
+	return size
+}
+
+func readFileTail(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if n > 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() > n {
+			if _, err := f.Seek(info.Size()-n, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return io.ReadAll(f)
+}
+
+// Close closes and deletes the spool files.
+func (sp *spool) Close() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.file != nil {
+		sp.file.Close()
+		sp.file = nil
+	}
+	os.Remove(sp.path)
+	os.Remove(sp.path + ".1")
+}
@@ -0,0 +1,89 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSpoolReplaysFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	p := testPool(t, PoolConfig{SpoolDir: dir, SpoolMaxBytes: 32 << 10})
+	// The pause lets the broadcast backlog drain, so a loaded machine
+	// doesn't drop the marker
+	sess, err := p.Create(CreateOptions{
+		Command: "/bin/sh",
+		Args:    []string{"-c", "seq 1 20000; sleep 0.2; echo spooled-end; exec cat"},
+		Spool:   true,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// All output arrives while nobody is connected
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		data, _ := os.ReadFile(filepath.Join(dir, sess.ID+".spool"))
+		if strings.Contains(string(data), "spooled-end") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the output to be spooled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(filepath.Join(dir, sess.ID+".spool.1")); err != nil {
+		t.Fatalf("spool was not rotated: %v", err)
+	}
+
+	replay := func() string {
+		t.Helper()
+		server, client := wsPair(t)
+		if err := sess.AddClient(server, "c"); err != nil {
+			t.Fatalf("AddClient: %v", err)
+		}
+		defer sess.RemoveClient(server)
+		var out strings.Builder
+		for !strings.Contains(out.String(), "spooled-end") {
+			client.SetReadDeadline(time.Now().Add(5 * time.Second))
+			kind, data, err := client.ReadMessage()
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if kind == websocket.BinaryMessage {
+				out.Write(data)
+			}
+		}
+		return out.String()
+	}
+
+	// The replay is an unbroken run of the last lines, more than the
+	// current spool file alone holds
+	first := replay()
+	lines := strings.Split(strings.TrimSuffix(first, "spooled-end\r\n"), "\r\n")
+	lines = lines[1 : len(lines)-1] // the first may be cut off mid-line
+	if len(first) <= 32<<10 {
+		t.Errorf("replayed %d bytes, want the rotated file too", len(first))
+	}
+	want := 20000 - len(lines) + 1
+	for _, line := range lines {
+		if line != strconv.Itoa(want) {
+			t.Fatalf("replay has %q where %d belongs", line, want)
+		}
+		want++
+	}
+
+	// Every reconnect replays it again
+	if again := replay(); again != first {
+		t.Error("second reconnect replayed different output")
+	}
+
+	sess.Close()
+	if matches, _ := filepath.Glob(filepath.Join(dir, sess.ID+".spool*")); len(matches) > 0 {
+		t.Errorf("spool files left after close: %q", matches)
+	}
+}
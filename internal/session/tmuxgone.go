@@ -0,0 +1,37 @@
+package session
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
+)
+
+// ControlTypeTmuxGone is sent to clients when the tmux session behind a
+// session ended, just before they are disconnected with CloseCode4006.
+const ControlTypeTmuxGone = "tmux_gone"
+
+// tmuxGone reports whether the session is backed by a tmux session that no
+// longer exists. tmux ends a session both when its command exits and when
+// it is killed, e.g. with tmux kill-session, so the two can't be told apart.
+func (s *Session) tmuxGone() bool {
+	return s.TmuxSessionName != "" && !tmux.SessionExists(s.TmuxSessionName)
+}
+
+// finishTmuxGone handles a tmux session that ended while attached: it
+// records the session as terminated, so the pool can report it after the
+// session is removed, tells clients and disconnects them with
+// CloseCode4006. The caller closes the session.
+func (s *Session) finishTmuxGone() {
+	slog.Warn("tmux session terminated", "id", s.ID, "tmux_session", s.TmuxSessionName)
+
+	if !s.IsClosed() {
+		status := &ExitStatus{Code: -1, TmuxGone: true, ExitedAt: time.Now(), Recording: s.RecordingPath(), RecordingSegments: s.RecordingSegments()}
+		s.clientsMu.Lock()
+		s.exitStatus = status
+		s.clientsMu.Unlock()
+	}
+
+	s.sendControlWait(ControlMessage{Type: ControlTypeTmuxGone}, drainTimeout)
+	s.DisconnectAllClients(CloseCode4006, "tmux session terminated")
+}
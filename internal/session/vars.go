@@ -0,0 +1,84 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidVars is returned when a create request's variables don't fit the
+// variables its profile declares.
+var ErrInvalidVars = errors.New("invalid vars")
+
+// varNamePattern is what variable names, and so placeholders, may look like.
+var varNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// placeholderPattern matches a {name} placeholder in a profile's args.
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// CompileVar checks a profile variable's name and compiles the pattern its
+// values must match in full.
+func CompileVar(name, pattern string) (*regexp.Regexp, error) {
+	if !varNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("variable name %q must be letters, digits and '_', not starting with a digit", name)
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("variable %s needs a pattern for its values", name)
+	}
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("variable %s: %w", name, err)
+	}
+	return re, nil
+}
+
+// expandArgs substitutes vars into the {name} placeholders of args. Only the
+// variables declared in allowed may be given, and each value must match its
+// pattern. Values are inserted as-is into single arguments, never through a
+// shell, and aren't expanded again, so they can't add arguments or refer to
+// other variables. Values starting with '-' are rejected whatever the
+// pattern, so a host name can't turn into an option such as
+// -oProxyCommand=..., and so are values with control characters.
+func expandArgs(args []string, vars map[string]string, allowed map[string]*regexp.Regexp) ([]string, error) {
+	for name, value := range vars {
+		re, ok := allowed[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not a variable of this profile", ErrInvalidVars, name)
+		}
+		if strings.HasPrefix(value, "-") || strings.IndexFunc(value, unicode.IsControl) >= 0 || !re.MatchString(value) {
+			return nil, fmt.Errorf("%w: value of %s is not allowed", ErrInvalidVars, name)
+		}
+	}
+
+	expanded := make([]string, len(args))
+	var missing error
+	for i, arg := range args {
+		expanded[i] = placeholderPattern.ReplaceAllStringFunc(arg, func(placeholder string) string {
+			name := placeholder[1 : len(placeholder)-1]
+			value, ok := vars[name]
+			if !ok && missing == nil {
+				missing = fmt.Errorf("%w: %s is required", ErrInvalidVars, name)
+			}
+			return value
+		})
+	}
+	if missing != nil {
+		return nil, missing
+	}
+	return expanded, nil
+}
+
+// CheckPlaceholders checks that every {name} placeholder in args is one of
+// vars, so a profile can't require a variable no client is allowed to give.
+func CheckPlaceholders(args []string, vars map[string]*regexp.Regexp) error {
+	for _, arg := range args {
+		for _, m := range placeholderPattern.FindAllStringSubmatch(arg, -1) {
+			if _, ok := vars[m[1]]; !ok {
+				return fmt.Errorf("placeholder %s in args is not a declared variable", m[0])
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package session
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+var testVars = map[string]*regexp.Regexp{
+	"user": mustCompileVar("user", `[a-z_][a-z0-9_-]*`),
+	"host": mustCompileVar("host", `[A-Za-z0-9.-]+`),
+}
+
+func mustCompileVar(name, pattern string) *regexp.Regexp {
+	re, err := CompileVar(name, pattern)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+func TestExpandArgs(t *testing.T) {
+	args := []string{"-p", "22", "--", "{user}@{host}", "{}", "{host}"}
+	got, err := expandArgs(args, map[string]string{"user": "deploy", "host": "web1.example.com"}, testVars)
+	if err != nil {
+		t.Fatalf("expandArgs: %v", err)
+	}
+	want := []string{"-p", "22", "--", "deploy@web1.example.com", "{}", "web1.example.com"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expandArgs = %q, want %q", got, want)
+	}
+	if args[3] != "{user}@{host}" {
+		t.Errorf("expandArgs modified its input: %q", args)
+	}
+}
+
+func TestExpandArgsRejectsInjection(t *testing.T) {
+	args := []string{"{user}@{host}"}
+	tests := []struct {
+		name string
+		vars map[string]string
+	}{
+		{"shell metacharacters", map[string]string{"user": "a", "host": "h; rm -rf /"}},
+		{"command substitution", map[string]string{"user": "a", "host": "$(id)"}},
+		{"option injection", map[string]string{"user": "a", "host": "-oProxyCommand=sh"}},
+		{"option despite pattern", map[string]string{"user": "-x", "host": "h"}},
+		{"newline", map[string]string{"user": "a", "host": "h\nx"}},
+		{"NUL byte", map[string]string{"user": "a", "host": "h\x00x"}},
+		{"space splitting", map[string]string{"user": "a", "host": "h x"}},
+		{"partial match", map[string]string{"user": "a", "host": "h/../x"}},
+		{"nested placeholder", map[string]string{"user": "{host}", "host": "h"}},
+		{"undeclared variable", map[string]string{"user": "a", "host": "h", "cmd": "sh"}},
+		{"missing variable", map[string]string{"user": "a"}},
+		{"empty value", map[string]string{"user": "a", "host": ""}},
+	}
+	for _, tt := range tests {
+		got, err := expandArgs(args, tt.vars, testVars)
+		if !errors.Is(err, ErrInvalidVars) {
+			t.Errorf("%s: expandArgs(%q) = %q, %v; want ErrInvalidVars", tt.name, tt.vars, got, err)
+		}
+	}
+}
+
+func TestCompileVarRejectsBadNames(t *testing.T) {
+	for _, name := range []string{"", "1host", "ho-st", "{host}", "host name"} {
+		if _, err := CompileVar(name, `.*`); err == nil {
+			t.Errorf("CompileVar(%q) succeeded, want error", name)
+		}
+	}
+	if _, err := CompileVar("host", ""); err == nil {
+		t.Error("CompileVar without a pattern succeeded, want error")
+	}
+	if err := CheckPlaceholders([]string{"{user}@{other}"}, testVars); err == nil {
+		t.Error("CheckPlaceholders accepted an undeclared placeholder")
+	}
+}
+
+func TestCreateWithVars(t *testing.T) {
+	p := testPool(t, PoolConfig{Profiles: map[string]Profile{
+		"greet": {Command: "/bin/echo", Args: []string{"hello {user}"}, Vars: testVars},
+	}})
+	sess, err := p.Create(CreateOptions{Profile: "greet", Vars: map[string]string{"user": "deploy"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if want := []string{"hello deploy"}; !slices.Equal(sess.Args, want) {
+		t.Errorf("args = %q, want %q", sess.Args, want)
+	}
+
+	for _, opts := range []CreateOptions{
+		{Profile: "greet", Vars: map[string]string{"user": "x; reboot"}},
+		{Profile: "greet"},
+		// vars only fill in the profile's own command and args
+		{Profile: "greet", Command: "/bin/sh", Vars: map[string]string{"user": "deploy"}},
+		{Profile: "greet", Args: []string{"{user}"}, Vars: map[string]string{"user": "deploy"}},
+		{Vars: map[string]string{"user": "deploy"}},
+	} {
+		if _, err := p.Create(opts); !errors.Is(err, ErrInvalidVars) {
+			t.Errorf("Create(%+v) = %v, want ErrInvalidVars", opts, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidWorkdir is returned when a requested workdir doesn't exist,
+// isn't a directory, or lies outside PoolConfig.WorkdirRoot.
+var ErrInvalidWorkdir = errors.New("invalid workdir")
+
+// ResolveWorkdir checks a client-requested workdir before spawning in it, so
+// a bad path fails clearly instead of with a confusing spawn error. With
+// PoolConfig.WorkdirRoot, relative paths are taken relative to the root and
+// the directory, symlinks resolved, must lie within it; the resolved path is
+// returned. An empty workdir is returned as is and falls back to the
+// defaults.
+func (p *Pool) ResolveWorkdir(wd string) (string, error) {
+	if wd == "" {
+		return "", nil
+	}
+	root := p.config.WorkdirRoot
+	if root == "" {
+		return wd, checkWorkdir(wd)
+	}
+
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve workdir root: %w", err)
+	}
+	if !filepath.IsAbs(wd) {
+		wd = filepath.Join(root, wd)
+	}
+	if err := checkWorkdir(wd); err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(wd)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s is not accessible", ErrInvalidWorkdir, wd)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s is outside the workdir root", ErrInvalidWorkdir, wd)
+	}
+	return resolved, nil
+}
+
+// checkWorkdir checks that wd is an existing, accessible directory.
+func checkWorkdir(wd string) error {
+	info, err := os.Stat(wd)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s does not exist", ErrInvalidWorkdir, wd)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s is not accessible", ErrInvalidWorkdir, wd)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s is not a directory", ErrInvalidWorkdir, wd)
+	}
+	return nil
+}
@@ -1,10 +1,21 @@
 package tmux
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/creack/pty"
 )
@@ -12,30 +23,177 @@ import (
 // ErrTmuxNotInstalled is returned when tmux is not available on the system.
 var ErrTmuxNotInstalled = fmt.Errorf("tmux is not installed or not in PATH")
 
-// CheckInstalled verifies tmux is available in PATH.
+// ErrUnsupported is returned by CheckInstalled on platforms tmux doesn't run
+// on.
+var ErrUnsupported = errors.New("tmux is not supported on Windows")
+
+// binary is the tmux executable used for all tmux invocations.
+var binary = "tmux"
+
+// SetBinary sets the tmux executable, either a name resolved via PATH or an
+// explicit path. An empty value restores the default "tmux".
+func SetBinary(path string) {
+	if path == "" {
+		path = "tmux"
+	}
+	binary = path
+}
+
+// Binary returns the configured tmux executable.
+func Binary() string {
+	return binary
+}
+
+// tmuxCommand builds an exec.Cmd for the configured tmux binary.
+func tmuxCommand(args ...string) *exec.Cmd {
+	return exec.Command(binary, args...)
+}
+
+// ErrCommandTimeout is returned when a tmux command runs longer than the
+// configured timeout and is killed.
+var ErrCommandTimeout = errors.New("tmux command timed out")
+
+// commandTimeout bounds how long a short-lived tmux command may run, so a
+// hung tmux server can't block the caller forever (0 = no limit).
+var commandTimeout = 10 * time.Second
+
+// SetCommandTimeout sets the timeout for short-lived tmux commands. It does
+// not apply to attach-session, which runs for the life of a session.
+func SetCommandTimeout(d time.Duration) {
+	commandTimeout = d
+}
+
+// runCommand runs a short-lived tmux command, subject to the command timeout.
+func runCommand(cmd *exec.Cmd) error {
+	_, err := commandOutput(cmd)
+	return err
+}
+
+// commandOutput runs a short-lived tmux command and returns its stdout,
+// killing it if it exceeds the command timeout.
+func commandOutput(cmd *exec.Cmd) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	// Don't wait on pipes held open by anything tmux leaves behind once killed
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var timedOut atomic.Bool
+	if commandTimeout > 0 {
+		timer := time.AfterFunc(commandTimeout, func() {
+			timedOut.Store(true)
+			cmd.Process.Kill()
+		})
+		defer timer.Stop()
+	}
+
+	err := cmd.Wait()
+	if timedOut.Load() {
+		return nil, fmt.Errorf("%w after %s: %s", ErrCommandTimeout, commandTimeout, strings.Join(cmd.Args[1:], " "))
+	}
+	return stdout.Bytes(), err
+}
+
+// CheckInstalled verifies the configured tmux binary is available.
 func CheckInstalled() error {
-	_, err := exec.LookPath("tmux")
+	if runtime.GOOS == "windows" {
+		return ErrUnsupported
+	}
+	_, err := exec.LookPath(binary)
 	if err != nil {
 		return ErrTmuxNotInstalled
 	}
 	return nil
 }
 
+// MaxSessionNameLength is the longest session name accepted. tmux itself has
+// no hard limit, but very long names break status lines and target parsing.
+const MaxSessionNameLength = 64
+
+// ErrInvalidSessionName is returned for session names tmux can't use as-is.
+var ErrInvalidSessionName = errors.New("invalid tmux session name")
+
+// ValidateSessionName checks that name can be used verbatim as a tmux session
+// name. tmux silently rewrites '.' and ':' (they are target separators), so a
+// name containing them would not match the session that actually gets created.
+func ValidateSessionName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: empty name", ErrInvalidSessionName)
+	}
+	if len(name) > MaxSessionNameLength {
+		return fmt.Errorf("%w: %d characters exceeds maximum of %d", ErrInvalidSessionName, len(name), MaxSessionNameLength)
+	}
+	for _, r := range name {
+		switch {
+		case r == '.' || r == ':':
+			return fmt.Errorf("%w: %q may not contain %q", ErrInvalidSessionName, name, r)
+		case r < 0x20 || r == 0x7f || unicode.IsSpace(r):
+			return fmt.Errorf("%w: %q contains whitespace or control characters", ErrInvalidSessionName, name)
+		}
+	}
+	return nil
+}
+
+// NormalizeSessionName turns an arbitrary label into a valid session name by
+// replacing disallowed characters with '_' and truncating to the maximum
+// length. Returns an error if nothing usable remains.
+func NormalizeSessionName(name string) (string, error) {
+	var b strings.Builder
+	for _, r := range name {
+		if r == '.' || r == ':' || r < 0x20 || r == 0x7f || unicode.IsSpace(r) {
+			r = '_'
+		}
+		if b.Len()+utf8.RuneLen(r) > MaxSessionNameLength {
+			break
+		}
+		b.WriteRune(r)
+	}
+
+	normalized := b.String()
+	if strings.Trim(normalized, "_") == "" {
+		return "", fmt.Errorf("%w: %q has no usable characters", ErrInvalidSessionName, name)
+	}
+	return normalized, nil
+}
+
 // SessionExists checks if a tmux session with the given name exists.
 func SessionExists(sessionName string) bool {
-	cmd := exec.Command("tmux", "has-session", "-t", sessionName)
-	return cmd.Run() == nil
+	cmd := tmuxCommand("has-session", "-t", sessionName)
+	return runCommand(cmd) == nil
+}
+
+// ErrSessionExists is returned by SpawnSession when the tmux session name is
+// already taken.
+var ErrSessionExists = errors.New("tmux session already exists")
+
+// SpawnOptions holds optional tmux settings applied when creating a session.
+type SpawnOptions struct {
+	HistoryLimit    int      // Scrollback lines for the session's pane (0 = tmux default)
+	StatusOff       bool     // Hide the tmux status bar, leaving the row for content
+	Env             []string // Extra KEY=value environment entries for the session
+	DefaultTerminal string   // TERM inside the session's panes ("" = tmux default-terminal)
+	ClientEnv       []string // Environment of the tmux client attached to the session, e.g. TERM
 }
 
 // SpawnSession creates a new tmux session with the given name and command,
 // returning a PTY file descriptor attached to it.
 // The session runs detached, and we attach to it via a control mode connection.
-func SpawnSession(sessionName, command string, args []string, cols, rows uint16, workdir string) (*os.File, *exec.Cmd, error) {
-	// Build the full command to run inside tmux
-	fullCmd := command
-	if len(args) > 0 {
-		fullCmd = command + " " + strings.Join(args, " ")
+//
+// Returns ErrSessionExists without touching it if a session with that name
+// already exists. If a later step fails, the session this call created is
+// killed again.
+func SpawnSession(sessionName, command string, args []string, cols, rows uint16, workdir string, opts SpawnOptions) (*os.File, *exec.Cmd, error) {
+	if err := ValidateSessionName(sessionName); err != nil {
+		return nil, nil, err
 	}
+	if SessionExists(sessionName) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSessionExists, sessionName)
+	}
+
+	// Build the full command to run inside tmux
+	fullCmd := shellCommand(command, args)
 
 	// Create tmux session detached
 	createArgs := []string{
@@ -48,33 +206,136 @@ func SpawnSession(sessionName, command string, args []string, cols, rows uint16,
 	if workdir != "" {
 		createArgs = append(createArgs, "-c", workdir)
 	}
+	for _, kv := range opts.Env {
+		createArgs = append(createArgs, "-e", kv)
+	}
 	createArgs = append(createArgs, fullCmd)
 
-	createCmd := exec.Command("tmux", createArgs...)
-	createCmd.Env = append(os.Environ(),
-		"TERM=xterm-256color",
-		"COLORTERM=truecolor",
-	)
-	if err := createCmd.Run(); err != nil {
+	// history-limit only takes effect when a pane is created, so it can't be
+	// set on the session afterwards, and default-terminal is server-wide.
+	// Temporarily set the global values around new-session, then restore
+	// them.
+	var globals [][2]string
+	if opts.HistoryLimit > 0 {
+		globals = append(globals, [2]string{"history-limit", strconv.Itoa(opts.HistoryLimit)})
+	}
+	if opts.DefaultTerminal != "" {
+		globals = append(globals, [2]string{"default-terminal", opts.DefaultTerminal})
+	}
+	if opts.StatusOff {
+		createArgs = append(createArgs, ";", "set-option", "-t", sessionName, "status", "off")
+	}
+	// Windows created later in the session start at the session size
+	createArgs = append(createArgs, ";", "set-option", "-t", sessionName, "default-size", fmt.Sprintf("%dx%d", cols, rows))
+
+	if err := runWithGlobalOptions(globals, createArgs, opts.ClientEnv); err != nil {
+		// new-session may have succeeded before a later command in the list
+		// failed; the name was free above, so a session by now is ours
+		KillSession(sessionName)
 		return nil, nil, fmt.Errorf("failed to create tmux session: %w", err)
 	}
 
 	// Attach to the session with a PTY
-	return AttachSession(sessionName, cols, rows)
+	file, cmd, err := AttachSession(sessionName, cols, rows, opts.ClientEnv)
+	if err != nil {
+		// Don't leave the session we just created behind
+		KillSession(sessionName)
+		return nil, nil, err
+	}
+	return file, cmd, nil
+}
+
+// shellCommand joins command and args into the single shell command line
+// tmux runs with sh -c, quoting each word so it reaches the program as is.
+func shellCommand(command string, args []string) string {
+	words := make([]string, 0, 1+len(args))
+	words = append(words, shellQuote(command))
+	for _, arg := range args {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
 }
 
-// AttachSession attaches to an existing tmux session, returning a PTY.
-func AttachSession(sessionName string, cols, rows uint16) (*os.File, *exec.Cmd, error) {
+// shellQuote quotes s as a single POSIX shell word. Words made only of safe
+// characters are left as they are, for readable tmux command lines.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./_-", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// globalOptionsMu serializes runWithGlobalOptions, so concurrent spawns
+// don't read each other's temporary values as the ones to restore.
+var globalOptionsMu sync.Mutex
+
+// runWithGlobalOptions runs the tmux command args, with env added to the
+// client's environment, while the given global options are set. The
+// previous values are restored in a separate invocation that runs even if
+// the command failed, since tmux stops a command list at the first error.
+func runWithGlobalOptions(globals [][2]string, args []string, env []string) error {
+	if len(globals) == 0 {
+		cmd := tmuxCommand(args...)
+		cmd.Env = append(os.Environ(), env...)
+		return runCommand(cmd)
+	}
+
+	globalOptionsMu.Lock()
+	defer globalOptionsMu.Unlock()
+
+	wrapped := []string{"start-server"}
+	restore := []string{"start-server"}
+	for _, g := range globals {
+		if prev, err := globalOption(g[0]); err == nil && prev != "" {
+			restore = append(restore, ";", "set-option", "-g", g[0], prev)
+		} else {
+			restore = append(restore, ";", "set-option", "-g", "-u", g[0])
+		}
+		wrapped = append(wrapped, ";", "set-option", "-g", g[0], g[1])
+	}
+	wrapped = append(append(wrapped, ";"), args...)
+
+	cmd := tmuxCommand(wrapped...)
+	cmd.Env = append(os.Environ(), env...)
+	err := runCommand(cmd)
+	if rerr := runCommand(tmuxCommand(restore...)); rerr != nil {
+		slog.Warn("Failed to restore global tmux options", "error", rerr)
+	}
+	return err
+}
+
+// globalOption returns the value of a global tmux option, starting the tmux
+// server if needed so the configuration file has been applied.
+func globalOption(name string) (string, error) {
+	cmd := tmuxCommand("start-server", ";", "show-options", "-gv", name)
+	output, err := commandOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to show global option %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// AttachSession attaches to an existing tmux session, returning a PTY. env
+// holds extra KEY=value entries for the tmux client, e.g. the TERM of the
+// terminal clients render in.
+func AttachSession(sessionName string, cols, rows uint16, env []string) (*os.File, *exec.Cmd, error) {
 	if !SessionExists(sessionName) {
 		return nil, nil, fmt.Errorf("tmux session %q does not exist", sessionName)
 	}
 
 	// Attach to the tmux session
-	attachCmd := exec.Command("tmux", "attach-session", "-t", sessionName)
-	attachCmd.Env = append(os.Environ(),
-		"TERM=xterm-256color",
-		"COLORTERM=truecolor",
-	)
+	attachCmd := tmuxCommand("attach-session", "-t", sessionName)
+	attachCmd.Env = append(os.Environ(), env...)
 
 	ptmx, err := pty.StartWithSize(attachCmd, &pty.Winsize{
 		Cols: cols,
@@ -92,32 +353,88 @@ func KillSession(sessionName string) error {
 	if !SessionExists(sessionName) {
 		return nil // Session already gone, that's fine
 	}
-	cmd := exec.Command("tmux", "kill-session", "-t", sessionName)
-	return cmd.Run()
+	cmd := tmuxCommand("kill-session", "-t", sessionName)
+	return runCommand(cmd)
 }
 
-// ResizeSession resizes the tmux session window.
+// ResizeSession resizes every window in a session and records the size as
+// the session's default-size, so windows created later don't drift.
 func ResizeSession(sessionName string, cols, rows uint16) error {
-	// Resize the tmux window
-	cmd := exec.Command("tmux", "resize-window", "-t", sessionName, "-x", fmt.Sprintf("%d", cols), "-y", fmt.Sprintf("%d", rows))
-	return cmd.Run()
+	output, err := commandOutput(tmuxCommand("list-windows", "-t", sessionName, "-F", "#{window_id}"))
+	if err != nil {
+		return fmt.Errorf("failed to list windows: %w", err)
+	}
+
+	x, y := fmt.Sprintf("%d", cols), fmt.Sprintf("%d", rows)
+	args := []string{"set-option", "-t", sessionName, "default-size", x + "x" + y}
+	for _, window := range strings.Fields(string(output)) {
+		args = append(args, ";", "resize-window", "-t", window, "-x", x, "-y", y)
+	}
+	return runCommand(tmuxCommand(args...))
 }
 
-// CapturePane captures the scrollback buffer from a tmux session.
-// Returns the raw output including ANSI codes. Lines specifies how many lines
-// to capture from the scrollback (default 1000 if 0).
-func CapturePane(sessionName string, lines int) (string, error) {
-	if !SessionExists(sessionName) {
-		return "", fmt.Errorf("tmux session %q does not exist", sessionName)
+// RefreshClients forces every client attached to a session to redraw.
+func RefreshClients(sessionName string) error {
+	cmd := tmuxCommand("list-clients", "-t", sessionName, "-F", "#{client_name}")
+	output, err := commandOutput(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to list clients: %w", err)
 	}
 
+	for _, client := range strings.Fields(string(output)) {
+		if err := runCommand(tmuxCommand("refresh-client", "-t", client)); err != nil {
+			return fmt.Errorf("failed to refresh client %s: %w", client, err)
+		}
+	}
+	return nil
+}
+
+// CapturePane captures the scrollback buffer from a tmux session as plain
+// text. Lines specifies how many lines to capture from the scrollback
+// (default 1000 if 0).
+func CapturePane(sessionName string, lines int) (string, error) {
+	return capturePane(sessionName, historyLines(lines), false)
+}
+
+// CapturePaneEscaped is CapturePane with the text attributes and colors kept
+// as ANSI escape sequences, so a terminal can render the history as it was
+// displayed. Lines end in "\n" and the visible pane follows the history,
+// blank rows included.
+func CapturePaneEscaped(sessionName string, lines int) (string, error) {
+	return capturePane(sessionName, historyLines(lines), true)
+}
+
+// CaptureScreen captures only the visible pane of a tmux session, without
+// history. With escapes, attributes and colors are kept as escape sequences.
+func CaptureScreen(sessionName string, escapes bool) (string, error) {
+	return capturePane(sessionName, 0, escapes)
+}
+
+// historyLines applies the default of 1000 history lines.
+func historyLines(lines int) int {
 	if lines <= 0 {
-		lines = 1000
+		return 1000
+	}
+	return lines
+}
+
+// capturePane captures the visible pane preceded by lines of history.
+func capturePane(sessionName string, lines int, escapes bool) (string, error) {
+	if !SessionExists(sessionName) {
+		return "", fmt.Errorf("tmux session %q does not exist", sessionName)
 	}
 
 	// capture-pane -p prints to stdout, -t targets session, -S sets start line (negative = history)
-	cmd := exec.Command("tmux", "capture-pane", "-p", "-t", sessionName, "-S", fmt.Sprintf("-%d", lines))
-	output, err := cmd.Output()
+	args := []string{"capture-pane", "-p", "-t", sessionName}
+	if lines > 0 {
+		args = append(args, "-S", fmt.Sprintf("-%d", lines))
+	}
+	if escapes {
+		// -e keeps attributes and colors as escape sequences
+		args = append(args, "-e")
+	}
+	cmd := tmuxCommand(args...)
+	output, err := commandOutput(cmd)
 	if err != nil {
 		return "", fmt.Errorf("failed to capture pane: %w", err)
 	}
@@ -127,8 +444,8 @@ func CapturePane(sessionName string, lines int) (string, error) {
 
 // ListSessions returns a list of tmux session names with a given prefix.
 func ListSessions(prefix string) ([]string, error) {
-	cmd := exec.Command("tmux", "list-sessions", "-F", "#{session_name}")
-	output, err := cmd.Output()
+	cmd := tmuxCommand("list-sessions", "-F", "#{session_name}")
+	output, err := commandOutput(cmd)
 	if err != nil {
 		// If no sessions exist, tmux returns an error
 		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
@@ -146,15 +463,15 @@ func ListSessions(prefix string) ([]string, error) {
 	return sessions, nil
 }
 
-// GetSessionInfo returns information about a tmux session.
-// Returns number of attached clients, or -1 if session doesn't exist.
+// GetSessionClientCount returns the number of tmux clients attached to a
+// session, including our own attachment, or -1 if the session doesn't exist.
 func GetSessionClientCount(sessionName string) int {
 	if !SessionExists(sessionName) {
 		return -1
 	}
 
-	cmd := exec.Command("tmux", "display-message", "-t", sessionName, "-p", "#{session_attached}")
-	output, err := cmd.Output()
+	cmd := tmuxCommand("display-message", "-t", sessionName, "-p", "#{session_attached}")
+	output, err := commandOutput(cmd)
 	if err != nil {
 		return -1
 	}
@@ -163,3 +480,207 @@ func GetSessionClientCount(sessionName string) int {
 	fmt.Sscanf(strings.TrimSpace(string(output)), "%d", &count)
 	return count
 }
+
+// SessionClientPIDs returns the process IDs of the tmux clients attached to
+// a session, so callers can tell their own attachments from others.
+func SessionClientPIDs(sessionName string) ([]int, error) {
+	output, err := commandOutput(tmuxCommand("list-clients", "-t", sessionName, "-F", "#{client_pid}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clients: %w", err)
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(string(output)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected client pid %q", field)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// SendKeys sends a key, in tmux key syntax (e.g. "C-c"), to a session's
+// active pane.
+func SendKeys(sessionName, key string) error {
+	if err := runCommand(tmuxCommand("send-keys", "-t", sessionName, key)); err != nil {
+		return fmt.Errorf("failed to send keys: %w", err)
+	}
+	return nil
+}
+
+// RespawnPane kills the program in a session's active pane and starts
+// command in its place. The pane, and any clients attached to the session,
+// are kept. env holds extra KEY=value entries for the new program, and
+// defaultTerminal, if set, its TERM as for SpawnOptions.DefaultTerminal.
+func RespawnPane(sessionName, command string, args []string, workdir string, env []string, defaultTerminal string) error {
+	fullCmd := shellCommand(command, args)
+
+	respawnArgs := []string{"respawn-pane", "-k", "-t", sessionName}
+	if workdir != "" {
+		respawnArgs = append(respawnArgs, "-c", workdir)
+	}
+	for _, kv := range env {
+		respawnArgs = append(respawnArgs, "-e", kv)
+	}
+	respawnArgs = append(respawnArgs, fullCmd)
+	var globals [][2]string
+	if defaultTerminal != "" {
+		globals = [][2]string{{"default-terminal", defaultTerminal}}
+	}
+
+	if err := runWithGlobalOptions(globals, respawnArgs, nil); err != nil {
+		return fmt.Errorf("failed to respawn pane: %w", err)
+	}
+	return nil
+}
+
+// PanePID returns the process ID of the program running in a session's
+// active pane.
+func PanePID(sessionName string) (int, error) {
+	output, err := commandOutput(tmuxCommand("display-message", "-t", sessionName, "-p", "#{pane_pid}"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pane pid: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected pane pid %q", strings.TrimSpace(string(output)))
+	}
+	return pid, nil
+}
+
+// SessionActivity returns when a session last had activity.
+func SessionActivity(sessionName string) (time.Time, error) {
+	output, err := commandOutput(tmuxCommand("display-message", "-t", sessionName, "-p", "#{session_activity}"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get session activity: %w", err)
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected session activity %q", strings.TrimSpace(string(output)))
+	}
+	return time.Unix(secs, 0), nil
+}
+
+// SessionDetails describes an existing tmux session.
+type SessionDetails struct {
+	Cols, Rows uint16 // size of the attaching terminal, status bar included
+	Command    string // program running in the active pane
+	CreatedAt  time.Time
+}
+
+// DescribeSession returns the size, running command and creation time of a
+// session, e.g. to adopt it after a server restart.
+func DescribeSession(sessionName string) (SessionDetails, error) {
+	output, err := commandOutput(tmuxCommand("display-message", "-t", sessionName, "-p",
+		"#{window_width} #{window_height} #{session_created} #{status} #{pane_current_command}"))
+	if err != nil {
+		return SessionDetails{}, fmt.Errorf("failed to describe session: %w", err)
+	}
+	line := strings.TrimSpace(string(output))
+	fields := strings.SplitN(line, " ", 5)
+	if len(fields) < 4 {
+		return SessionDetails{}, fmt.Errorf("unexpected session description %q", line)
+	}
+	cols, errCols := strconv.ParseUint(fields[0], 10, 16)
+	rows, errRows := strconv.ParseUint(fields[1], 10, 16)
+	created, errCreated := strconv.ParseInt(fields[2], 10, 64)
+	if errCols != nil || errRows != nil || errCreated != nil {
+		return SessionDetails{}, fmt.Errorf("unexpected session description %q", line)
+	}
+	// The window excludes the status bar, which is "on" or a line count
+	switch status := fields[3]; status {
+	case "on":
+		rows++
+	case "off":
+	default:
+		if n, err := strconv.ParseUint(status, 10, 8); err == nil {
+			rows += n
+		}
+	}
+	details := SessionDetails{Cols: uint16(cols), Rows: uint16(rows), CreatedAt: time.Unix(created, 0)}
+	if len(fields) == 5 {
+		details.Command = fields[4]
+	}
+	return details, nil
+}
+
+// ErrOptionNotAllowed is returned for tmux options outside the managed whitelist.
+var ErrOptionNotAllowed = errors.New("tmux option is not allowed")
+
+// ErrInvalidOptionValue is returned when a whitelisted option is given a bad value.
+var ErrInvalidOptionValue = errors.New("invalid tmux option value")
+
+// allowedOptions is the whitelist of session options clients may read and set.
+// Each entry validates a proposed value; anything else could break the
+// managed session (e.g. changing the prefix key or default command).
+var allowedOptions = map[string]func(value string) error{
+	"history-limit": validateNonNegativeInt,
+	"mouse":         validateOnOff,
+	"status":        validateOnOff,
+}
+
+func validateNonNegativeInt(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("value %q must be a non-negative integer", value)
+	}
+	return nil
+}
+
+func validateOnOff(value string) error {
+	if value != "on" && value != "off" {
+		return fmt.Errorf("value %q must be \"on\" or \"off\"", value)
+	}
+	return nil
+}
+
+// AllowedOptions returns the names of the tmux options clients may manage.
+func AllowedOptions() []string {
+	names := make([]string, 0, len(allowedOptions))
+	for name := range allowedOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ShowOption returns the effective value of a whitelisted session option,
+// including values inherited from the global options.
+func ShowOption(sessionName, name string) (string, error) {
+	if _, ok := allowedOptions[name]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrOptionNotAllowed, name)
+	}
+
+	cmd := tmuxCommand("show-options", "-A", "-v", "-t", sessionName, name)
+	output, err := commandOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to show option %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ValidateOption checks that an option is whitelisted and the value is acceptable.
+func ValidateOption(name, value string) error {
+	validate, ok := allowedOptions[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrOptionNotAllowed, name)
+	}
+	if err := validate(value); err != nil {
+		return fmt.Errorf("%w for %s: %v", ErrInvalidOptionValue, name, err)
+	}
+	return nil
+}
+
+// SetOption sets a whitelisted session option after validating its value.
+func SetOption(sessionName, name, value string) error {
+	if err := ValidateOption(name, value); err != nil {
+		return err
+	}
+
+	cmd := tmuxCommand("set-option", "-t", sessionName, name, value)
+	if err := runCommand(cmd); err != nil {
+		return fmt.Errorf("failed to set option %s: %w", name, err)
+	}
+	return nil
+}
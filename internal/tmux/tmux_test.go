@@ -0,0 +1,305 @@
+package tmux
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShellCommandRoundTrip(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	args := []string{
+		"plain",
+		"",
+		"two words",
+		"it's",
+		`'\''`,
+		"$(touch /tmp/pwned)",
+		"a;b|c&d>e",
+		"`id`",
+		"line\nbreak",
+		`back\slash "dq"`,
+	}
+	line := shellCommand("printf", append([]string{`%s\0`}, args...))
+	out, err := exec.Command(sh, "-c", line).Output()
+	if err != nil {
+		t.Fatalf("sh -c %q: %v", line, err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(got) != len(args) {
+		t.Fatalf("got %d args %q, want %d", len(got), got, len(args))
+	}
+	for i := range args {
+		if got[i] != args[i] {
+			t.Errorf("arg %d = %q, want %q", i, got[i], args[i])
+		}
+	}
+}
+
+func TestShellQuoteLeavesSafeWords(t *testing.T) {
+	for _, s := range []string{"bash", "/bin/sh", "--norc", "KEY=value", "a.b,c:d@e%f+g"} {
+		if got := shellQuote(s); got != s {
+			t.Errorf("shellQuote(%q) = %q, want unchanged", s, got)
+		}
+	}
+}
+
+// stubBinary makes a shell script with body the tmux binary for the rest of
+// the test, and returns its path.
+func stubBinary(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("tmux is not supported on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "fake-tmux")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	SetBinary(path)
+	t.Cleanup(func() { SetBinary("") })
+	return path
+}
+
+func TestSetBinary(t *testing.T) {
+	path := stubBinary(t, `[ "$1" = list-sessions ] && printf 'pty_a\nother\npty_b\n'`)
+	if Binary() != path {
+		t.Fatalf("Binary() = %q, want %q", Binary(), path)
+	}
+	if err := CheckInstalled(); err != nil {
+		t.Fatalf("CheckInstalled with the stub: %v", err)
+	}
+	// Commands run the configured binary
+	names, err := ListSessions("pty_")
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if want := []string{"pty_a", "pty_b"}; !slices.Equal(names, want) {
+		t.Errorf("ListSessions = %q, want %q", names, want)
+	}
+
+	SetBinary(filepath.Join(t.TempDir(), "missing-tmux"))
+	if err := CheckInstalled(); !errors.Is(err, ErrTmuxNotInstalled) {
+		t.Errorf("CheckInstalled with a missing binary: %v, want ErrTmuxNotInstalled", err)
+	}
+	SetBinary("")
+	if Binary() != "tmux" {
+		t.Errorf("Binary() after resetting = %q, want tmux", Binary())
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	stubBinary(t, "exec sleep 5\n")
+	SetCommandTimeout(100 * time.Millisecond)
+	t.Cleanup(func() { SetCommandTimeout(10 * time.Second) })
+
+	start := time.Now()
+	_, err := ListSessions("")
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Fatalf("ListSessions with a hung tmux: %v, want ErrCommandTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("ListSessions returned after %s, want about the timeout", elapsed)
+	}
+	if _, err := DescribeSession("pty_x"); !errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("DescribeSession with a hung tmux: %v, want ErrCommandTimeout", err)
+	}
+}
+
+// privateServer points tmux at a private server for the rest of the test,
+// so the test leaves the user's alone.
+func privateServer(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	// Inside tmux, $TMUX would name the server regardless of TMUX_TMPDIR
+	t.Setenv("TMUX", "")
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	t.Cleanup(func() { exec.Command("tmux", "kill-server").Run() })
+}
+
+// privateSession starts a detached session on a private tmux server and
+// returns its name.
+func privateSession(t *testing.T) string {
+	t.Helper()
+	privateServer(t)
+	const name = "pty_options"
+	if out, err := exec.Command("tmux", "new-session", "-d", "-s", name, "cat").CombinedOutput(); err != nil {
+		t.Fatalf("new-session: %v: %s", err, out)
+	}
+	return name
+}
+
+func TestSessionOptions(t *testing.T) {
+	name := privateSession(t)
+
+	for option, value := range map[string]string{"mouse": "on", "status": "off", "history-limit": "12345"} {
+		if err := SetOption(name, option, value); err != nil {
+			t.Fatalf("SetOption(%s, %s): %v", option, value, err)
+		}
+		got, err := ShowOption(name, option)
+		if err != nil {
+			t.Fatalf("ShowOption(%s): %v", option, err)
+		}
+		if got != value {
+			t.Errorf("%s = %q after setting it to %q", option, got, value)
+		}
+	}
+
+	// Unset options report the inherited global value
+	exec.Command("tmux", "set-option", "-u", "-t", name, "mouse").Run()
+	if got, err := ShowOption(name, "mouse"); err != nil || got != "off" {
+		t.Errorf("inherited mouse = %q, %v; want the global off", got, err)
+	}
+}
+
+func TestSessionOptionsWhitelist(t *testing.T) {
+	// Rejected before tmux is run
+	stubBinary(t, "exit 1\n")
+	if err := SetOption("pty_a", "prefix", "C-a"); !errors.Is(err, ErrOptionNotAllowed) {
+		t.Errorf("setting prefix: %v, want ErrOptionNotAllowed", err)
+	}
+	if _, err := ShowOption("pty_a", "default-command"); !errors.Is(err, ErrOptionNotAllowed) {
+		t.Errorf("showing default-command: %v, want ErrOptionNotAllowed", err)
+	}
+	for option, value := range map[string]string{"mouse": "yes", "status": "", "history-limit": "-1"} {
+		if err := SetOption("pty_a", option, value); !errors.Is(err, ErrInvalidOptionValue) {
+			t.Errorf("setting %s to %q: %v, want ErrInvalidOptionValue", option, value, err)
+		}
+	}
+	if want := []string{"history-limit", "mouse", "status"}; !slices.Equal(AllowedOptions(), want) {
+		t.Errorf("AllowedOptions() = %q, want %q", AllowedOptions(), want)
+	}
+}
+
+func TestSpawnSessionHistoryLimit(t *testing.T) {
+	privateSession(t) // keeps the server up between spawns
+	global := func() string {
+		out, _ := exec.Command("tmux", "show-options", "-g", "-v", "history-limit").Output()
+		return strings.TrimSpace(string(out))
+	}
+	before := global()
+
+	for name, limit := range map[string]int{"pty_history": 12345, "pty_default": 0} {
+		file, cmd, err := SpawnSession(name, "cat", nil, 80, 24, "", SpawnOptions{HistoryLimit: limit})
+		if err != nil {
+			t.Fatalf("SpawnSession: %v", err)
+		}
+		t.Cleanup(func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+			file.Close()
+		})
+		out, err := exec.Command("tmux", "display-message", "-p", "-t", name, "#{history_limit}").Output()
+		if err != nil {
+			t.Fatalf("display-message: %v", err)
+		}
+		want := before
+		if limit > 0 {
+			want = strconv.Itoa(limit)
+		}
+		if got := strings.TrimSpace(string(out)); got != want {
+			t.Errorf("%s: pane history limit %s, want %s", name, got, want)
+		}
+	}
+	if after := global(); after != before {
+		t.Errorf("global history-limit %s after spawning, want it restored to %s", after, before)
+	}
+}
+
+func TestValidateSessionName(t *testing.T) {
+	for _, name := range []string{"pty_abc123", "my-session", "naïve", strings.Repeat("a", MaxSessionNameLength)} {
+		if err := ValidateSessionName(name); err != nil {
+			t.Errorf("ValidateSessionName(%q): %v", name, err)
+		}
+	}
+	for _, name := range []string{
+		"",
+		strings.Repeat("a", MaxSessionNameLength+1),
+		"with.dot",
+		"with:colon",
+		"with space",
+		"tab\there",
+		"new\nline",
+		"del\x7f",
+	} {
+		if err := ValidateSessionName(name); !errors.Is(err, ErrInvalidSessionName) {
+			t.Errorf("ValidateSessionName(%q): %v, want ErrInvalidSessionName", name, err)
+		}
+	}
+}
+
+func TestNormalizeSessionName(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"plain", "plain"},
+		{"my.project:main", "my_project_main"},
+		{"two words\tand\ncontrol", "two_words_and_control"},
+		{strings.Repeat("a", 100), strings.Repeat("a", MaxSessionNameLength)},
+		// A multi-byte character that doesn't fit whole is dropped
+		{strings.Repeat("a", MaxSessionNameLength-1) + "é", strings.Repeat("a", MaxSessionNameLength-1)},
+	} {
+		got, err := NormalizeSessionName(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeSessionName(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			continue
+		}
+		if err := ValidateSessionName(got); err != nil {
+			t.Errorf("normalized %q is not valid: %v", got, err)
+		}
+	}
+	for _, in := range []string{"", "...", " : \t"} {
+		if _, err := NormalizeSessionName(in); !errors.Is(err, ErrInvalidSessionName) {
+			t.Errorf("NormalizeSessionName(%q): %v, want ErrInvalidSessionName", in, err)
+		}
+	}
+}
+
+func TestSpawnSessionRejectsInvalidName(t *testing.T) {
+	// Rejected before tmux is run
+	stubBinary(t, "exit 1\n")
+	for _, name := range []string{strings.Repeat("x", MaxSessionNameLength+1), "a.b"} {
+		if _, _, err := SpawnSession(name, "cat", nil, 80, 24, "", SpawnOptions{}); !errors.Is(err, ErrInvalidSessionName) {
+			t.Errorf("SpawnSession(%q): %v, want ErrInvalidSessionName", name, err)
+		}
+	}
+}
+
+func TestResizeSessionResizesAllWindows(t *testing.T) {
+	name := privateSession(t)
+	if out, err := exec.Command("tmux", "new-window", "-d", "-t", name, "cat").CombinedOutput(); err != nil {
+		t.Fatalf("new-window: %v: %s", err, out)
+	}
+	sizes := func() []string {
+		t.Helper()
+		out, err := exec.Command("tmux", "list-windows", "-t", name, "-F", "#{window_width}x#{window_height}").Output()
+		if err != nil {
+			t.Fatalf("list-windows: %v", err)
+		}
+		return strings.Fields(string(out))
+	}
+
+	if err := ResizeSession(name, 100, 30); err != nil {
+		t.Fatalf("ResizeSession: %v", err)
+	}
+	if got := sizes(); !slices.Equal(got, []string{"100x30", "100x30"}) {
+		t.Errorf("window sizes = %q, want both 100x30", got)
+	}
+
+	// A window created afterwards starts at the session size
+	if out, err := exec.Command("tmux", "new-window", "-d", "-t", name, "cat").CombinedOutput(); err != nil {
+		t.Fatalf("new-window: %v: %s", err, out)
+	}
+	if got := sizes(); !slices.Equal(got, []string{"100x30", "100x30", "100x30"}) {
+		t.Errorf("window sizes = %q, want all 100x30", got)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// logLevels maps -log-level values to slog levels.
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// newLogHandler returns the slog handler for -log-format and -log-level.
+func newLogHandler(w io.Writer, format, level string) (slog.Handler, error) {
+	lvl, ok := logLevels[level]
+	if !ok {
+		return nil, fmt.Errorf("unsupported log level %q, expected debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		opts.ReplaceAttr = durationString
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format %q, expected text or json", format)
+	}
+}
+
+// durationString logs durations as e.g. "30s", as the text handler does,
+// instead of the JSON handler's integer nanoseconds.
+func durationString(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindDuration {
+		a.Value = slog.StringValue(a.Value.Duration().String())
+	}
+	return a
+}
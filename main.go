@@ -2,18 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/itsmylife44/terminus-pty/internal/api"
 	"github.com/itsmylife44/terminus-pty/internal/auth"
+	"github.com/itsmylife44/terminus-pty/internal/pty"
 	"github.com/itsmylife44/terminus-pty/internal/session"
 	"github.com/itsmylife44/terminus-pty/internal/tmux"
 )
@@ -24,20 +28,97 @@ var (
 	date    = "unknown"
 )
 
+// sessionIDPattern restricts -default-session to IDs that are safe in URLs
+// and as tmux session names.
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 func main() {
 	port := flag.Int("port", 3001, "Port to listen on")
 	host := flag.String("host", "127.0.0.1", "Host to bind to")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file; serves HTTPS together with -tls-key")
+	tlsKey := flag.String("tls-key", "", "TLS private key file; serves HTTPS together with -tls-cert")
+	tlsMinVersion := flag.String("tls-min-version", "1.2", "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
 	sessionTimeout := flag.Duration("session-timeout", 30*time.Second, "Session pool timeout after disconnect")
 	cleanupInterval := flag.Duration("cleanup-interval", 10*time.Second, "Session cleanup interval")
-	shell := flag.String("shell", "", "Shell to use (default: $SHELL or /bin/bash) - alias for --command")
-	command := flag.String("command", "", "Command to run (default: $SHELL or /bin/bash)")
-	args := flag.String("args", "", "Command arguments (comma-separated, default: -l,-i for shells)")
+	shell := flag.String("shell", "", "Shell to use (default: $SHELL or /bin/bash, PowerShell on Windows) - alias for --command")
+	command := flag.String("command", "", "Command to run (default: $SHELL or /bin/bash, PowerShell on Windows)")
+	args := flag.String("args", "", "Command arguments, comma-separated or shell-quoted (default: -l,-i for shells)")
 	workdir := flag.String("workdir", "", "Working directory for new sessions")
+	workdirRoot := flag.String("workdir-root", "", "Directory client-requested workdirs must lie within (empty = unrestricted)")
+	var commandWorkdirs stringListFlag
+	flag.Var(&commandWorkdirs, "command-workdir", "Default workdir for a command as command=dir, e.g. vim=$HOME/notes (repeatable)")
+	var extraEnv stringListFlag
+	flag.Var(&extraEnv, "env", "Environment variable for every session as KEY=VALUE (repeatable)")
+	term := flag.String("term", session.DefaultTerm, "TERM for commands: the terminal type clients render as")
+	colorTerm := flag.String("colorterm", session.DefaultColorTerm, "COLORTERM for commands")
+	var initCommands stringListFlag
+	flag.Var(&initCommands, "init-command", "Command typed into each new session once it starts, e.g. \"cd /project\" (repeatable)")
+	profilesFile := flag.String("profiles", "", "JSON file of named session profiles clients select with \"profile\"")
+	banner := flag.String("banner", "", "Banner shown to the first client of each session")
+	bannerFile := flag.String("banner-file", "", "File whose contents are shown to the first client of each session")
+	var commandBanners stringListFlag
+	flag.Var(&commandBanners, "command-banner", "Banner for a command as command=text, overriding -banner (repeatable)")
+	minSize := flag.String("min-size", "10x2", "Minimum terminal size as COLSxROWS; smaller sizes are clamped up")
+	var commandSizes stringListFlag
+	flag.Var(&commandSizes, "command-size", "Default terminal size for a command as command=COLSxROWS, e.g. less=200x50 (repeatable)")
+	fallbackCommand := flag.String("fallback-command", "", "Command to try when the requested command fails to spawn (e.g. /bin/sh)")
+	allowedCommands := flag.String("allowed-commands", "", "Comma-separated commands sessions may run, as paths or names looked up in PATH (empty = any)")
 	authUser := flag.String("auth-user", "", "Basic auth username (optional)")
 	authPass := flag.String("auth-pass", "", "Basic auth password (optional)")
+	authFile := flag.String("auth-file", "", "File of username:bcrypt-hash lines for basic auth, reloaded on SIGHUP; overrides -auth-user/-auth-pass (optional)")
+	var authTokens stringListFlag
+	flag.Var(&authTokens, "auth-token", "Bearer token accepted for authentication; comma-separated or repeatable (optional)")
+	strictJSON := flag.Bool("strict-json", false, "Reject API request bodies containing unknown fields")
+	defaultSession := flag.String("default-session", "", "Session ID created with the defaults on first connect to /pty/{id}/connect, e.g. default (empty = disabled)")
+	metricsAuth := flag.Bool("metrics-auth", false, "Require authentication for /metrics (exempt by default)")
+	ticketTTL := flag.Duration("ticket-ttl", 30*time.Second, "Lifetime of one-time WebSocket connect tickets")
 	tmuxEnabled := flag.Bool("tmux-enabled", false, "Spawn PTY sessions inside tmux for persistence")
+	tmuxBin := flag.String("tmux-bin", "tmux", "tmux binary name or path")
+	tmuxTimeout := flag.Duration("tmux-timeout", 10*time.Second, "Timeout for tmux commands other than attach (0 = no limit)")
 	maxInactive := flag.String("max-inactive", "24h", "Maximum inactivity time for tmux sessions before cleanup")
+	tmuxHistoryLimit := flag.Int("tmux-history-limit", 0, "tmux history-limit for new sessions (0 = tmux default)")
+	tmuxReplayLines := flag.Int("tmux-replay-lines", 1000, "tmux pane history lines sent to connecting clients (0 = disabled)")
+	tmuxStatus := flag.Bool("tmux-status", true, "Show the tmux status bar in new sessions")
+	tmuxTerm := flag.String("tmux-term", "", "TERM inside tmux sessions, as tmux's default-terminal (default: tmux's own, e.g. tmux-256color)")
+	maxOutputBytes := flag.Int64("max-output-bytes", 0, "Terminate sessions that produce more than this much output (0 = unlimited)")
+	maxResizeRate := flag.Float64("max-resize-rate", 0, "Resizes applied per second per session; faster resizes are coalesced (0 = unlimited)")
+	maxOutputRate := flag.Int64("max-output-rate", 0, "Output bytes per second per session; faster commands are slowed down (0 = unlimited)")
+	verifyResize := flag.Bool("verify-resize", false, "Read the PTY size back after resizing and retry once if it didn't stick")
+	wsWriteTimeout := flag.Duration("ws-write-timeout", session.DefaultWriteTimeout, "Timeout for each WebSocket write; clients that don't take a message in time are disconnected")
+	inputReplayWindow := flag.Duration("input-replay-window", 0, "How long a disconnected client's last sequenced input number is kept, so it can resend lost input on reconnect (0 = not kept)")
+	singleWriter := flag.Bool("single-writer", false, "Reject a writing client with 409 while another one is attached; read-only clients may still join")
+	deleteKillsTmux := flag.Bool("delete-kills-tmux", true, "Kill the tmux session on DELETE (false = detach and keep it running)")
 	cleanupIntervalTmux := flag.String("cleanup-interval-tmux", "1h", "Interval for tmux session cleanup (min: 10m)")
+	spoolDir := flag.String("spool-dir", "", "Directory for spooled session output (default: $TMPDIR/terminus-pty)")
+	spoolMaxBytes := flag.Int64("spool-max-bytes", 10<<20, "Spool file size before rotation")
+	spoolReplayBytes := flag.Int64("spool-replay-bytes", 0, "Bytes of spooled output replayed on connect (0 = all retained)")
+	exitedTTL := flag.Duration("exited-ttl", 5*time.Minute, "How long GET /pty/{id} reports the exit status of a session whose command exited (0 = not kept)")
+	scrollbackBytes := flag.Int("scrollback-bytes", 64<<10, "Output kept in memory per direct session and replayed on connect (0 = disabled)")
+	readBufferBytes := flag.Int("read-buffer-bytes", session.DefaultReadBufferSize, "PTY output read at once")
+	outputBatchBytes := flag.Int("output-batch-bytes", 0, "Merge output waiting to be sent into WebSocket frames up to this size (0 = disabled)")
+	maxArgs := flag.Int("max-args", 1024, "Command args accepted per request (0 = unlimited)")
+	maxArgsBytes := flag.Int("max-args-bytes", 128<<10, "Total length of command args accepted per request (0 = unlimited)")
+	maxSessions := flag.Int("max-sessions", 0, "Live sessions allowed at once; further creates get 429 (0 = unlimited)")
+	evictionPolicy := flag.String("eviction-policy", "reject", "What a create beyond -max-sessions does: reject, or lru to close the least recently active session without clients")
+	recordDir := flag.String("record-dir", "", "Record sessions to asciinema v2 cast files in this directory (empty = off)")
+	recordTimestamps := flag.Bool("record-timestamps", false, "Add each recorded event's wall-clock time as an extension field")
+	recordMaxBytes := flag.Int64("record-max-bytes", 0, "Rotate recordings into a new cast segment at this size (0 = unlimited)")
+	recordMaxDuration := flag.Duration("record-max-duration", 0, "Rotate recordings into a new cast segment after this long (0 = unlimited)")
+	bellEvents := flag.Bool("bell-events", false, "Send a {\"type\":\"bell\"} control message when output rings the bell")
+	var redactPatterns stringListFlag
+	flag.Var(&redactPatterns, "redact", "Regex whose matches are masked in PTY output (repeatable)")
+	outputCharset := flag.String("output-charset", "", "Convert PTY output from this charset (e.g. latin1) to UTF-8 (default: pass through)")
+	redactOverlap := flag.Int("redact-overlap", 64, "Bytes held back between reads so redaction matches split across reads are caught")
+	inputIdleTimeout := flag.Duration("input-idle-timeout", 0, "Act on sessions with no client input for this long (0 = disabled)")
+	inputIdleAction := flag.String("input-idle-action", "close", "Action on input idle timeout: warn or close")
+	outputIdleTimeout := flag.Duration("output-idle-timeout", 0, "Act on sessions with no PTY output for this long (0 = disabled)")
+	idleTimeout := flag.Duration("idle-timeout", 0, "Close sessions with neither input nor output for this long, even with clients attached (0 = disabled)")
+	restartMaxRetries := flag.Int("restart-max-retries", 5, "Restarts allowed per session with restartPolicy on-failure")
+	restartBackoff := flag.Duration("restart-backoff", time.Second, "Delay before the first on-failure restart, doubled on each retry")
+	outputIdleAction := flag.String("output-idle-action", "warn", "Action on output idle timeout: warn or close")
+	shutdownGrace := flag.Duration("shutdown-grace", 0, "On SIGTERM, wait this long for clients to disconnect before closing sessions (0 = close immediately)")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
 	showVersion := flag.Bool("version", false, "Show version")
 	flag.Parse()
 
@@ -46,20 +127,50 @@ func main() {
 		os.Exit(0)
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
-	slog.SetDefault(logger)
+	logHandler, err := newLogHandler(os.Stdout, *logFormat, *logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(logHandler))
+
+	tmux.SetBinary(*tmuxBin)
+	if *shutdownGrace < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -shutdown-grace must not be negative, got %s\n", *shutdownGrace)
+		os.Exit(1)
+	}
+	if *tmuxTimeout < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -tmux-timeout must not be negative, got %s\n", *tmuxTimeout)
+		os.Exit(1)
+	}
+	tmux.SetCommandTimeout(*tmuxTimeout)
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintf(os.Stderr, "Error: -tls-cert and -tls-key must be set together\n")
+		os.Exit(1)
+	}
+	if *defaultSession != "" && (!sessionIDPattern.MatchString(*defaultSession) || *defaultSession == "new") {
+		fmt.Fprintf(os.Stderr, "Error: -default-session must be letters, digits, '_' or '-' and not \"new\", got %q\n", *defaultSession)
+		os.Exit(1)
+	}
+	minTLSVersion, err := parseTLSVersion(*tlsMinVersion)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -tls-min-version: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Check tmux is installed if tmux mode is enabled
 	if *tmuxEnabled {
-		if err := tmux.CheckInstalled(); err != nil {
-			slog.Error("tmux mode enabled but tmux is not installed", "error", err)
-			fmt.Fprintf(os.Stderr, "Error: tmux mode enabled but tmux is not installed.\n")
-			fmt.Fprintf(os.Stderr, "Install tmux or run without --tmux-enabled flag.\n")
+		if err := tmux.CheckInstalled(); errors.Is(err, tmux.ErrUnsupported) {
+			fmt.Fprintf(os.Stderr, "Error: -tmux-enabled: %v.\n", err)
+			os.Exit(1)
+		} else if err != nil {
+			slog.Error("tmux mode enabled but tmux is not installed", "tmux_bin", tmux.Binary(), "error", err)
+			fmt.Fprintf(os.Stderr, "Error: tmux mode enabled but tmux is not installed (%s).\n", tmux.Binary())
+			fmt.Fprintf(os.Stderr, "Install tmux, set --tmux-bin, or run without --tmux-enabled flag.\n")
 			os.Exit(1)
 		}
-		slog.Info("tmux mode enabled - sessions will persist across disconnections")
+		slog.Info("tmux mode enabled - sessions will persist across disconnections", "tmux_bin", tmux.Binary())
 	}
 
 	// Parse tmux cleanup durations
@@ -88,76 +199,310 @@ func main() {
 		cmdPath = *shell // Backward compatibility
 	}
 	if cmdPath == "" {
-		cmdPath = os.Getenv("SHELL")
-		if cmdPath == "" {
-			cmdPath = "/bin/bash"
-		}
+		cmdPath = defaultCommand()
 	}
 
 	// Parse args
 	var cmdArgs []string
 	if *args != "" {
-		cmdArgs = strings.Split(*args, ",")
+		cmdArgs, err = splitArgs(*args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -args: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	cmdArgs = session.ShellDefaultArgs(cmdPath, cmdArgs)
+
+	// Compile redaction patterns
+	var redactRegexps []*regexp.Regexp
+	for _, pattern := range redactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			slog.Error("Invalid -redact pattern", "value", pattern, "error", err)
+			fmt.Fprintf(os.Stderr, "Error: invalid -redact pattern %q: %v\n", pattern, err)
+			os.Exit(1)
+		}
+		redactRegexps = append(redactRegexps, re)
+	}
+
+	var allowedCommandList []string
+	for _, entry := range strings.Split(*allowedCommands, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			allowedCommandList = append(allowedCommandList, entry)
+		}
+	}
+
+	// Parse per-command workdirs
+	commandWorkdirMap := make(map[string]string)
+	for _, entry := range commandWorkdirs {
+		name, dir, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || dir == "" {
+			slog.Error("Invalid -command-workdir entry", "value", entry)
+			fmt.Fprintf(os.Stderr, "Error: invalid -command-workdir %q, expected command=dir\n", entry)
+			os.Exit(1)
+		}
+		commandWorkdirMap[name] = dir
+	}
+
+	// Parse environment variables for every session
+	envMap := make(map[string]string)
+	for _, entry := range extraEnv {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: invalid -env %q, expected KEY=VALUE\n", entry)
+			os.Exit(1)
+		}
+		envMap[name] = value
 	}
-	// Default args for shells
-	if len(cmdArgs) == 0 && (strings.HasSuffix(cmdPath, "sh") || strings.Contains(cmdPath, "/sh")) {
-		cmdArgs = []string{"-l", "-i"}
+
+	// Load the banner and parse per-command banners
+	if *bannerFile != "" {
+		if *banner != "" {
+			fmt.Fprintf(os.Stderr, "Error: -banner and -banner-file are mutually exclusive\n")
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(*bannerFile)
+		if err != nil {
+			slog.Error("Failed to read -banner-file", "path", *bannerFile, "error", err)
+			fmt.Fprintf(os.Stderr, "Error: failed to read -banner-file: %v\n", err)
+			os.Exit(1)
+		}
+		*banner = string(data)
+	}
+	commandBannerMap := make(map[string]string)
+	for _, entry := range commandBanners {
+		name, text, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || text == "" {
+			slog.Error("Invalid -command-banner entry", "value", entry)
+			fmt.Fprintf(os.Stderr, "Error: invalid -command-banner %q, expected command=text\n", entry)
+			os.Exit(1)
+		}
+		commandBannerMap[name] = text
 	}
 
-	pool := session.NewPool(session.PoolConfig{
+	minSizeValue, err := parseSize(*minSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -min-size: %v\n", err)
+		os.Exit(1)
+	}
+
+	commandSizeMap := make(map[string]pty.Size)
+	for _, entry := range commandSizes {
+		name, value, ok := strings.Cut(entry, "=")
+		size, err := parseSize(value)
+		if !ok || name == "" || err != nil {
+			slog.Error("Invalid -command-size entry", "value", entry)
+			fmt.Fprintf(os.Stderr, "Error: invalid -command-size %q, expected command=COLSxROWS\n", entry)
+			os.Exit(1)
+		}
+		commandSizeMap[name] = size
+	}
+
+	var profiles map[string]session.Profile
+	if *profilesFile != "" {
+		var err error
+		if profiles, err = loadProfiles(*profilesFile); err != nil {
+			slog.Error("Failed to load -profiles", "path", *profilesFile, "error", err)
+			fmt.Fprintf(os.Stderr, "Error: failed to load -profiles: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	poolConfig := session.PoolConfig{
 		SessionTimeout:      *sessionTimeout,
 		CleanupInterval:     *cleanupInterval,
 		DefaultCommand:      cmdPath,
 		DefaultArgs:         cmdArgs,
 		DefaultWorkdir:      *workdir,
+		WorkdirRoot:         *workdirRoot,
+		FallbackCommand:     *fallbackCommand,
+		AllowedCommands:     allowedCommandList,
+		CommandWorkdirs:     commandWorkdirMap,
+		Term:                *term,
+		ColorTerm:           *colorTerm,
+		TmuxTerm:            *tmuxTerm,
+		Env:                 envMap,
 		TmuxEnabled:         *tmuxEnabled,
 		MaxInactive:         maxInactiveDur,
 		TmuxCleanupInterval: cleanupIntervalTmuxDur,
-	})
+		TmuxHistoryLimit:    *tmuxHistoryLimit,
+		TmuxReplayLines:     *tmuxReplayLines,
+		TmuxStatusOff:       !*tmuxStatus,
+		DeleteKeepsTmux:     !*deleteKillsTmux,
+		SpoolDir:            *spoolDir,
+		SpoolMaxBytes:       *spoolMaxBytes,
+		SpoolReplayBytes:    *spoolReplayBytes,
+		ScrollbackBytes:     *scrollbackBytes,
+		ReadBufferSize:      *readBufferBytes,
+		OutputBatchBytes:    *outputBatchBytes,
+		MaxArgs:             *maxArgs,
+		MaxArgsBytes:        *maxArgsBytes,
+		RecordDir:           *recordDir,
+		RecordTimestamps:    *recordTimestamps,
+		RecordMaxBytes:      *recordMaxBytes,
+		RecordMaxDuration:   *recordMaxDuration,
+		MaxSessions:         *maxSessions,
+		EvictionPolicy:      session.EvictionPolicy(*evictionPolicy),
+		BellEvents:          *bellEvents,
+		RedactPatterns:      redactRegexps,
+		RedactOverlap:       *redactOverlap,
+		OutputCharset:       *outputCharset,
+		InputIdleTimeout:    *inputIdleTimeout,
+		IdleTimeout:         *idleTimeout,
+		InputIdleAction:     session.IdleAction(*inputIdleAction),
+		OutputIdleTimeout:   *outputIdleTimeout,
+		OutputIdleAction:    session.IdleAction(*outputIdleAction),
+		RestartMaxRetries:   *restartMaxRetries,
+		RestartBackoff:      *restartBackoff,
+		VerifyResize:        *verifyResize,
+		SingleWriter:        *singleWriter,
+		WriteTimeout:        *wsWriteTimeout,
+		InputReplayWindow:   *inputReplayWindow,
+		MaxResizeRate:       *maxResizeRate,
+		MaxOutputRate:       *maxOutputRate,
+		MaxOutputBytes:      *maxOutputBytes,
+		Banner:              *banner,
+		CommandBanners:      commandBannerMap,
+		InitCommands:        initCommands,
+		CommandSizes:        commandSizeMap,
+		MinSize:             minSizeValue,
+		Profiles:            profiles,
+		DefaultSessionID:    *defaultSession,
+		ExitedTTL:           *exitedTTL,
+	}
+
+	var tokens []string
+	for _, value := range authTokens {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	var authModes []string
+	if *authFile != "" || (*authUser != "" && *authPass != "") {
+		authModes = append(authModes, "basic")
+	}
+	if len(tokens) > 0 {
+		authModes = append(authModes, "bearer")
+	}
+	authMode := "none"
+	if len(authModes) > 0 {
+		authMode = strings.Join(authModes, "+")
+	}
+	addr := fmt.Sprintf("%s:%d", *host, *port)
+
+	// Fail fast on contradictory settings before anything is spawned
+	warnings, err := validateConfig(poolConfig, *authUser, *authPass)
+	for _, w := range warnings {
+		slog.Warn("Configuration warning", "warning", w)
+	}
+	if err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	logConfigSummary(poolConfig, addr, authMode)
+
+	pool := session.NewPool(poolConfig)
+	pool.Recover()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go pool.StartCleanup(ctx)
 	go pool.StartTmuxCleanup(ctx)
 
-	var authenticator *auth.BasicAuth
-	if *authUser != "" && *authPass != "" {
-		authenticator = auth.NewBasicAuth(*authUser, *authPass)
+	var authenticators []auth.Authenticator
+	if *authFile != "" {
+		if *authUser != "" || *authPass != "" {
+			slog.Warn("-auth-file overrides -auth-user and -auth-pass")
+		}
+		basicAuth, err := auth.NewBasicAuthFromFile(*authFile)
+		if err != nil {
+			slog.Error("Failed to load -auth-file", "path", *authFile, "error", err)
+			fmt.Fprintf(os.Stderr, "Error: failed to load -auth-file: %v\n", err)
+			os.Exit(1)
+		}
+		authenticators = append(authenticators, basicAuth)
+		slog.Info("Basic auth enabled", "path", *authFile, "users", basicAuth.Users())
+
+		// Reload credentials on SIGHUP so they can rotate without a restart
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := basicAuth.Reload(); err != nil {
+					slog.Error("Failed to reload -auth-file, keeping current credentials", "path", *authFile, "error", err)
+					continue
+				}
+				slog.Info("Reloaded -auth-file", "path", *authFile, "users", basicAuth.Users())
+			}
+		}()
+	} else if *authUser != "" && *authPass != "" {
+		authenticators = append(authenticators, auth.NewBasicAuth(*authUser, *authPass))
 		slog.Info("Basic auth enabled")
 	}
+	if len(tokens) > 0 {
+		authenticators = append(authenticators, auth.NewTokenAuth(tokens))
+		slog.Info("Token auth enabled", "tokens", len(tokens))
+	}
+	authenticator := auth.Any(authenticators...)
 
-	handler := api.NewHandler(pool, authenticator)
+	handler := api.NewHandler(pool, authenticator, api.Options{
+		TicketTTL:   *ticketTTL,
+		StrictJSON:  *strictJSON,
+		MetricsAuth: *metricsAuth,
+		Build:       api.BuildInfo{Version: version, Commit: commit, Date: date},
+
+		DefaultSessionID: *defaultSession,
+	})
 
-	addr := fmt.Sprintf("%s:%d", *host, *port)
 	server := &http.Server{
 		Addr:         addr,
 		Handler:      handler,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
+	useTLS := *tlsCert != ""
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+		server.TLSConfig = &tls.Config{MinVersion: minTLSVersion}
+	}
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
-		slog.Info("Starting terminus-pty", "addr", addr, "command", cmdPath, "args", cmdArgs, "workdir", *workdir, "version", version, "tmux_enabled", *tmuxEnabled, "session_timeout", *sessionTimeout)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Info("Starting terminus-pty", "addr", addr, "scheme", scheme, "command", cmdPath, "args", cmdArgs, "workdir", *workdir, "version", version, "tmux_enabled", *tmuxEnabled, "session_timeout", *sessionTimeout)
+		var err error
+		if useTLS {
+			err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			slog.Error("Server error", "error", err)
 			os.Exit(1)
 		}
 	}()
 
-	<-done
-	slog.Info("Shutting down...")
+	// SIGTERM drains and leaves tmux sessions running; SIGINT closes
+	// everything. A second SIGINT exits without waiting.
+	handleShutdown(signals, func(sig os.Signal) {
+		cancel()
+		shutdownPool(pool, sig, *shutdownGrace)
 
-	cancel()
-	pool.CloseAll()
-
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer shutdownCancel()
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		slog.Error("Shutdown error", "error", err)
-	}
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Shutdown error", "error", err)
+		}
+	}, func() {
+		slog.Warn("Forced shutdown")
+		os.Exit(1)
+	})
 
 	slog.Info("Goodbye")
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/session"
+)
+
+// profileConfig is the JSON form of a session profile in the -profiles file.
+type profileConfig struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Vars    map[string]string `json:"vars"` // variable name -> regexp its values must match
+	Env     map[string]string `json:"env"`
+	Cols    uint16            `json:"cols"`
+	Rows    uint16            `json:"rows"`
+	Timeout string            `json:"timeout"` // Go duration, e.g. "2h"
+	Tmux    *bool             `json:"tmux"`
+}
+
+// loadProfiles reads a JSON object mapping profile names to profile settings.
+func loadProfiles(path string) (map[string]session.Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var configs map[string]profileConfig
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&configs); err != nil {
+		return nil, fmt.Errorf("invalid profiles file: %w", err)
+	}
+
+	profiles := make(map[string]session.Profile, len(configs))
+	for name, cfg := range configs {
+		var timeout time.Duration
+		if cfg.Timeout != "" {
+			if timeout, err = time.ParseDuration(cfg.Timeout); err != nil || timeout < 0 {
+				return nil, fmt.Errorf("profile %q: invalid timeout %q", name, cfg.Timeout)
+			}
+		}
+		if err := session.ValidateEnv(cfg.Env); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+		var vars map[string]*regexp.Regexp
+		if len(cfg.Vars) > 0 {
+			vars = make(map[string]*regexp.Regexp, len(cfg.Vars))
+			for varName, pattern := range cfg.Vars {
+				if vars[varName], err = session.CompileVar(varName, pattern); err != nil {
+					return nil, fmt.Errorf("profile %q: %w", name, err)
+				}
+			}
+			if err := session.CheckPlaceholders(cfg.Args, vars); err != nil {
+				return nil, fmt.Errorf("profile %q: %w", name, err)
+			}
+		}
+		profiles[name] = session.Profile{
+			Command: cfg.Command,
+			Args:    cfg.Args,
+			Vars:    vars,
+			Env:     cfg.Env,
+			Cols:    cfg.Cols,
+			Rows:    cfg.Rows,
+			Timeout: timeout,
+			Tmux:    cfg.Tmux,
+		}
+	}
+	return profiles, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeProfiles(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProfilesVars(t *testing.T) {
+	profiles, err := loadProfiles(writeProfiles(t, `{
+		"ssh": {"command": "/usr/bin/ssh", "args": ["--", "{host}"], "vars": {"host": "[a-z.]+"}}
+	}`))
+	if err != nil {
+		t.Fatalf("loadProfiles: %v", err)
+	}
+	re := profiles["ssh"].Vars["host"]
+	if re == nil || !re.MatchString("example.com") || re.MatchString("example.com; id") {
+		t.Errorf("host pattern = %v, want it anchored to the whole value", re)
+	}
+
+	for name, data := range map[string]string{
+		"undeclared placeholder": `{"p": {"args": ["{host}"], "vars": {"user": "[a-z]+"}}}`,
+		"invalid name":           `{"p": {"args": ["x"], "vars": {"ho-st": "[a-z]+"}}}`,
+		"invalid pattern":        `{"p": {"args": ["{host}"], "vars": {"host": "[a-z"}}}`,
+		"empty pattern":          `{"p": {"args": ["{host}"], "vars": {"host": ""}}}`,
+	} {
+		if _, err := loadProfiles(writeProfiles(t, data)); err == nil {
+			t.Errorf("%s: loadProfiles succeeded, want error", name)
+		}
+	}
+}
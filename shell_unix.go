@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// defaultCommand returns the command sessions run when neither -command nor
+// -shell is given: $SHELL, or /bin/bash.
+func defaultCommand() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/bash"
+}
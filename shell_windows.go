@@ -0,0 +1,20 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// defaultCommand returns the command sessions run when neither -command nor
+// -shell is given: PowerShell if installed, otherwise %COMSPEC%.
+func defaultCommand() string {
+	if path, err := exec.LookPath("powershell.exe"); err == nil {
+		return path
+	}
+	if comspec := os.Getenv("COMSPEC"); comspec != "" {
+		return comspec
+	}
+	return "cmd.exe"
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/session"
+)
+
+// handleShutdown waits for the first signal and runs shutdown for it. While
+// shutdown is in progress, a further SIGINT calls force, so a repeated Ctrl-C
+// doesn't have to wait for a slow drain. Other signals received during
+// shutdown are ignored. Returns once shutdown finishes or force is called.
+func handleShutdown(signals <-chan os.Signal, shutdown func(sig os.Signal), force func()) {
+	first := <-signals
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		shutdown(first)
+	}()
+
+	for {
+		select {
+		case <-finished:
+			return
+		case sig := <-signals:
+			if sig == syscall.SIGINT {
+				force()
+				return
+			}
+			slog.Info("Already shutting down, ignoring signal", "signal", sig)
+		}
+	}
+}
+
+// shutdownPool ends the pool's sessions for the shutdown signal sig. SIGTERM
+// gives clients up to grace to disconnect and then detaches the sessions,
+// leaving tmux sessions running; other signals close everything.
+func shutdownPool(pool *session.Pool, sig os.Signal, grace time.Duration) {
+	if sig != syscall.SIGTERM {
+		slog.Info("Shutting down... (interrupt again to force)")
+		pool.CloseAll()
+		return
+	}
+	if grace > 0 {
+		slog.Info("Draining sessions", "grace", grace)
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		pool.Drain(ctx)
+		cancel()
+	}
+	slog.Info("Shutting down gracefully, preserving tmux sessions...")
+	pool.DetachAll()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/session"
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
+)
+
+// runShutdown runs handleShutdown on signals in the background, with a
+// shutdown that reports its signal and then blocks until release is closed.
+// The returned channels report the shutdown signal, a call of force and the
+// return of handleShutdown.
+func runShutdown(signals chan os.Signal, release chan struct{}) (started chan os.Signal, forced, returned chan struct{}) {
+	started = make(chan os.Signal, 1)
+	forced = make(chan struct{})
+	returned = make(chan struct{})
+	go func() {
+		defer close(returned)
+		handleShutdown(signals, func(sig os.Signal) {
+			started <- sig
+			<-release
+		}, func() { close(forced) })
+	}()
+	return started, forced, returned
+}
+
+func TestHandleShutdownFinishes(t *testing.T) {
+	signals := make(chan os.Signal, 2)
+	release := make(chan struct{})
+	started, forced, returned := runShutdown(signals, release)
+
+	signals <- syscall.SIGTERM
+	if sig := <-started; sig != syscall.SIGTERM {
+		t.Fatalf("shutdown for %v, want SIGTERM", sig)
+	}
+	// Another SIGTERM doesn't cut the shutdown short
+	signals <- syscall.SIGTERM
+	select {
+	case <-returned:
+		t.Fatal("returned before shutdown finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not return once shutdown finished")
+	}
+	select {
+	case <-forced:
+		t.Fatal("forced a shutdown that finished")
+	default:
+	}
+}
+
+func TestHandleShutdownSecondInterruptForces(t *testing.T) {
+	signals := make(chan os.Signal, 2)
+	release := make(chan struct{})
+	defer close(release)
+	started, forced, returned := runShutdown(signals, release)
+
+	signals <- syscall.SIGINT
+	if sig := <-started; sig != syscall.SIGINT {
+		t.Fatalf("shutdown for %v, want SIGINT", sig)
+	}
+	signals <- syscall.SIGINT
+	select {
+	case <-forced:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second SIGINT did not force")
+	}
+	// The blocked shutdown is abandoned
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not return after forcing")
+	}
+}
+
+func TestShutdownPool(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	// A private tmux server, so the test leaves the user's alone. Inside
+	// tmux, $TMUX would name the server regardless of TMUX_TMPDIR.
+	t.Setenv("TMUX", "")
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	t.Cleanup(func() { exec.Command("tmux", "kill-server").Run() })
+
+	for _, tt := range []struct {
+		sig      os.Signal
+		keepTmux bool
+	}{
+		{syscall.SIGTERM, true},
+		{syscall.SIGINT, false},
+	} {
+		pool := session.NewPool(session.PoolConfig{
+			DefaultCommand: "/bin/sh",
+			SessionTimeout: time.Minute,
+			TmuxEnabled:    true,
+		})
+		sess, err := pool.Create(session.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		shutdownPool(pool, tt.sig, time.Second)
+		if n := pool.Count(); n != 0 {
+			t.Errorf("%v: pool has %d sessions after shutdown, want 0", tt.sig, n)
+		}
+		if !sess.IsClosed() {
+			t.Errorf("%v: session not closed", tt.sig)
+		}
+		if exists := tmux.SessionExists(sess.TmuxSessionName); exists != tt.keepTmux {
+			t.Errorf("%v: tmux session exists = %v, want %v", tt.sig, exists, tt.keepTmux)
+		}
+		tmux.KillSession(sess.TmuxSessionName)
+	}
+}
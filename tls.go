@@ -0,0 +1,23 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// tlsVersions maps -tls-min-version values to crypto/tls versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion parses a TLS version given as e.g. "1.2".
+func parseTLSVersion(s string) (uint16, error) {
+	v, ok := tlsVersions[s]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", s)
+	}
+	return v, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/session"
+	"github.com/itsmylife44/terminus-pty/internal/tmux"
+)
+
+// validateConfig checks the effective configuration for contradictory or
+// unusable settings. Fatal problems are returned as an error; settings that
+// work but are probably not what the operator intended are returned as warnings.
+func validateConfig(cfg session.PoolConfig, authUser, authPass string) (warnings []string, err error) {
+	var errs []error
+
+	if cfg.SessionTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("-session-timeout must be positive, got %s", cfg.SessionTimeout))
+	}
+	if cfg.CleanupInterval <= 0 {
+		errs = append(errs, fmt.Errorf("-cleanup-interval must be positive, got %s", cfg.CleanupInterval))
+	}
+	if cfg.MaxInactive <= 0 {
+		errs = append(errs, fmt.Errorf("-max-inactive must be positive, got %s", cfg.MaxInactive))
+	}
+	if cfg.TmuxHistoryLimit < 0 {
+		errs = append(errs, fmt.Errorf("-tmux-history-limit must not be negative, got %d", cfg.TmuxHistoryLimit))
+	}
+	if cfg.TmuxReplayLines < 0 {
+		errs = append(errs, fmt.Errorf("-tmux-replay-lines must not be negative, got %d", cfg.TmuxReplayLines))
+	}
+	if (authUser == "") != (authPass == "") {
+		errs = append(errs, errors.New("-auth-user and -auth-pass must be set together"))
+	}
+	if cfg.SpoolMaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("-spool-max-bytes must not be negative, got %d", cfg.SpoolMaxBytes))
+	}
+	if cfg.OutputCharset != "" {
+		if _, err := session.LookupCharset(cfg.OutputCharset); err != nil {
+			errs = append(errs, fmt.Errorf("-output-charset: %w", err))
+		}
+	}
+	if cfg.RedactOverlap < 0 {
+		errs = append(errs, fmt.Errorf("-redact-overlap must not be negative, got %d", cfg.RedactOverlap))
+	}
+	for _, idle := range []struct {
+		flag    string
+		timeout time.Duration
+		action  session.IdleAction
+	}{
+		{"input-idle", cfg.InputIdleTimeout, cfg.InputIdleAction},
+		{"output-idle", cfg.OutputIdleTimeout, cfg.OutputIdleAction},
+	} {
+		if idle.timeout < 0 {
+			errs = append(errs, fmt.Errorf("-%s-timeout must not be negative, got %s", idle.flag, idle.timeout))
+		}
+		if idle.action != session.IdleActionWarn && idle.action != session.IdleActionClose {
+			errs = append(errs, fmt.Errorf("-%s-action must be warn or close, got %q", idle.flag, idle.action))
+		}
+		if idle.timeout > 0 && idle.timeout < cfg.CleanupInterval {
+			errs = append(errs, fmt.Errorf("-%s-timeout (%s) is shorter than -cleanup-interval (%s) and cannot be enforced", idle.flag, idle.timeout, cfg.CleanupInterval))
+		}
+	}
+	if cfg.IdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("-idle-timeout must not be negative, got %s", cfg.IdleTimeout))
+	}
+	if cfg.IdleTimeout > 0 && cfg.IdleTimeout < cfg.CleanupInterval {
+		errs = append(errs, fmt.Errorf("-idle-timeout (%s) is shorter than -cleanup-interval (%s) and cannot be enforced", cfg.IdleTimeout, cfg.CleanupInterval))
+	}
+	if cfg.Term == "" || strings.ContainsAny(cfg.Term, " \t\x00") {
+		errs = append(errs, fmt.Errorf("-term must be a terminal type such as %s, got %q", session.DefaultTerm, cfg.Term))
+	}
+	if strings.ContainsAny(cfg.TmuxTerm, " \t\x00") {
+		errs = append(errs, fmt.Errorf("-tmux-term must be a terminal type such as tmux-256color, got %q", cfg.TmuxTerm))
+	}
+	if err := session.ValidateEnv(cfg.Env); err != nil {
+		errs = append(errs, fmt.Errorf("-env: %w", err))
+	}
+	if cfg.WriteTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("-ws-write-timeout must be positive, got %s", cfg.WriteTimeout))
+	}
+	if cfg.InputReplayWindow < 0 {
+		errs = append(errs, fmt.Errorf("-input-replay-window must not be negative, got %s", cfg.InputReplayWindow))
+	}
+	if cfg.MaxResizeRate < 0 {
+		errs = append(errs, fmt.Errorf("-max-resize-rate must not be negative, got %g", cfg.MaxResizeRate))
+	}
+	if cfg.MaxOutputRate < 0 {
+		errs = append(errs, fmt.Errorf("-max-output-rate must not be negative, got %d", cfg.MaxOutputRate))
+	}
+	if cfg.MaxOutputBytes < 0 {
+		errs = append(errs, fmt.Errorf("-max-output-bytes must not be negative, got %d", cfg.MaxOutputBytes))
+	}
+	for name, prof := range cfg.Profiles {
+		if prof.Tmux != nil && *prof.Tmux && !cfg.TmuxEnabled {
+			if err := tmux.CheckInstalled(); errors.Is(err, tmux.ErrUnsupported) {
+				errs = append(errs, fmt.Errorf("profile %q enables tmux: %w", name, err))
+			} else if err != nil {
+				errs = append(errs, fmt.Errorf("profile %q enables tmux but tmux is not installed", name))
+			}
+		}
+	}
+	if cfg.RestartMaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("-restart-max-retries must not be negative, got %d", cfg.RestartMaxRetries))
+	}
+	if cfg.RestartBackoff < 0 {
+		errs = append(errs, fmt.Errorf("-restart-backoff must not be negative, got %s", cfg.RestartBackoff))
+	}
+	if cfg.SpoolReplayBytes < 0 {
+		errs = append(errs, fmt.Errorf("-spool-replay-bytes must not be negative, got %d", cfg.SpoolReplayBytes))
+	}
+	if cfg.ExitedTTL < 0 {
+		errs = append(errs, fmt.Errorf("-exited-ttl must not be negative, got %s", cfg.ExitedTTL))
+	}
+	if cfg.ScrollbackBytes < 0 {
+		errs = append(errs, fmt.Errorf("-scrollback-bytes must not be negative, got %d", cfg.ScrollbackBytes))
+	}
+	if cfg.ReadBufferSize < 512 || cfg.ReadBufferSize > 1<<20 {
+		errs = append(errs, fmt.Errorf("-read-buffer-bytes must be between 512 and 1048576, got %d", cfg.ReadBufferSize))
+	}
+	if cfg.OutputBatchBytes < 0 || cfg.OutputBatchBytes > 1<<20 {
+		errs = append(errs, fmt.Errorf("-output-batch-bytes must be between 0 and 1048576, got %d", cfg.OutputBatchBytes))
+	}
+	if cfg.RecordMaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("-record-max-bytes must not be negative, got %d", cfg.RecordMaxBytes))
+	}
+	if cfg.RecordMaxDuration < 0 {
+		errs = append(errs, fmt.Errorf("-record-max-duration must not be negative, got %s", cfg.RecordMaxDuration))
+	}
+	if cfg.MaxSessions < 0 {
+		errs = append(errs, fmt.Errorf("-max-sessions must not be negative, got %d", cfg.MaxSessions))
+	}
+	if cfg.EvictionPolicy != session.EvictReject && cfg.EvictionPolicy != session.EvictLRU {
+		errs = append(errs, fmt.Errorf("-eviction-policy must be reject or lru, got %q", cfg.EvictionPolicy))
+	}
+	if cfg.MaxArgs < 0 {
+		errs = append(errs, fmt.Errorf("-max-args must not be negative, got %d", cfg.MaxArgs))
+	}
+	if cfg.MaxArgsBytes < 0 {
+		errs = append(errs, fmt.Errorf("-max-args-bytes must not be negative, got %d", cfg.MaxArgsBytes))
+	}
+	if cfg.WorkdirRoot != "" {
+		if info, err := os.Stat(cfg.WorkdirRoot); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("-workdir-root must be an existing directory, got %q", cfg.WorkdirRoot))
+		}
+	}
+
+	if len(cfg.AllowedCommands) > 0 {
+		pool := session.NewPool(cfg)
+		if pool.CheckCommand(cfg.DefaultCommand) != nil {
+			warnings = append(warnings, fmt.Sprintf("-command %s is not in -allowed-commands; creates without a command will be rejected", cfg.DefaultCommand))
+		}
+		if cfg.FallbackCommand != "" && pool.CheckCommand(cfg.FallbackCommand) != nil {
+			warnings = append(warnings, fmt.Sprintf("-fallback-command %s is not in -allowed-commands and will not be tried", cfg.FallbackCommand))
+		}
+	}
+	if cfg.SessionTimeout > 0 && cfg.CleanupInterval > cfg.SessionTimeout {
+		warnings = append(warnings, fmt.Sprintf("-cleanup-interval (%s) exceeds -session-timeout (%s); sessions may outlive their timeout", cfg.CleanupInterval, cfg.SessionTimeout))
+	}
+	if cfg.TmuxEnabled && cfg.MaxInactive > 0 && cfg.TmuxCleanupInterval > cfg.MaxInactive {
+		warnings = append(warnings, fmt.Sprintf("-cleanup-interval-tmux (%s) exceeds -max-inactive (%s); tmux sessions may outlive their inactivity limit", cfg.TmuxCleanupInterval, cfg.MaxInactive))
+	}
+	if cfg.SpoolReplayBytes > 2*cfg.SpoolMaxBytes && cfg.SpoolMaxBytes > 0 {
+		warnings = append(warnings, fmt.Sprintf("-spool-replay-bytes (%d) exceeds retained spool size (%d)", cfg.SpoolReplayBytes, 2*cfg.SpoolMaxBytes))
+	}
+
+	return warnings, errors.Join(errs...)
+}
+
+// logConfigSummary logs the effective configuration as a single structured record.
+func logConfigSummary(cfg session.PoolConfig, addr, authMode string) {
+	slog.Info("Effective configuration",
+		"addr", addr,
+		"command", cfg.DefaultCommand,
+		"args", cfg.DefaultArgs,
+		"workdir", cfg.DefaultWorkdir,
+		"workdir_root", cfg.WorkdirRoot,
+		"allowed_commands", cfg.AllowedCommands,
+		"fallback_command", cfg.FallbackCommand,
+		"command_workdirs", cfg.CommandWorkdirs,
+		"term", cfg.Term,
+		"colorterm", cfg.ColorTerm,
+		"tmux_term", cfg.TmuxTerm,
+		"env", len(cfg.Env),
+		"auth", authMode,
+		"session_timeout", cfg.SessionTimeout,
+		"cleanup_interval", cfg.CleanupInterval,
+		"tmux_enabled", cfg.TmuxEnabled,
+		"tmux_max_inactive", cfg.MaxInactive,
+		"tmux_cleanup_interval", cfg.TmuxCleanupInterval,
+		"tmux_history_limit", cfg.TmuxHistoryLimit,
+		"tmux_replay_lines", cfg.TmuxReplayLines,
+		"tmux_status", !cfg.TmuxStatusOff,
+		"delete_kills_tmux", !cfg.DeleteKeepsTmux,
+		"spool_dir", cfg.SpoolDir,
+		"spool_max_bytes", cfg.SpoolMaxBytes,
+		"spool_replay_bytes", cfg.SpoolReplayBytes,
+		"scrollback_bytes", cfg.ScrollbackBytes,
+		"read_buffer_bytes", cfg.ReadBufferSize,
+		"output_batch_bytes", cfg.OutputBatchBytes,
+		"bell_events", cfg.BellEvents,
+		"input_idle_timeout", cfg.InputIdleTimeout,
+		"input_idle_action", cfg.InputIdleAction,
+		"output_idle_timeout", cfg.OutputIdleTimeout,
+		"output_idle_action", cfg.OutputIdleAction,
+		"idle_timeout", cfg.IdleTimeout,
+		"redact_patterns", len(cfg.RedactPatterns),
+		"output_charset", cfg.OutputCharset,
+		"restart_max_retries", cfg.RestartMaxRetries,
+		"restart_backoff", cfg.RestartBackoff,
+		"verify_resize", cfg.VerifyResize,
+		"single_writer", cfg.SingleWriter,
+		"ws_write_timeout", cfg.WriteTimeout,
+		"input_replay_window", cfg.InputReplayWindow,
+		"max_resize_rate", cfg.MaxResizeRate,
+		"max_output_rate", cfg.MaxOutputRate,
+		"max_output_bytes", cfg.MaxOutputBytes,
+		"max_args", cfg.MaxArgs,
+		"max_args_bytes", cfg.MaxArgsBytes,
+		"record_dir", cfg.RecordDir,
+		"record_timestamps", cfg.RecordTimestamps,
+		"record_max_bytes", cfg.RecordMaxBytes,
+		"record_max_duration", cfg.RecordMaxDuration,
+		"max_sessions", cfg.MaxSessions,
+		"eviction_policy", cfg.EvictionPolicy,
+		"banner", cfg.Banner != "",
+		"command_banners", len(cfg.CommandBanners),
+		"init_commands", len(cfg.InitCommands),
+		"command_sizes", cfg.CommandSizes,
+		"min_size", fmt.Sprintf("%dx%d", cfg.MinSize.Cols, cfg.MinSize.Rows),
+		"profiles", len(cfg.Profiles),
+		"exited_ttl", cfg.ExitedTTL,
+	)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsmylife44/terminus-pty/internal/session"
+)
+
+// validConfig returns a configuration validateConfig accepts without
+// warnings, like the flag defaults.
+func validConfig() session.PoolConfig {
+	return session.PoolConfig{
+		SessionTimeout:   30 * time.Minute,
+		CleanupInterval:  time.Minute,
+		MaxInactive:      24 * time.Hour,
+		DefaultCommand:   "/bin/sh",
+		Term:             session.DefaultTerm,
+		InputIdleAction:  session.IdleActionWarn,
+		OutputIdleAction: session.IdleActionWarn,
+		WriteTimeout:     10 * time.Second,
+		ReadBufferSize:   session.DefaultReadBufferSize,
+		EvictionPolicy:   session.EvictReject,
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(cfg *session.PoolConfig)
+		user     string
+		pass     string
+		wantErr  string // substring of the error, empty if none
+		wantWarn string // substring of a warning, empty if none
+	}{
+		{name: "defaults"},
+		{name: "auth user and pass", user: "admin", pass: "secret"},
+		{name: "auth user without pass", user: "admin", wantErr: "-auth-user and -auth-pass must be set together"},
+		{name: "auth pass without user", pass: "secret", wantErr: "-auth-user and -auth-pass must be set together"},
+		{
+			name:    "zero session timeout",
+			change:  func(cfg *session.PoolConfig) { cfg.SessionTimeout = 0 },
+			wantErr: "-session-timeout must be positive",
+		},
+		{
+			name:    "negative history limit",
+			change:  func(cfg *session.PoolConfig) { cfg.TmuxHistoryLimit = -1 },
+			wantErr: "-tmux-history-limit must not be negative",
+		},
+		{
+			name:    "unknown charset",
+			change:  func(cfg *session.PoolConfig) { cfg.OutputCharset = "no-such-charset" },
+			wantErr: "-output-charset",
+		},
+		{
+			name:    "unknown idle action",
+			change:  func(cfg *session.PoolConfig) { cfg.InputIdleAction = "kill" },
+			wantErr: "-input-idle-action must be warn or close",
+		},
+		{
+			name: "idle timeout below cleanup interval",
+			change: func(cfg *session.PoolConfig) {
+				cfg.OutputIdleTimeout = 10 * time.Second
+			},
+			wantErr: "-output-idle-timeout (10s) is shorter than -cleanup-interval",
+		},
+		{
+			name:    "term with a space",
+			change:  func(cfg *session.PoolConfig) { cfg.Term = "xterm 256color" },
+			wantErr: "-term must be a terminal type",
+		},
+		{
+			name:    "zero write timeout",
+			change:  func(cfg *session.PoolConfig) { cfg.WriteTimeout = 0 },
+			wantErr: "-ws-write-timeout must be positive",
+		},
+		{
+			name:    "read buffer too small",
+			change:  func(cfg *session.PoolConfig) { cfg.ReadBufferSize = 100 },
+			wantErr: "-read-buffer-bytes must be between 512 and 1048576",
+		},
+		{
+			name:    "unknown eviction policy",
+			change:  func(cfg *session.PoolConfig) { cfg.EvictionPolicy = "fifo" },
+			wantErr: "-eviction-policy must be reject or lru",
+		},
+		{
+			name:    "missing workdir root",
+			change:  func(cfg *session.PoolConfig) { cfg.WorkdirRoot = "/no/such/dir" },
+			wantErr: "-workdir-root must be an existing directory",
+		},
+		{
+			name:     "default command not allowed",
+			change:   func(cfg *session.PoolConfig) { cfg.AllowedCommands = []string{"/bin/cat"} },
+			wantWarn: "-command /bin/sh is not in -allowed-commands",
+		},
+		{
+			name:     "cleanup interval above session timeout",
+			change:   func(cfg *session.PoolConfig) { cfg.CleanupInterval = time.Hour },
+			wantWarn: "-cleanup-interval (1h0m0s) exceeds -session-timeout",
+		},
+		{
+			name: "replay beyond retained spool",
+			change: func(cfg *session.PoolConfig) {
+				cfg.SpoolMaxBytes = 1000
+				cfg.SpoolReplayBytes = 5000
+			},
+			wantWarn: "-spool-replay-bytes (5000) exceeds retained spool size (2000)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			if tt.change != nil {
+				tt.change(&cfg)
+			}
+			warnings, err := validateConfig(cfg, tt.user, tt.pass)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+
+			switch {
+			case tt.wantWarn == "" && len(warnings) > 0:
+				t.Errorf("unexpected warnings: %q", warnings)
+			case tt.wantWarn != "" && !slices.ContainsFunc(warnings, func(w string) bool { return strings.Contains(w, tt.wantWarn) }):
+				t.Errorf("warnings = %q, want one containing %q", warnings, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestValidateConfigReportsAllErrors(t *testing.T) {
+	cfg := validConfig()
+	cfg.SessionTimeout = 0
+	cfg.MaxSessions = -1
+	cfg.EvictionPolicy = "fifo"
+	_, err := validateConfig(cfg, "", "")
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{"-session-timeout", "-max-sessions", "-eviction-policy"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}